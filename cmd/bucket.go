@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/transfer"
+	"github.com/cowdogmoo/bcp/pkg/validation"
+	"github.com/spf13/cobra"
+)
+
+var bucketExpireDays int
+
+func init() {
+	bucketInitCmd.Flags().IntVar(&bucketExpireDays, "expire-days", 7, "days after which staged objects are deleted by the bucket's lifecycle rule")
+
+	bucketCmd.AddCommand(bucketInitCmd)
+	bucketCmd.AddCommand(bucketCleanupCmd)
+	rootCmd.AddCommand(bucketCmd)
+}
+
+var bucketCmd = &cobra.Command{
+	Use:   "bucket",
+	Short: "Manage staging buckets",
+}
+
+var bucketInitCmd = &cobra.Command{
+	Use:   "init <name>",
+	Short: "Create or update a staging bucket",
+	Long: `Create a bucket to stage transfers in, or update an existing one you own.
+
+The bucket is created in the configured region and set up so staged data
+never lingers or leaks:
+  - objects under bcp's staging prefixes expire after --expire-days days
+  - incomplete multipart uploads are aborted after a day
+  - all public access is blocked
+  - objects are encrypted by default (SSE-S3)
+
+Lifecycle rules other than bcp's own, and existing default encryption such
+as SSE-KMS, are kept when updating a bucket.
+
+Example:
+  bcp bucket init my-staging-bucket
+  bcp bucket init my-staging-bucket --region eu-west-1 --expire-days 3`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bucketName := args[0]
+		if err := validation.ValidateBucketName(bucketName); err != nil {
+			return fmt.Errorf("invalid bucket name: %w", err)
+		}
+		if err := validation.ValidateExpirationDays(bucketExpireDays); err != nil {
+			return err
+		}
+
+		ctx := commandContext(cmd)
+		clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
+		if err != nil {
+			return err
+		}
+
+		log.Info("Initializing staging bucket %s in %s...", bucketName, clients.Region())
+		created, err := transfer.InitBucket(ctx, clients.S3(), bucketName, clients.Region(), bucketExpireDays)
+		if err != nil {
+			return err
+		}
+
+		if created {
+			log.Info("Created staging bucket %s", bucketName)
+		} else {
+			log.Info("Updated staging bucket %s", bucketName)
+		}
+		return nil
+	},
+}
+
+var bucketCleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete ephemeral buckets left behind by bcp",
+	Long: `Delete the buckets --ephemeral-bucket transfers created and did not delete.
+
+bcp records every ephemeral bucket in $HOME/.bcp/buckets and deletes it once
+its transfer finishes. A bucket is left behind when bcp dies during the
+transfer, or when a failed transfer keeps its staged objects for resuming
+with --keep-staged. This deletes every recorded bucket and its contents, so
+run it when no transfers are in progress; transfers whose bucket was
+deleted stage their files again when resumed.
+
+Example:
+  bcp bucket cleanup`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buckets, err := transfer.ListEphemeralBuckets()
+		if err != nil {
+			return err
+		}
+		if len(buckets) == 0 {
+			log.Info("No ephemeral buckets found")
+			return nil
+		}
+
+		ctx := commandContext(cmd)
+		var errs []error
+		for _, bucket := range buckets {
+			// Each bucket is deleted through its own region
+			opts := awsclient.DefaultOptions()
+			opts.Region = bucket.Region
+			clients, err := awsclient.New(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			if err := transfer.DeleteEphemeralBucket(ctx, clients.S3(), bucket); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+
+		log.Info("Deleted %d ephemeral bucket(s)", len(buckets))
+		return nil
+	},
+}
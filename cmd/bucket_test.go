@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import "testing"
+
+func TestBucketInitCmd(t *testing.T) {
+	if bucketInitCmd.Flags().Lookup("expire-days") == nil {
+		t.Error("bucketInitCmd is missing the --expire-days flag")
+	}
+
+	if err := bucketInitCmd.Args(bucketInitCmd, nil); err == nil {
+		t.Error("bucketInitCmd should require a bucket name")
+	}
+	if err := bucketInitCmd.Args(bucketInitCmd, []string{"a", "b"}); err == nil {
+		t.Error("bucketInitCmd should accept only one bucket name")
+	}
+
+	if err := bucketInitCmd.RunE(bucketInitCmd, []string{"Invalid_Bucket"}); err == nil {
+		t.Error("bucketInitCmd should reject invalid bucket names")
+	}
+
+	found := false
+	for _, cmd := range rootCmd.Commands() {
+		if cmd == bucketCmd {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("bucketCmd is not registered on rootCmd")
+	}
+}
+
+func TestBucketCleanupCmd(t *testing.T) {
+	if err := bucketCleanupCmd.Args(bucketCleanupCmd, []string{"extra"}); err == nil {
+		t.Error("bucketCleanupCmd should not accept arguments")
+	}
+
+	found := false
+	for _, cmd := range bucketCmd.Commands() {
+		if cmd == bucketCleanupCmd {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("bucketCleanupCmd is not registered on bucketCmd")
+	}
+}
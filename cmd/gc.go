@@ -0,0 +1,144 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
+	"github.com/cowdogmoo/bcp/pkg/config"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/transfer"
+	"github.com/cowdogmoo/bcp/pkg/validation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var gcDryRun bool
+
+func init() {
+	gcCmd.Flags().Duration("older-than", 24*time.Hour, "only collect staged objects last written longer ago than this")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "show what would be deleted without deleting anything")
+
+	if err := viper.BindPFlag("gc.older_than", gcCmd.Flags().Lookup("older-than")); err != nil {
+		log.Error("Failed to bind older-than flag: %v", err)
+	}
+
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete staged objects left behind by failed transfers",
+	Long: `Delete the objects that failed or interrupted transfers left in the
+staging bucket.
+
+bcp stages files under bcp/<transfer-id>/ in the bucket (bcp-download-* for
+older versions) and normally removes them when a transfer finishes. Objects
+of transfers that crashed, or that were run with --keep-staged, stay behind
+until they are collected. Only transfers whose newest object is older than
+--older-than are collected, so transfers that are still running are left
+alone.
+
+Example:
+  bcp gc --bucket my-bucket --dry-run
+  bcp gc --bucket my-bucket --older-than 168h`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bucketName := bucket
+		if bucketName == "" {
+			bucketName = config.GetBucket()
+		}
+		if bucketName == "" {
+			return fmt.Errorf("bucket name is required (use --bucket flag or set in config)")
+		}
+		if err := validation.ValidateBucketName(bucketName); err != nil {
+			return fmt.Errorf("invalid bucket name: %w", err)
+		}
+
+		ctx := commandContext(cmd)
+		clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		s3Client, _ := transfer.BucketClient(ctx, clients, bucketName)
+
+		cutoff := time.Now().Add(-config.GCOlderThan)
+		log.Info("Looking for staged objects in %s older than %s...", bucketName, config.GCOlderThan)
+		groups, err := transfer.FindStaleStaging(ctx, s3Client, bucketName, cutoff)
+		if err != nil {
+			return err
+		}
+
+		if len(groups) == 0 {
+			log.Info("No stale staged objects found")
+			return nil
+		}
+
+		printStagingGroups(groups)
+
+		if gcDryRun {
+			log.Info("Dry run, nothing was deleted")
+			return nil
+		}
+
+		log.Info("Deleting staged objects of %d transfer(s)...", len(groups))
+		if err := transfer.DeleteStaging(ctx, s3Client, bucketName, groups); err != nil {
+			return fmt.Errorf("failed to delete staged objects: %w", err)
+		}
+		log.Info("Staged objects deleted")
+		return nil
+	},
+}
+
+// printStagingGroups prints a summary of groups and their totals.
+func printStagingGroups(groups []transfer.StagingGroup) {
+	var objects int
+	var size int64
+
+	fmt.Println("\nStaging Prefix                                     Objects       Size Last Modified")
+	fmt.Println("================================================== ======= ========== ====================")
+	for _, group := range groups {
+		fmt.Printf("%-50s %7d %10s %s\n", group.Prefix, group.Objects, formatBytes(group.Size),
+			group.LastModified.Local().Format("2006-01-02 15:04:05"))
+		objects += group.Objects
+		size += group.Size
+	}
+	fmt.Printf("\n%d object(s), %s in %d transfer(s)\n\n", objects, formatBytes(size), len(groups))
+}
+
+// formatBytes renders size in bytes with a binary unit, e.g. "1.5 MiB".
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
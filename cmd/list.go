@@ -27,11 +27,11 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
 	log "github.com/cowdogmoo/bcp/pkg/logging"
 	"github.com/spf13/cobra"
 )
@@ -46,7 +46,7 @@ func init() {
 	listCmd.AddCommand(listInstancesCmd)
 
 	listInstancesCmd.Flags().BoolVarP(&listAll, "all", "a", false, "list all instances (not just SSM-managed)")
-	listInstancesCmd.Flags().StringVarP(&listRegion, "region", "r", "", "AWS region (defaults to config or AWS_REGION)")
+	listInstancesCmd.Flags().StringVarP(&listRegion, "region", "r", "", "AWS region (defaults to the global --region, config, or AWS_REGION)")
 
 	rootCmd.AddCommand(listCmd)
 }
@@ -58,7 +58,7 @@ var listCmd = &cobra.Command{
 
 Available subcommands:
   buckets    - List S3 buckets
-  instances  - List SSM-managed EC2 instances`,
+  instances  - List SSM-managed EC2 instances and hybrid nodes`,
 }
 
 var listBucketsCmd = &cobra.Command{
@@ -71,13 +71,13 @@ Example:
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Info("Fetching S3 buckets...")
 
-		ctx := context.TODO()
-		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
+		ctx := commandContext(cmd)
+		clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
 		if err != nil {
-			return fmt.Errorf("failed to load AWS config: %w", err)
+			return err
 		}
 
-		svc := s3.NewFromConfig(cfg)
+		svc := clients.S3()
 		result, err := svc.ListBuckets(ctx, &s3.ListBucketsInput{})
 		if err != nil {
 			return fmt.Errorf("failed to list buckets: %w", err)
@@ -108,50 +108,61 @@ Example:
 var listInstancesCmd = &cobra.Command{
 	Use:   "instances",
 	Short: "List SSM-managed EC2 instances",
-	Long: `List EC2 instances that are managed by AWS Systems Manager.
+	Long: `List EC2 instances and hybrid nodes (mi- IDs, such as on-prem servers
+registered with an SSM activation) that are managed by AWS Systems Manager.
 By default, only shows instances with SSM agent running and ready.
 
-Use --all to see all EC2 instances (including those without SSM).
+Use --all to see all EC2 instances (including those without SSM) along
+with hybrid nodes.
 
 Example:
   bcp list instances
   bcp list instances --all
   bcp list instances --region us-west-2`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.TODO()
-
-		// Determine region
-		region := listRegion
-		if region == "" {
-			cfg, err := config.LoadDefaultConfig(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to load AWS config: %w", err)
-			}
-			region = cfg.Region
-			if region == "" {
-				region = "us-east-1" // fallback default
-			}
-		}
+		ctx := commandContext(cmd)
 
-		log.Info("Fetching instances in region: %s", region)
+		opts := awsclient.DefaultOptions()
+		if listRegion != "" {
+			opts.Region = listRegion
+		}
 
-		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		clients, err := awsclient.New(ctx, opts)
 		if err != nil {
-			return fmt.Errorf("failed to load AWS config: %w", err)
+			return err
 		}
 
+		log.Info("Fetching instances in region: %s", clients.Region())
+
 		if listAll {
-			return listAllInstances(ctx, cfg)
+			return listAllInstances(ctx, clients.Config(), clients.SSM())
 		}
-		return listSSMInstances(ctx, cfg)
+		return listSSMInstances(ctx, clients.SSM())
 	},
 }
 
-func listSSMInstances(ctx context.Context, cfg aws.Config) error {
-	svc := ssm.NewFromConfig(cfg)
+func listSSMInstances(ctx context.Context, svc *ssm.Client) error {
+	instances, err := describeManagedNodes(ctx, svc)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		log.Info("No SSM-managed instances found")
+		fmt.Println("\nTip: Use --all to see all EC2 instances")
+		return nil
+	}
+
+	log.Info("Found %d SSM-managed instance(s):", len(instances))
+	printManagedNodes(instances)
+	return nil
+}
 
+// describeManagedNodes returns every SSM managed node matching filters.
+func describeManagedNodes(ctx context.Context, svc *ssm.Client, filters ...ssmtypes.InstanceInformationStringFilter) ([]ssmtypes.InstanceInformation, error) {
 	input := &ssm.DescribeInstanceInformationInput{
 		MaxResults: aws.Int32(50),
+		Filters:    filters,
 	}
 
 	var instances []ssmtypes.InstanceInformation
@@ -160,23 +171,21 @@ func listSSMInstances(ctx context.Context, cfg aws.Config) error {
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to list SSM instances: %w", err)
+			return nil, fmt.Errorf("failed to list SSM instances: %w", err)
 		}
 		instances = append(instances, page.InstanceInformationList...)
 	}
+	return instances, nil
+}
 
-	if len(instances) == 0 {
-		log.Info("No SSM-managed instances found")
-		fmt.Println("\nTip: Use --all to see all EC2 instances")
-		return nil
-	}
-
-	log.Info("Found %d SSM-managed instance(s):", len(instances))
-	fmt.Println("\nInstance ID          Status   Platform        IP Address      Name")
-	fmt.Println("==================== ======== =============== =============== ================================")
+// printManagedNodes prints a table of managed nodes.
+func printManagedNodes(instances []ssmtypes.InstanceInformation) {
+	fmt.Println("\nInstance ID          Type   Status   Platform        IP Address      Name")
+	fmt.Println("==================== ====== ======== =============== =============== ================================")
 
 	for _, inst := range instances {
 		instanceID := aws.ToString(inst.InstanceId)
+		nodeType := managedNodeType(inst)
 		status := string(inst.PingStatus)
 		platform := string(inst.PlatformType)
 		ipAddress := aws.ToString(inst.IPAddress)
@@ -189,14 +198,21 @@ func listSSMInstances(ctx context.Context, cfg aws.Config) error {
 			statusStr = "\033[31m" + status + "\033[0m" // red
 		}
 
-		fmt.Printf("%-20s %-8s %-15s %-15s %s\n",
-			instanceID, statusStr, platform, ipAddress, name)
+		fmt.Printf("%-20s %-6s %-8s %-15s %-15s %s\n",
+			instanceID, nodeType, statusStr, platform, ipAddress, name)
 	}
+}
 
-	return nil
+// managedNodeType labels a managed node as an EC2 instance or a hybrid
+// node registered with an SSM activation, such as an on-prem server.
+func managedNodeType(inst ssmtypes.InstanceInformation) string {
+	if inst.ResourceType == ssmtypes.ResourceTypeManagedInstance {
+		return "hybrid"
+	}
+	return "ec2"
 }
 
-func listAllInstances(ctx context.Context, cfg aws.Config) error {
+func listAllInstances(ctx context.Context, cfg aws.Config, ssmClient *ssm.Client) error {
 	svc := ec2.NewFromConfig(cfg)
 
 	result, err := svc.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
@@ -249,6 +265,19 @@ func listAllInstances(ctx context.Context, cfg aws.Config) error {
 	}
 
 	log.Info("Total: %d instances (%d running)", instanceCount, runningCount)
+
+	// Hybrid nodes are not EC2 instances, so only SSM knows about them
+	hybrid, err := describeManagedNodes(ctx, ssmClient, ssmtypes.InstanceInformationStringFilter{
+		Key:    aws.String("ResourceType"),
+		Values: []string{string(ssmtypes.ResourceTypeManagedInstance)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(hybrid) > 0 {
+		log.Info("Found %d hybrid managed node(s):", len(hybrid))
+		printManagedNodes(hybrid)
+	}
 	fmt.Println("\nTip: Use 'bcp list instances' (without --all) to see only SSM-managed instances")
 
 	return nil
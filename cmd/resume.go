@@ -0,0 +1,120 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+	"github.com/cowdogmoo/bcp/pkg/transfer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [transfer-id]",
+	Short: "Resume an interrupted transfer",
+	Long: `Resume a transfer that was interrupted or failed part way through.
+
+bcp records the progress of every transfer in $HOME/.bcp/transfers. Resuming
+skips the phases that already completed and reuses multipart upload parts
+that were already sent to S3. Run without arguments to list the transfers
+that can be resumed.
+
+Example:
+  bcp resume
+  bcp resume 20250101t120000-1a2b3c4d`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: resumeCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return listResumableTransfers()
+		}
+
+		return transfer.Resume(commandContext(cmd), args[0])
+	},
+}
+
+func listResumableTransfers() error {
+	journals, err := journal.List()
+	if err != nil {
+		return fmt.Errorf("failed to list transfers: %w", err)
+	}
+
+	if len(journals) == 0 {
+		log.Info("No interrupted transfers found")
+		return nil
+	}
+
+	log.Info("Found %d resumable transfer(s):", len(journals))
+	fmt.Println("\nTransfer ID                Started              Transfer")
+	fmt.Println("========================== ==================== ================================")
+
+	for _, j := range journals {
+		fmt.Printf("%-26s %-20s %s\n", j.ID, j.CreatedAt.Local().Format("2006-01-02 15:04:05"), describeTransfer(j.Transfer))
+		if len(j.Phases) > 0 {
+			phases := make([]string, len(j.Phases))
+			for i, phase := range j.Phases {
+				phases[i] = string(phase)
+			}
+			fmt.Printf("%-26s completed: %s\n", "", strings.Join(phases, ", "))
+		}
+	}
+
+	return nil
+}
+
+// describeTransfer renders a transfer the way it was typed on the command
+// line.
+func describeTransfer(transferConfig model.TransferConfig) string {
+	if transferConfig.Direction == model.FromRemote {
+		return fmt.Sprintf("%s:%s -> %s", transferConfig.SSMInstanceID, transferConfig.Source, transferConfig.Destination)
+	}
+	return fmt.Sprintf("%s -> %s:%s", transferConfig.Source, transferConfig.SSMInstanceID, transferConfig.Destination)
+}
+
+func resumeCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	journals, err := journal.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, j := range journals {
+		if strings.HasPrefix(j.ID, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", j.ID, describeTransfer(j.Transfer)))
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
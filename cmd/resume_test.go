@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	"github.com/cowdogmoo/bcp/pkg/model"
+	"github.com/spf13/cobra"
+)
+
+func TestResumeCmd(t *testing.T) {
+	if resumeCmd.Use != "resume [transfer-id]" {
+		t.Errorf("resumeCmd.Use = %v, want 'resume [transfer-id]'", resumeCmd.Use)
+	}
+
+	if resumeCmd.RunE == nil {
+		t.Error("resumeCmd.RunE is nil")
+	}
+
+	if err := resumeCmd.Args(resumeCmd, []string{"a", "b"}); err == nil {
+		t.Error("resumeCmd should reject more than one transfer ID")
+	}
+
+	found := false
+	for _, cmd := range rootCmd.Commands() {
+		if cmd == resumeCmd {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("resumeCmd is not registered on rootCmd")
+	}
+}
+
+func TestResumeCompletion(t *testing.T) {
+	orig := journal.Dir
+	journal.Dir = t.TempDir()
+	defer func() { journal.Dir = orig }()
+
+	for _, id := range []string{"20250101t000000-aaaa", "20250102t000000-bbbb"} {
+		if _, err := journal.New(model.TransferConfig{
+			TransferID:    id,
+			Source:        "./files",
+			SSMInstanceID: "i-1234567890abcdef0",
+			Destination:   "/tmp/files",
+			Direction:     model.ToRemote,
+		}); err != nil {
+			t.Fatalf("journal.New() error = %v", err)
+		}
+	}
+
+	completions, directive := resumeCompletion(resumeCmd, []string{}, "20250102")
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v, want ShellCompDirectiveNoFileComp", directive)
+	}
+	if len(completions) != 1 || !strings.HasPrefix(completions[0], "20250102t000000-bbbb\t") {
+		t.Errorf("completions = %v, want only the matching transfer", completions)
+	}
+	if !strings.Contains(completions[0], "./files -> i-1234567890abcdef0:/tmp/files") {
+		t.Errorf("completion description = %q, want the transfer summary", completions[0])
+	}
+
+	completions, _ = resumeCompletion(resumeCmd, []string{"20250101t000000-aaaa"}, "")
+	if len(completions) != 0 {
+		t.Errorf("completions after an ID = %v, want none", completions)
+	}
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
 	"github.com/cowdogmoo/bcp/pkg/completion"
 	"github.com/cowdogmoo/bcp/pkg/config"
 	log "github.com/cowdogmoo/bcp/pkg/logging"
@@ -16,10 +20,25 @@ import (
 )
 
 var (
-	bucket  string
-	cfgFile string
-	verbose bool
-	quiet   bool
+	bucket   string
+	cfgFile  string
+	verbose  bool
+	quiet    bool
+	parallel int
+
+	remoteTransport  string
+	commandTimeout   int
+	keepStaged       bool
+	ephemeralBucket  bool
+	sse              string
+	kmsKeyID         string
+	clientEncryption bool
+	awsProfile       string
+	awsRegion        string
+	roleARN          string
+	s3RoleARN        string
+	externalID       string
+	sessionName      string
 )
 
 func init() {
@@ -29,14 +48,84 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&bucket, "bucket", "b", "", "S3 bucket to use for the transfer (required)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output (debug level)")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "suppress all output except errors")
+	rootCmd.PersistentFlags().IntVarP(&parallel, "parallel", "p", 4, "maximum number of files to transfer concurrently")
+	rootCmd.PersistentFlags().StringVar(&remoteTransport, "remote-transport", string(model.RemoteTransportAuto), "how the instance reaches S3: auto, awscli, or presigned")
+	rootCmd.PersistentFlags().IntVar(&commandTimeout, "command-timeout", 3600, "maximum seconds each SSM command may run on the instance")
+	rootCmd.PersistentFlags().BoolVar(&keepStaged, "keep-staged", false, "keep the objects staged in S3 instead of deleting them after the transfer")
+	rootCmd.PersistentFlags().StringVar(&sse, "sse", "", "server-side encryption for staged objects: AES256 or aws:kms (default: the bucket's default)")
+	rootCmd.PersistentFlags().StringVar(&kmsKeyID, "sse-kms-key-id", "", "KMS key ID, alias or ARN to encrypt staged objects with when --sse is aws:kms")
+	rootCmd.PersistentFlags().BoolVar(&clientEncryption, "client-encryption", false, "encrypt files locally before staging them and decrypt them on the instance (uploads to instances only)")
+	rootCmd.PersistentFlags().BoolVar(&ephemeralBucket, "ephemeral-bucket", false, "stage the transfer in a bucket created for it and deleted afterwards instead of --bucket")
+	rootCmd.PersistentFlags().StringVar(&awsProfile, "profile", "", "AWS shared config profile to use (defaults to config or AWS_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&awsRegion, "region", "", "AWS region to use (defaults to config or AWS_REGION)")
+	rootCmd.PersistentFlags().StringVar(&roleARN, "role-arn", "", "IAM role to assume for AWS calls, such as SSM in a workload account")
+	rootCmd.PersistentFlags().StringVar(&s3RoleARN, "s3-role-arn", "", "IAM role to assume for S3 calls instead of --role-arn")
+	rootCmd.PersistentFlags().StringVar(&externalID, "external-id", "", "external ID to pass when assuming roles")
+	rootCmd.PersistentFlags().StringVar(&sessionName, "session-name", "", "session name to use when assuming roles (default: bcp)")
 
 	if err := rootCmd.RegisterFlagCompletionFunc("bucket", bucketCompletion); err != nil {
 		log.Error("Failed to register bucket completion: %v", err)
 	}
 
+	if err := rootCmd.RegisterFlagCompletionFunc("remote-transport", remoteTransportCompletion); err != nil {
+		log.Error("Failed to register remote transport completion: %v", err)
+	}
+
 	if err := viper.BindPFlag("aws.bucket", rootCmd.PersistentFlags().Lookup("bucket")); err != nil {
 		log.Error("Failed to bind bucket flag: %v", err)
 	}
+
+	if err := viper.BindPFlag("transfer.concurrency", rootCmd.PersistentFlags().Lookup("parallel")); err != nil {
+		log.Error("Failed to bind parallel flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.remote_transport", rootCmd.PersistentFlags().Lookup("remote-transport")); err != nil {
+		log.Error("Failed to bind remote transport flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.command_timeout", rootCmd.PersistentFlags().Lookup("command-timeout")); err != nil {
+		log.Error("Failed to bind command timeout flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.keep_staged", rootCmd.PersistentFlags().Lookup("keep-staged")); err != nil {
+		log.Error("Failed to bind keep staged flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.sse", rootCmd.PersistentFlags().Lookup("sse")); err != nil {
+		log.Error("Failed to bind SSE flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.kms_key_id", rootCmd.PersistentFlags().Lookup("sse-kms-key-id")); err != nil {
+		log.Error("Failed to bind SSE KMS key ID flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("transfer.client_encryption", rootCmd.PersistentFlags().Lookup("client-encryption")); err != nil {
+		log.Error("Failed to bind client encryption flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.profile", rootCmd.PersistentFlags().Lookup("profile")); err != nil {
+		log.Error("Failed to bind profile flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.region", rootCmd.PersistentFlags().Lookup("region")); err != nil {
+		log.Error("Failed to bind region flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.role_arn", rootCmd.PersistentFlags().Lookup("role-arn")); err != nil {
+		log.Error("Failed to bind role ARN flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.s3_role_arn", rootCmd.PersistentFlags().Lookup("s3-role-arn")); err != nil {
+		log.Error("Failed to bind S3 role ARN flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.external_id", rootCmd.PersistentFlags().Lookup("external-id")); err != nil {
+		log.Error("Failed to bind external ID flag: %v", err)
+	}
+
+	if err := viper.BindPFlag("aws.session_name", rootCmd.PersistentFlags().Lookup("session-name")); err != nil {
+		log.Error("Failed to bind session name flag: %v", err)
+	}
 }
 
 func initConfig() {
@@ -53,12 +142,30 @@ func initConfig() {
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C or SIGTERM cancels the running command so it can stop
+	// in-flight work and clean up; a second signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		log.Error("Command execution failed: %v", err)
 		os.Exit(1)
 	}
 }
 
+// commandContext returns the context cmd runs under, which is cancelled on
+// Ctrl-C, or a background context when cmd was not started by Execute.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
 func RootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "bcp [source] [destination]",
@@ -73,7 +180,14 @@ Examples:
   bcp ./my-files i-1234567890abcdef0:/home/ec2-user/files --bucket my-bucket
 
   # Copy FROM remote instance
-  bcp i-1234567890abcdef0:/home/ec2-user/files ./my-files --bucket my-bucket`,
+  bcp i-1234567890abcdef0:/home/ec2-user/files ./my-files --bucket my-bucket
+
+  # Name the instance by its Name tag, host name or private IP address
+  bcp ./my-files name:web-01:/home/ec2-user/files --bucket my-bucket
+
+  # Copy TO every instance with a tag, or to a list of instances
+  bcp ./app.conf tag:Role=web:/etc/app/app.conf --bucket my-bucket
+  bcp ./app.conf i-1234567890abcdef0,i-0fedcba9876543210:/etc/app/app.conf --bucket my-bucket`,
 		Args:              cobra.ExactArgs(2),
 		ValidArgsFunction: argsCompletion,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -86,26 +200,21 @@ Examples:
 			var isDirectory bool
 			var err error
 
-			// Determine transfer direction based on which argument contains instance ID
+			// Determine transfer direction based on which argument names an instance
 			switch {
-			case strings.Contains(arg0, ":"):
-				parts := strings.SplitN(arg0, ":", 2)
-				if len(parts) == 2 && strings.HasPrefix(parts[0], "i-") {
-					// FROM remote: i-xxx:/remote/path -> /local/path
-					direction = model.FromRemote
-					ssmInstanceID, source, err = validation.ValidateSSMPath(arg0)
-					if err != nil {
-						return fmt.Errorf("invalid SSM path: %w", err)
-					}
-					destination = arg1
-					if err := validation.ValidateDestinationPath(destination); err != nil {
-						return fmt.Errorf("invalid destination path: %w", err)
-					}
-					isDirectory = false // Will be determined on remote
-				} else {
-					return fmt.Errorf("invalid argument format")
+			case validation.IsRemotePath(arg0):
+				// FROM remote: i-xxx:/remote/path -> /local/path
+				direction = model.FromRemote
+				ssmInstanceID, source, err = validation.ValidateSSMPath(arg0)
+				if err != nil {
+					return fmt.Errorf("invalid SSM path: %w", err)
 				}
-			case strings.Contains(arg1, ":"):
+				destination = arg1
+				if err := validation.ValidateDestinationPath(destination); err != nil {
+					return fmt.Errorf("invalid destination path: %w", err)
+				}
+				isDirectory = false // Will be determined on remote
+			case validation.IsRemotePath(arg1):
 				// TO remote: /local/path -> i-xxx:/remote/path
 				direction = model.ToRemote
 				isDirectory, err = validation.ValidateSourcePath(arg0)
@@ -121,30 +230,87 @@ Examples:
 				return fmt.Errorf("invalid arguments: expected format 'source i-xxx:destination' or 'i-xxx:source destination'")
 			}
 
-			bucketName := bucket
-			if bucketName == "" {
-				bucketName = config.GetBucket()
+			var bucketName string
+			if ephemeralBucket {
+				if cmd.Flags().Changed("bucket") {
+					return fmt.Errorf("--bucket and --ephemeral-bucket cannot be used together")
+				}
+			} else {
+				bucketName = bucket
+				if bucketName == "" {
+					bucketName = config.GetBucket()
+				}
+				if bucketName == "" {
+					return fmt.Errorf("bucket name is required (use --bucket flag, set in config, or use --ephemeral-bucket)")
+				}
+
+				if err := validation.ValidateBucketName(bucketName); err != nil {
+					return fmt.Errorf("invalid bucket name: %w", err)
+				}
+			}
+
+			if err := validation.ValidateRemoteTransport(string(config.RemoteTransport)); err != nil {
+				return fmt.Errorf("invalid remote transport: %w", err)
+			}
+
+			if err := validation.ValidateCommandTimeout(config.CommandTimeout); err != nil {
+				return fmt.Errorf("invalid command timeout: %w", err)
+			}
+
+			if err := validation.ValidateSSE(string(config.SSE), config.KMSKeyID); err != nil {
+				return fmt.Errorf("invalid encryption settings: %w", err)
 			}
-			if bucketName == "" {
-				return fmt.Errorf("bucket name is required (use --bucket flag or set in config)")
+
+			if config.ClientEncryption && direction == model.FromRemote {
+				return fmt.Errorf("--client-encryption is only supported for transfers to a remote instance")
 			}
 
-			if err := validation.ValidateBucketName(bucketName); err != nil {
-				return fmt.Errorf("invalid bucket name: %w", err)
+			var instanceIDs []string
+			switch {
+			case validation.IsFanOutTarget(ssmInstanceID):
+				if direction == model.FromRemote {
+					return fmt.Errorf("copying from several instances is not supported, name a single instance")
+				}
+				if ephemeralBucket {
+					return fmt.Errorf("--ephemeral-bucket cannot be used when copying to several instances")
+				}
+				if instanceIDs, err = resolveInstances(commandContext(cmd), ssmInstanceID); err != nil {
+					return err
+				}
+			case !validation.IsInstanceID(ssmInstanceID):
+				if ssmInstanceID, err = resolveInstance(commandContext(cmd), ssmInstanceID); err != nil {
+					return err
+				}
 			}
 
 			transferConfig := model.TransferConfig{
-				Source:        source,
-				SSMInstanceID: ssmInstanceID,
-				Destination:   destination,
-				BucketName:    bucketName,
-				MaxRetries:    config.MaxRetries,
-				RetryDelay:    config.RetryDelay,
-				IsDirectory:   isDirectory,
-				Direction:     direction,
+				Source:             source,
+				SSMInstanceID:      ssmInstanceID,
+				Destination:        destination,
+				BucketName:         bucketName,
+				MaxRetries:         config.MaxRetries,
+				RetryDelay:         config.RetryDelay,
+				Concurrency:        config.Concurrency,
+				PartSize:           config.PartSize,
+				MultipartThreshold: config.MultipartThreshold,
+				IsDirectory:        isDirectory,
+				Direction:          direction,
+				RemoteTransport:    config.RemoteTransport,
+				CommandTimeout:     config.CommandTimeout,
+				KeepStaged:         config.KeepStaged,
+				SSE:                config.SSE,
+				KMSKeyID:           config.KMSKeyID,
+				ClientEncryption:   config.ClientEncryption,
+				S3Endpoint:         config.GetS3Endpoint(),
+				EphemeralBucket:    ephemeralBucket,
 			}
 
-			if err := transfer.Execute(transferConfig); err != nil {
+			if len(instanceIDs) > 0 {
+				transferConfig.InstanceIDs = instanceIDs
+				return executeFanOut(commandContext(cmd), transferConfig)
+			}
+
+			if err := transfer.Execute(commandContext(cmd), transferConfig); err != nil {
 				return fmt.Errorf("transfer failed: %w", err)
 			}
 
@@ -157,6 +323,65 @@ Examples:
 
 var rootCmd = RootCmd()
 
+// resolveInstance returns the ID of the instance target names by its Name
+// tag, host name or IP address.
+func resolveInstance(ctx context.Context, target string) (string, error) {
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
+	if err != nil {
+		return "", err
+	}
+
+	instanceID, err := transfer.ResolveInstance(ctx, clients.EC2(), clients.SSM(), target)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve instance: %w", err)
+	}
+	log.Info("Using instance %s for %s", instanceID, target)
+	return instanceID, nil
+}
+
+// resolveInstances returns the IDs of the instances a fan-out target
+// names by tag or as a comma-separated list.
+func resolveInstances(ctx context.Context, target string) ([]string, error) {
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	instanceIDs, err := transfer.ResolveInstances(ctx, clients.EC2(), clients.SSM(), target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve instances: %w", err)
+	}
+	log.Info("Copying to %d instance(s) for %s", len(instanceIDs), target)
+	return instanceIDs, nil
+}
+
+// executeFanOut copies to several instances at once and prints how the
+// transfer went on each of them, failing if it failed on any.
+func executeFanOut(ctx context.Context, transferConfig model.TransferConfig) error {
+	results, err := transfer.ExecuteFanOut(ctx, transferConfig)
+	if err != nil {
+		return fmt.Errorf("transfer failed: %w", err)
+	}
+
+	var failed int
+	fmt.Println("\nInstance ID          Result")
+	fmt.Println("==================== ================================")
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			failed++
+			status = "failed: " + result.Err.Error()
+		}
+		fmt.Printf("%-20s %s\n", result.InstanceID, status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("transfer failed on %d of %d instance(s)", failed, len(results))
+	}
+	log.Info("File transfer completed successfully on %d instance(s)!", len(results))
+	return nil
+}
+
 func bucketCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	buckets, err := completion.GetBucketNames()
 	if err != nil {
@@ -173,6 +398,14 @@ func bucketCompletion(cmd *cobra.Command, args []string, toComplete string) ([]s
 	return matches, cobra.ShellCompDirectiveNoFileComp
 }
 
+func remoteTransportCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{
+		string(model.RemoteTransportAuto) + "\tuse the AWS CLI if installed, otherwise presigned URLs",
+		string(model.RemoteTransportAWSCLI) + "\trequire the AWS CLI on the instance",
+		string(model.RemoteTransportPresigned) + "\tuse curl or wget with presigned URLs",
+	}, cobra.ShellCompDirectiveNoFileComp
+}
+
 func instanceCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	instances, err := completion.GetInstanceIDs()
 	if err != nil {
@@ -192,40 +425,50 @@ func instanceCompletion(cmd *cobra.Command, args []string, toComplete string) ([
 
 func argsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	if len(args) == 0 {
+		// A remote source starts with an EC2 (i-) or hybrid (mi-) instance ID
+		if strings.HasPrefix(toComplete, "i-") || strings.HasPrefix(toComplete, "mi-") {
+			return remoteArgCompletion(toComplete)
+		}
 		return nil, cobra.ShellCompDirectiveDefault
 	}
 
 	if len(args) == 1 {
-		if strings.Contains(toComplete, ":") {
-			parts := strings.Split(toComplete, ":")
-			if len(parts) == 2 {
-				instanceID := parts[0]
-				commonPaths := []string{
-					instanceID + ":/tmp/",
-					instanceID + ":/home/ec2-user/",
-					instanceID + ":/opt/",
-					instanceID + ":/usr/local/bin/",
-					instanceID + ":/var/tmp/",
-				}
-				return commonPaths, cobra.ShellCompDirectiveNoSpace
-			}
-		}
+		return remoteArgCompletion(toComplete)
+	}
 
-		instances, err := completion.GetInstanceIDs()
-		if err != nil {
-			return nil, cobra.ShellCompDirectiveError
-		}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
 
-		var matches []string
-		for _, instance := range instances {
-			instanceID := strings.Split(instance, "\t")[0]
-			if strings.HasPrefix(instanceID, toComplete) {
-				matches = append(matches, instanceID+":")
+// remoteArgCompletion completes an instance:path argument, suggesting
+// managed instance IDs until the colon and common paths after it.
+func remoteArgCompletion(toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.Contains(toComplete, ":") {
+		parts := strings.Split(toComplete, ":")
+		if len(parts) == 2 {
+			instanceID := parts[0]
+			commonPaths := []string{
+				instanceID + ":/tmp/",
+				instanceID + ":/home/ec2-user/",
+				instanceID + ":/opt/",
+				instanceID + ":/usr/local/bin/",
+				instanceID + ":/var/tmp/",
 			}
+			return commonPaths, cobra.ShellCompDirectiveNoSpace
 		}
+	}
 
-		return matches, cobra.ShellCompDirectiveNoSpace
+	instances, err := completion.GetInstanceIDs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
 	}
 
-	return nil, cobra.ShellCompDirectiveNoFileComp
+	var matches []string
+	for _, instance := range instances {
+		instanceID := strings.Split(instance, "\t")[0]
+		if strings.HasPrefix(instanceID, toComplete) {
+			matches = append(matches, instanceID+":")
+		}
+	}
+
+	return matches, cobra.ShellCompDirectiveNoSpace
 }
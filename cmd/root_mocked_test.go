@@ -263,7 +263,7 @@ func TestRootCmdInitialization(t *testing.T) {
 }
 
 func TestRootCmdHasRequiredFlags(t *testing.T) {
-	requiredFlags := []string{"bucket", "config", "verbose", "quiet"}
+	requiredFlags := []string{"bucket", "config", "verbose", "quiet", "parallel", "remote-transport"}
 
 	for _, flagName := range requiredFlags {
 		flag := rootCmd.PersistentFlags().Lookup(flagName)
@@ -282,6 +282,7 @@ func TestRootCmdFlagShorthands(t *testing.T) {
 		{"config", "c"},
 		{"verbose", "v"},
 		{"quiet", "q"},
+		{"parallel", "p"},
 	}
 
 	for _, tt := range tests {
@@ -433,3 +434,22 @@ func TestVerboseAndQuietFlags_Exclusive(t *testing.T) {
 		t.Error("Expected both verbose and quiet to default to false")
 	}
 }
+
+func TestArgsCompletion_FirstArg_HybridInstance(t *testing.T) {
+	cmd := RootCmd()
+
+	// A remote source with a hybrid instance ID should suggest paths
+	completions, directive := argsCompletion(cmd, []string{}, "mi-0123456789abcdef0:")
+
+	if directive != cobra.ShellCompDirectiveNoSpace {
+		t.Errorf("Expected NoSpace directive, got %v", directive)
+	}
+	if len(completions) == 0 {
+		t.Fatal("Expected common path completions")
+	}
+	for _, comp := range completions {
+		if !strings.HasPrefix(comp, "mi-0123456789abcdef0:") {
+			t.Errorf("Completion %q doesn't start with instance ID", comp)
+		}
+	}
+}
@@ -25,7 +25,10 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/spf13/cobra"
 )
 
 func TestRootCmd(t *testing.T) {
@@ -181,10 +184,24 @@ func TestRootCmdValidation(t *testing.T) {
 		{
 			name:          "invalid instance ID",
 			sourceDir:     testFile,
-			ssmPath:       "invalid:/tmp",
+			ssmPath:       "i-123:/tmp",
 			bucket:        "test-bucket",
 			wantErrSubstr: "invalid SSM path",
 		},
+		{
+			name:          "invalid tag target",
+			sourceDir:     testFile,
+			ssmPath:       "tag:Role:/tmp",
+			bucket:        "test-bucket",
+			wantErrSubstr: "invalid SSM path",
+		},
+		{
+			name:          "fan-out from remote",
+			sourceDir:     "tag:Role=web:/var/log/app.log",
+			ssmPath:       tmpDir,
+			bucket:        "test-bucket",
+			wantErrSubstr: "copying from several instances is not supported",
+		},
 		{
 			name:          "missing bucket",
 			sourceDir:     testFile,
@@ -244,6 +261,48 @@ func TestRootCmdFlagDefaults(t *testing.T) {
 	if quietFlag.DefValue != "false" {
 		t.Errorf("quiet flag default = %v, want 'false'", quietFlag.DefValue)
 	}
+
+	ephemeralFlag := rootCmd.PersistentFlags().Lookup("ephemeral-bucket")
+	if ephemeralFlag == nil || ephemeralFlag.DefValue != "false" {
+		t.Errorf("ephemeral-bucket flag = %v, want a flag defaulting to 'false'", ephemeralFlag)
+	}
+
+	clientEncryptionFlag := rootCmd.PersistentFlags().Lookup("client-encryption")
+	if clientEncryptionFlag == nil || clientEncryptionFlag.DefValue != "false" {
+		t.Errorf("client-encryption flag = %v, want a flag defaulting to 'false'", clientEncryptionFlag)
+	}
+
+	remoteTransportFlag := rootCmd.PersistentFlags().Lookup("remote-transport")
+	if remoteTransportFlag.DefValue != "auto" {
+		t.Errorf("remote-transport flag default = %v, want 'auto'", remoteTransportFlag.DefValue)
+	}
+
+	for _, name := range []string{"profile", "region", "role-arn", "s3-role-arn", "external-id", "session-name"} {
+		flag := rootCmd.PersistentFlags().Lookup(name)
+		if flag == nil {
+			t.Fatalf("%s flag not registered", name)
+		}
+		if flag.DefValue != "" {
+			t.Errorf("%s flag default = %v, want empty string", name, flag.DefValue)
+		}
+	}
+}
+
+func TestRemoteTransportCompletion(t *testing.T) {
+	completions, directive := remoteTransportCompletion(rootCmd, []string{}, "")
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v, want ShellCompDirectiveNoFileComp", directive)
+	}
+
+	want := []string{"auto", "awscli", "presigned"}
+	if len(completions) != len(want) {
+		t.Fatalf("completions = %v, want %v", completions, want)
+	}
+	for i, mode := range want {
+		if !strings.HasPrefix(completions[i], mode+"\t") {
+			t.Errorf("completions[%d] = %q, want %q", i, completions[i], mode)
+		}
+	}
 }
 
 func TestBucketCompletion(t *testing.T) {
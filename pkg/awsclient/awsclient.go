@@ -0,0 +1,229 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package awsclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/cowdogmoo/bcp/pkg/config"
+	"github.com/cowdogmoo/bcp/pkg/validation"
+)
+
+// DefaultRegion is used when neither bcp's configuration nor the AWS
+// environment names a region.
+const DefaultRegion = "us-east-1"
+
+// DefaultSessionName identifies bcp in CloudTrail when a role is assumed
+// without an explicit session name.
+const DefaultSessionName = "bcp"
+
+// Options selects the credentials and region AWS clients are built with.
+// Empty fields fall back to the AWS SDK's default resolution through
+// environment variables and the shared config files.
+type Options struct {
+	Profile string
+	Region  string
+	// RoleARN is assumed for every call, such as SSM calls to instances
+	// in a workload account.
+	RoleARN string
+	// S3RoleARN is assumed for S3 calls instead of RoleARN, for staging
+	// buckets that live in another account.
+	S3RoleARN   string
+	ExternalID  string
+	SessionName string
+	// S3Endpoint and SSMEndpoint replace the AWS endpoints of those
+	// services, such as with a MinIO or LocalStack server.
+	S3Endpoint  string
+	SSMEndpoint string
+	// S3ForcePathStyle addresses buckets in the path of S3 URLs instead
+	// of their host name, which most S3-compatible servers require.
+	S3ForcePathStyle bool
+}
+
+// DefaultOptions returns the AWS settings from bcp's configuration, which
+// the matching root flags override.
+func DefaultOptions() Options {
+	return Options{
+		Profile:     config.GetProfile(),
+		Region:      config.GetRegion(),
+		RoleARN:     config.GetRoleARN(),
+		S3RoleARN:   config.GetS3RoleARN(),
+		ExternalID:  config.GetExternalID(),
+		SessionName: config.GetSessionName(),
+
+		S3Endpoint:       config.GetS3Endpoint(),
+		SSMEndpoint:      config.GetSSMEndpoint(),
+		S3ForcePathStyle: config.GetS3ForcePathStyle(),
+	}
+}
+
+// newSTSClient returns the client roles are assumed with. Tests replace
+// it to avoid calling STS.
+var newSTSClient = func(cfg aws.Config) stscreds.AssumeRoleAPIClient {
+	return sts.NewFromConfig(cfg)
+}
+
+// LoadConfig loads the AWS configuration for opts.
+func LoadConfig(ctx context.Context, opts Options) (aws.Config, error) {
+	var loadOptions []func(*awsconfig.LoadOptions) error
+	if opts.Profile != "" {
+		loadOptions = append(loadOptions, awsconfig.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.Region != "" {
+		loadOptions = append(loadOptions, awsconfig.WithRegion(opts.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+
+	return cfg, nil
+}
+
+// assumeRole returns a copy of cfg whose credentials come from assuming
+// roleARN with cfg's credentials. The temporary credentials are cached
+// and refreshed before they expire, so one factory can serve a transfer
+// of any length.
+func assumeRole(cfg aws.Config, roleARN string, opts Options) aws.Config {
+	sessionName := opts.SessionName
+	if sessionName == "" {
+		sessionName = DefaultSessionName
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(newSTSClient(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if opts.ExternalID != "" {
+			o.ExternalID = aws.String(opts.ExternalID)
+		}
+	})
+
+	assumed := cfg.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(provider)
+	return assumed
+}
+
+// Factory builds AWS service clients from a single loaded configuration,
+// so every client in a run shares the same profile, region and cached
+// credentials.
+type Factory struct {
+	cfg   aws.Config
+	s3Cfg aws.Config
+	opts  Options
+}
+
+// New loads the AWS configuration for opts and returns a factory for it,
+// assuming the configured roles.
+func New(ctx context.Context, opts Options) (*Factory, error) {
+	for _, arn := range []string{opts.RoleARN, opts.S3RoleARN} {
+		if arn == "" {
+			continue
+		}
+		if err := validation.ValidateRoleARN(arn); err != nil {
+			return nil, err
+		}
+	}
+	for _, endpoint := range []string{opts.S3Endpoint, opts.SSMEndpoint} {
+		if endpoint == "" {
+			continue
+		}
+		if err := validation.ValidateEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	base, err := LoadConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := base
+	if opts.RoleARN != "" {
+		cfg = assumeRole(base, opts.RoleARN, opts)
+	}
+
+	s3Cfg := cfg
+	if opts.S3RoleARN != "" {
+		s3Cfg = assumeRole(base, opts.S3RoleARN, opts)
+	}
+
+	return &Factory{cfg: cfg, s3Cfg: s3Cfg, opts: opts}, nil
+}
+
+// Config returns the AWS configuration non-S3 clients are built from.
+func (f *Factory) Config() aws.Config {
+	return f.cfg
+}
+
+// Region returns the region clients are built for.
+func (f *Factory) Region() string {
+	return f.cfg.Region
+}
+
+// S3 returns a new S3 client, using the S3 role and endpoint when they
+// are configured.
+func (f *Factory) S3() *s3.Client {
+	return s3.NewFromConfig(f.s3Cfg, f.s3Options)
+}
+
+// S3ForRegion returns a new S3 client like S3 but for region, such as the
+// region a staging bucket lives in.
+func (f *Factory) S3ForRegion(region string) *s3.Client {
+	return s3.NewFromConfig(f.s3Cfg, f.s3Options, func(o *s3.Options) {
+		o.Region = region
+	})
+}
+
+// s3Options applies the configured S3 endpoint settings to o.
+func (f *Factory) s3Options(o *s3.Options) {
+	if f.opts.S3Endpoint != "" {
+		o.BaseEndpoint = aws.String(f.opts.S3Endpoint)
+	}
+	o.UsePathStyle = f.opts.S3ForcePathStyle
+}
+
+// SSM returns a new SSM client, using the SSM endpoint when one is
+// configured.
+func (f *Factory) SSM() *ssm.Client {
+	return ssm.NewFromConfig(f.cfg, func(o *ssm.Options) {
+		if f.opts.SSMEndpoint != "" {
+			o.BaseEndpoint = aws.String(f.opts.SSMEndpoint)
+		}
+	})
+}
+
+// EC2 returns a new EC2 client.
+func (f *Factory) EC2() *ec2.Client {
+	return ec2.NewFromConfig(f.cfg)
+}
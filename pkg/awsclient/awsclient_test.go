@@ -0,0 +1,335 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package awsclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/cowdogmoo/bcp/pkg/config"
+)
+
+// isolateAWSEnv points the AWS SDK at a shared config file with the given
+// contents and clears environment variables that would override it.
+func isolateAWSEnv(t *testing.T, sharedConfig string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(sharedConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", path)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	for _, name := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		t.Setenv(name, "")
+	}
+}
+
+const testSharedConfig = `[default]
+region = us-west-1
+
+[profile workload]
+region = eu-west-1
+`
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		sharedConfig string
+		opts         Options
+		wantRegion   string
+		wantErr      bool
+	}{
+		{
+			name:         "default profile",
+			sharedConfig: testSharedConfig,
+			wantRegion:   "us-west-1",
+		},
+		{
+			name:         "named profile region",
+			sharedConfig: testSharedConfig,
+			opts:         Options{Profile: "workload"},
+			wantRegion:   "eu-west-1",
+		},
+		{
+			name:         "explicit region wins over profile",
+			sharedConfig: testSharedConfig,
+			opts:         Options{Profile: "workload", Region: "ap-southeast-2"},
+			wantRegion:   "ap-southeast-2",
+		},
+		{
+			name:       "falls back to default region",
+			wantRegion: DefaultRegion,
+		},
+		{
+			name:         "unknown profile",
+			sharedConfig: testSharedConfig,
+			opts:         Options{Profile: "missing"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSEnv(t, tt.sharedConfig)
+
+			cfg, err := LoadConfig(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.Region != tt.wantRegion {
+				t.Errorf("LoadConfig() region = %q, want %q", cfg.Region, tt.wantRegion)
+			}
+		})
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	oldConfig := config.GlobalConfig
+	defer func() { config.GlobalConfig = oldConfig }()
+
+	config.GlobalConfig.AWS.Profile = "workload"
+	config.GlobalConfig.AWS.Region = "eu-west-1"
+	config.GlobalConfig.AWS.RoleARN = testRoleARN
+	config.GlobalConfig.AWS.S3RoleARN = testS3RoleARN
+	config.GlobalConfig.AWS.ExternalID = "external"
+	config.GlobalConfig.AWS.SessionName = "deploy"
+	config.GlobalConfig.AWS.S3Endpoint = "http://localhost:9000"
+	config.GlobalConfig.AWS.S3ForcePathStyle = true
+	config.GlobalConfig.AWS.SSMEndpoint = "http://localhost:4566"
+
+	want := Options{
+		Profile:     "workload",
+		Region:      "eu-west-1",
+		RoleARN:     testRoleARN,
+		S3RoleARN:   testS3RoleARN,
+		ExternalID:  "external",
+		SessionName: "deploy",
+
+		S3Endpoint:       "http://localhost:9000",
+		SSMEndpoint:      "http://localhost:4566",
+		S3ForcePathStyle: true,
+	}
+	if opts := DefaultOptions(); opts != want {
+		t.Errorf("DefaultOptions() = %+v, want %+v", opts, want)
+	}
+}
+
+func TestFactory(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+
+	clients, err := New(context.Background(), Options{Profile: "workload"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if clients.Region() != "eu-west-1" {
+		t.Errorf("Region() = %q, want eu-west-1", clients.Region())
+	}
+	if got := clients.S3().Options().Region; got != "eu-west-1" {
+		t.Errorf("S3() region = %q, want eu-west-1", got)
+	}
+	if got := clients.SSM().Options().Region; got != "eu-west-1" {
+		t.Errorf("SSM() region = %q, want eu-west-1", got)
+	}
+	if got := clients.EC2().Options().Region; got != "eu-west-1" {
+		t.Errorf("EC2() region = %q, want eu-west-1", got)
+	}
+}
+
+// mockSTSClient records AssumeRole calls and returns credentials named
+// after the assumed role.
+type mockSTSClient struct {
+	calls []*sts.AssumeRoleInput
+}
+
+func (m *mockSTSClient) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	m.calls = append(m.calls, params)
+	return &sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKID-" + aws.ToString(params.RoleArn)),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+// useMockSTS replaces the STS client used to assume roles for the test.
+func useMockSTS(t *testing.T) *mockSTSClient {
+	t.Helper()
+
+	mock := &mockSTSClient{}
+	oldNewSTSClient := newSTSClient
+	newSTSClient = func(cfg aws.Config) stscreds.AssumeRoleAPIClient { return mock }
+	t.Cleanup(func() { newSTSClient = oldNewSTSClient })
+	return mock
+}
+
+const (
+	testRoleARN   = "arn:aws:iam::111111111111:role/bcp"
+	testS3RoleARN = "arn:aws:iam::222222222222:role/bcp-staging"
+)
+
+func TestFactory_AssumeRole(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+	t.Setenv("AWS_ACCESS_KEY_ID", "base")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "base")
+	mock := useMockSTS(t)
+
+	clients, err := New(context.Background(), Options{RoleARN: testRoleARN, ExternalID: "external"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Credentials are retrieved once and shared by every client
+	for i := 0; i < 3; i++ {
+		creds, err := clients.SSM().Options().Credentials.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve() error = %v", err)
+		}
+		if creds.AccessKeyID != "AKID-"+testRoleARN {
+			t.Errorf("SSM credentials = %q, want the assumed role's", creds.AccessKeyID)
+		}
+	}
+	creds, err := clients.S3().Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if creds.AccessKeyID != "AKID-"+testRoleARN {
+		t.Errorf("S3 credentials = %q, want the role's when no S3 role is set", creds.AccessKeyID)
+	}
+
+	if len(mock.calls) != 1 {
+		t.Fatalf("AssumeRole called %d times, want 1", len(mock.calls))
+	}
+	call := mock.calls[0]
+	if aws.ToString(call.ExternalId) != "external" {
+		t.Errorf("ExternalId = %q, want external", aws.ToString(call.ExternalId))
+	}
+	if aws.ToString(call.RoleSessionName) != DefaultSessionName {
+		t.Errorf("RoleSessionName = %q, want %q", aws.ToString(call.RoleSessionName), DefaultSessionName)
+	}
+}
+
+func TestFactory_SeparateS3Role(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+	t.Setenv("AWS_ACCESS_KEY_ID", "base")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "base")
+	useMockSTS(t)
+
+	clients, err := New(context.Background(), Options{RoleARN: testRoleARN, S3RoleARN: testS3RoleARN, SessionName: "deploy"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ssmCreds, err := clients.SSM().Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	s3Creds, err := clients.S3().Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+
+	if ssmCreds.AccessKeyID != "AKID-"+testRoleARN {
+		t.Errorf("SSM credentials = %q, want %s", ssmCreds.AccessKeyID, testRoleARN)
+	}
+	if s3Creds.AccessKeyID != "AKID-"+testS3RoleARN {
+		t.Errorf("S3 credentials = %q, want %s", s3Creds.AccessKeyID, testS3RoleARN)
+	}
+}
+
+func TestFactory_InvalidRoleARN(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+
+	if _, err := New(context.Background(), Options{S3RoleARN: "bcp"}); err == nil {
+		t.Error("New() with an invalid role ARN should fail")
+	}
+}
+
+func TestFactory_Endpoints(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+
+	clients, err := New(context.Background(), Options{
+		S3Endpoint:       "http://localhost:9000",
+		S3ForcePathStyle: true,
+		SSMEndpoint:      "http://localhost:4566",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	s3Options := clients.S3().Options()
+	if got := aws.ToString(s3Options.BaseEndpoint); got != "http://localhost:9000" {
+		t.Errorf("S3() endpoint = %q, want http://localhost:9000", got)
+	}
+	if !s3Options.UsePathStyle {
+		t.Error("S3() does not use path-style addressing")
+	}
+	if got := aws.ToString(clients.SSM().Options().BaseEndpoint); got != "http://localhost:4566" {
+		t.Errorf("SSM() endpoint = %q, want http://localhost:4566", got)
+	}
+	if clients.EC2().Options().BaseEndpoint != nil {
+		t.Error("EC2() should keep the AWS endpoint")
+	}
+
+	regional := clients.S3ForRegion("ap-southeast-2").Options()
+	if regional.Region != "ap-southeast-2" {
+		t.Errorf("S3ForRegion() region = %q, want ap-southeast-2", regional.Region)
+	}
+	if aws.ToString(regional.BaseEndpoint) != "http://localhost:9000" || !regional.UsePathStyle {
+		t.Error("S3ForRegion() should keep the configured endpoint settings")
+	}
+}
+
+func TestFactory_DefaultEndpoints(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+
+	clients, err := New(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if clients.S3().Options().BaseEndpoint != nil || clients.SSM().Options().BaseEndpoint != nil {
+		t.Error("Clients should use the AWS endpoints when none are configured")
+	}
+	if clients.S3().Options().UsePathStyle {
+		t.Error("S3() should use virtual-hosted addressing by default")
+	}
+}
+
+func TestFactory_InvalidEndpoint(t *testing.T) {
+	isolateAWSEnv(t, testSharedConfig)
+
+	if _, err := New(context.Background(), Options{S3Endpoint: "localhost:9000"}); err == nil {
+		t.Error("New() with an invalid endpoint should fail")
+	}
+}
@@ -26,19 +26,19 @@ import (
 	"context"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
 )
 
 func GetBucketNames() ([]string, error) {
 	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
 	if err != nil {
 		return nil, err
 	}
 
-	svc := s3.NewFromConfig(cfg)
+	svc := clients.S3()
 	result, err := svc.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
 		return nil, err
@@ -54,12 +54,12 @@ func GetBucketNames() ([]string, error) {
 
 func GetInstanceIDs() ([]string, error) {
 	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx)
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
 	if err != nil {
 		return nil, err
 	}
 
-	svc := ssm.NewFromConfig(cfg)
+	svc := clients.SSM()
 
 	input := &ssm.DescribeInstanceInformationInput{
 		MaxResults: aws.Int32(50),
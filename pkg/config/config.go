@@ -26,16 +26,31 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	log "github.com/cowdogmoo/bcp/pkg/logging"
 	"github.com/cowdogmoo/bcp/pkg/model"
 	"github.com/spf13/viper"
 )
 
+// minPartSizeMB is the smallest part size S3 accepts for every part of a
+// multipart upload except the last.
+const minPartSizeMB = 5
+
 var (
-	GlobalConfig model.Config
-	MaxRetries   = 3
-	RetryDelay   = 2
+	GlobalConfig       model.Config
+	MaxRetries         = 3
+	RetryDelay         = 2
+	Concurrency        = 4
+	PartSize           = int64(8 << 20)
+	MultipartThreshold = int64(8 << 20)
+	RemoteTransport    = model.RemoteTransportAuto
+	CommandTimeout     = 3600
+	KeepStaged         = false
+	SSE                = model.ServerSideEncryptionNone
+	KMSKeyID           = ""
+	ClientEncryption   = false
+	GCOlderThan        = 24 * time.Hour
 )
 
 func Init(cfgFile string) error {
@@ -84,12 +99,32 @@ func setDefaults() {
 	viper.SetDefault("log.format", "text")
 	viper.SetDefault("log.level", "info")
 
-	viper.SetDefault("aws.region", "us-east-1")
-	viper.SetDefault("aws.profile", "default")
+	// An empty region and profile defer to the AWS SDK's resolution through
+	// AWS_REGION, AWS_PROFILE and the shared config files
+	viper.SetDefault("aws.region", "")
+	viper.SetDefault("aws.profile", "")
 	viper.SetDefault("aws.bucket", "")
+	viper.SetDefault("aws.role_arn", "")
+	viper.SetDefault("aws.s3_role_arn", "")
+	viper.SetDefault("aws.external_id", "")
+	viper.SetDefault("aws.session_name", "")
+	viper.SetDefault("aws.s3_endpoint", "")
+	viper.SetDefault("aws.s3_force_path_style", false)
+	viper.SetDefault("aws.ssm_endpoint", "")
 
 	viper.SetDefault("transfer.max_retries", 3)
 	viper.SetDefault("transfer.retry_delay", 2)
+	viper.SetDefault("transfer.concurrency", 4)
+	viper.SetDefault("transfer.part_size", 8)
+	viper.SetDefault("transfer.multipart_threshold", 8)
+	viper.SetDefault("transfer.remote_transport", string(model.RemoteTransportAuto))
+	viper.SetDefault("transfer.command_timeout", 3600)
+	viper.SetDefault("transfer.keep_staged", false)
+	viper.SetDefault("transfer.sse", "")
+	viper.SetDefault("transfer.kms_key_id", "")
+	viper.SetDefault("transfer.client_encryption", false)
+
+	viper.SetDefault("gc.older_than", "24h")
 }
 
 func LoadConstants() {
@@ -102,6 +137,48 @@ func LoadConstants() {
 	if RetryDelay == 0 {
 		RetryDelay = 2
 	}
+
+	Concurrency = viper.GetInt("transfer.concurrency")
+	if Concurrency <= 0 {
+		Concurrency = 4
+	}
+
+	partSizeMB := viper.GetInt64("transfer.part_size")
+	if partSizeMB == 0 {
+		partSizeMB = 8
+	}
+	if partSizeMB < minPartSizeMB {
+		partSizeMB = minPartSizeMB
+	}
+	PartSize = partSizeMB << 20
+
+	// Zero disables multipart transfers, so the default only applies when
+	// the threshold is not set at all
+	thresholdMB := int64(8)
+	if viper.IsSet("transfer.multipart_threshold") {
+		thresholdMB = max(viper.GetInt64("transfer.multipart_threshold"), 0)
+	}
+	MultipartThreshold = thresholdMB << 20
+
+	RemoteTransport = model.RemoteTransport(viper.GetString("transfer.remote_transport"))
+	if RemoteTransport == "" {
+		RemoteTransport = model.RemoteTransportAuto
+	}
+
+	CommandTimeout = viper.GetInt("transfer.command_timeout")
+	if CommandTimeout == 0 {
+		CommandTimeout = 3600
+	}
+
+	KeepStaged = viper.GetBool("transfer.keep_staged")
+	SSE = model.ServerSideEncryption(viper.GetString("transfer.sse"))
+	KMSKeyID = viper.GetString("transfer.kms_key_id")
+	ClientEncryption = viper.GetBool("transfer.client_encryption")
+
+	GCOlderThan = viper.GetDuration("gc.older_than")
+	if GCOlderThan <= 0 {
+		GCOlderThan = 24 * time.Hour
+	}
 }
 
 func GetBucket() string {
@@ -115,3 +192,31 @@ func GetRegion() string {
 func GetProfile() string {
 	return GlobalConfig.AWS.Profile
 }
+
+func GetRoleARN() string {
+	return GlobalConfig.AWS.RoleARN
+}
+
+func GetS3RoleARN() string {
+	return GlobalConfig.AWS.S3RoleARN
+}
+
+func GetExternalID() string {
+	return GlobalConfig.AWS.ExternalID
+}
+
+func GetSessionName() string {
+	return GlobalConfig.AWS.SessionName
+}
+
+func GetS3Endpoint() string {
+	return GlobalConfig.AWS.S3Endpoint
+}
+
+func GetS3ForcePathStyle() bool {
+	return GlobalConfig.AWS.S3ForcePathStyle
+}
+
+func GetSSMEndpoint() string {
+	return GlobalConfig.AWS.SSMEndpoint
+}
@@ -26,7 +26,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/cowdogmoo/bcp/pkg/model"
 	"github.com/spf13/viper"
 )
 
@@ -130,11 +132,20 @@ func TestSetDefaults(t *testing.T) {
 	}{
 		{"log format default", "log.format", "text"},
 		{"log level default", "log.level", "info"},
-		{"aws region default", "aws.region", "us-east-1"},
-		{"aws profile default", "aws.profile", "default"},
+		{"aws region default", "aws.region", ""},
+		{"aws profile default", "aws.profile", ""},
 		{"aws bucket default", "aws.bucket", ""},
 		{"max retries default", "transfer.max_retries", 3},
 		{"retry delay default", "transfer.retry_delay", 2},
+		{"concurrency default", "transfer.concurrency", 4},
+		{"part size default", "transfer.part_size", 8},
+		{"multipart threshold default", "transfer.multipart_threshold", 8},
+		{"remote transport default", "transfer.remote_transport", "auto"},
+		{"command timeout default", "transfer.command_timeout", 3600},
+		{"keep staged default", "transfer.keep_staged", false},
+		{"sse default", "transfer.sse", ""},
+		{"kms key ID default", "transfer.kms_key_id", ""},
+		{"gc older than default", "gc.older_than", "24h"},
 	}
 
 	for _, tt := range tests {
@@ -189,6 +200,147 @@ func TestLoadConstants(t *testing.T) {
 	}
 }
 
+func TestLoadConstantsConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		expected    int
+	}{
+		{"configured value", 16, 16},
+		{"zero uses default", 0, 4},
+		{"negative uses default", -2, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("transfer.concurrency", tt.concurrency)
+
+			LoadConstants()
+
+			if Concurrency != tt.expected {
+				t.Errorf("Concurrency = %d, want %d", Concurrency, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConstantsMultipart(t *testing.T) {
+	tests := []struct {
+		name              string
+		partSize          int64
+		threshold         int64
+		expectedPartSize  int64
+		expectedThreshold int64
+	}{
+		{"configured values", 16, 64, 16 << 20, 64 << 20},
+		{"zero part size uses the default", 0, 8, 8 << 20, 8 << 20},
+		{"zero threshold disables multipart", 8, 0, 8 << 20, 0},
+		{"negative threshold disables multipart", 8, -1, 8 << 20, 0},
+		{"part size below S3 minimum", 1, 8, 5 << 20, 8 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("transfer.part_size", tt.partSize)
+			viper.Set("transfer.multipart_threshold", tt.threshold)
+
+			LoadConstants()
+
+			if PartSize != tt.expectedPartSize {
+				t.Errorf("PartSize = %d, want %d", PartSize, tt.expectedPartSize)
+			}
+			if MultipartThreshold != tt.expectedThreshold {
+				t.Errorf("MultipartThreshold = %d, want %d", MultipartThreshold, tt.expectedThreshold)
+			}
+		})
+	}
+}
+
+func TestLoadConstantsMultipartThresholdUnset(t *testing.T) {
+	viper.Reset()
+
+	LoadConstants()
+
+	if MultipartThreshold != 8<<20 {
+		t.Errorf("MultipartThreshold = %d, want the 8 MiB default", MultipartThreshold)
+	}
+}
+
+func TestLoadConstantsRemoteTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected model.RemoteTransport
+	}{
+		{"configured value", "presigned", model.RemoteTransportPresigned},
+		{"empty uses auto", "", model.RemoteTransportAuto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("transfer.remote_transport", tt.value)
+
+			LoadConstants()
+
+			if RemoteTransport != tt.expected {
+				t.Errorf("RemoteTransport = %q, want %q", RemoteTransport, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConstantsCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int
+		expected int
+	}{
+		{"configured value", 7200, 7200},
+		{"zero uses default", 0, 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("transfer.command_timeout", tt.value)
+
+			LoadConstants()
+
+			if CommandTimeout != tt.expected {
+				t.Errorf("CommandTimeout = %d, want %d", CommandTimeout, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConstantsGCOlderThan(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{"configured value", "168h", 7 * 24 * time.Hour},
+		{"empty uses default", "", 24 * time.Hour},
+		{"invalid uses default", "soon", 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("gc.older_than", tt.value)
+
+			LoadConstants()
+
+			if GCOlderThan != tt.expected {
+				t.Errorf("GCOlderThan = %v, want %v", GCOlderThan, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetters(t *testing.T) {
 	viper.Reset()
 
@@ -196,6 +348,10 @@ func TestGetters(t *testing.T) {
 	GlobalConfig.AWS.Bucket = "test-bucket"
 	GlobalConfig.AWS.Region = "us-west-2"
 	GlobalConfig.AWS.Profile = "test-profile"
+	GlobalConfig.AWS.RoleARN = "arn:aws:iam::111111111111:role/bcp"
+	GlobalConfig.AWS.S3RoleARN = "arn:aws:iam::222222222222:role/bcp-staging"
+	GlobalConfig.AWS.ExternalID = "external"
+	GlobalConfig.AWS.SessionName = "deploy"
 
 	tests := []struct {
 		name     string
@@ -205,6 +361,10 @@ func TestGetters(t *testing.T) {
 		{"GetBucket", GetBucket, "test-bucket"},
 		{"GetRegion", GetRegion, "us-west-2"},
 		{"GetProfile", GetProfile, "test-profile"},
+		{"GetRoleARN", GetRoleARN, "arn:aws:iam::111111111111:role/bcp"},
+		{"GetS3RoleARN", GetS3RoleARN, "arn:aws:iam::222222222222:role/bcp-staging"},
+		{"GetExternalID", GetExternalID, "external"},
+		{"GetSessionName", GetSessionName, "deploy"},
 	}
 
 	for _, tt := range tests {
@@ -260,3 +420,58 @@ transfer:
 		t.Errorf("GlobalConfig.AWS.Bucket = %v, want %v", GlobalConfig.AWS.Bucket, "config-bucket")
 	}
 }
+
+func TestInitReadsAssumeRoleSettings(t *testing.T) {
+	viper.Reset()
+
+	configContent := `
+aws:
+  role_arn: arn:aws:iam::111111111111:role/bcp
+  s3_role_arn: arn:aws:iam::222222222222:role/bcp-staging
+  external_id: external
+  session_name: deploy
+`
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	if err := Init(cfgPath); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	want := model.AWSConfig{
+		RoleARN:     "arn:aws:iam::111111111111:role/bcp",
+		S3RoleARN:   "arn:aws:iam::222222222222:role/bcp-staging",
+		ExternalID:  "external",
+		SessionName: "deploy",
+	}
+	got := GlobalConfig.AWS
+	if got.RoleARN != want.RoleARN || got.S3RoleARN != want.S3RoleARN || got.ExternalID != want.ExternalID || got.SessionName != want.SessionName {
+		t.Errorf("GlobalConfig.AWS = %+v, want assume role settings %+v", got, want)
+	}
+}
+
+func TestInitReadsTransferDefaults(t *testing.T) {
+	viper.Reset()
+
+	configContent := `
+transfer:
+  part_size: 16
+  multipart_threshold: 64
+  remote_transport: presigned
+`
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	if err := Init(cfgPath); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	got := GlobalConfig.Transfer
+	if got.PartSize != 16 || got.MultipartThreshold != 64 || got.RemoteTransport != "presigned" {
+		t.Errorf("GlobalConfig.Transfer = %+v, want the configured part size, threshold and transport", got)
+	}
+}
@@ -0,0 +1,506 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// Phase names a step of a transfer that is skipped when the transfer is
+// resumed after it has completed once.
+type Phase string
+
+const (
+	// PhaseUpload uploads the local source to the staging bucket.
+	PhaseUpload Phase = "upload"
+	// PhaseSelectTransport picks the tool the instance uses to reach S3.
+	PhaseSelectTransport Phase = "select_transport"
+	// PhaseRemoteDownload copies staged objects onto the instance.
+	PhaseRemoteDownload Phase = "remote_download"
+	// PhaseDetectSource determines whether the remote source is a directory.
+	PhaseDetectSource Phase = "detect_source"
+	// PhaseRemoteUpload copies the remote source into the staging bucket.
+	PhaseRemoteUpload Phase = "remote_upload"
+	// PhaseLocalDownload downloads staged objects to the local destination.
+	PhaseLocalDownload Phase = "local_download"
+)
+
+// Every save rewrites the whole journal, so the progress of individual
+// objects is saved in batches: once flushEvery updates are pending or
+// flushInterval has passed since the last save. Phases and values are
+// saved straight away, along with any pending progress.
+const (
+	flushEvery    = 64
+	flushInterval = 5 * time.Second
+)
+
+// Dir overrides the directory journals are stored in. When empty,
+// journals live in $HOME/.bcp/transfers.
+var Dir string
+
+// Object records the upload progress of a single staged object.
+type Object struct {
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"mod_time"`
+	UploadID string           `json:"upload_id,omitempty"`
+	PartSize int64            `json:"part_size,omitempty"`
+	Parts    map[int32]string `json:"parts,omitempty"`
+	Complete bool             `json:"complete"`
+}
+
+// Journal persists the progress of a transfer so an interrupted transfer
+// can pick up where it left off. A nil *Journal is valid and records
+// nothing, which lets callers journal optionally.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	// pending counts the progress updates made since savedAt
+	pending int
+	savedAt time.Time
+
+	ID        string               `json:"id"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Transfer  model.TransferConfig `json:"transfer"`
+	Phases    []Phase              `json:"completed_phases"`
+	Objects   map[string]*Object   `json:"objects"`
+	Values    map[string]string    `json:"values"`
+}
+
+// NewID returns a new transfer ID that sorts by creation time.
+func NewID() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return time.Now().UTC().Format("20060102t150405.000000000")
+	}
+	return time.Now().UTC().Format("20060102t150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// directory returns the directory journals are stored in.
+func directory() (string, error) {
+	if Dir != "" {
+		return Dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".bcp", "transfers"), nil
+}
+
+// pathFor returns the journal file path for id.
+func pathFor(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid transfer ID: %q", id)
+	}
+
+	dir, err := directory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// New creates and persists a journal for transferConfig. A transfer ID is
+// generated if transferConfig does not already have one.
+func New(transferConfig model.TransferConfig) (*Journal, error) {
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = NewID()
+	}
+
+	path, err := pathFor(transferConfig.TransferID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	j := &Journal{
+		path:      path,
+		ID:        transferConfig.TransferID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Transfer:  transferConfig,
+		Objects:   make(map[string]*Object),
+		Values:    make(map[string]string),
+	}
+
+	if err := j.Save(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Load reads the journal for the transfer with the given ID.
+func Load(id string) (*Journal, error) {
+	path, err := pathFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return loadFile(path)
+}
+
+// loadFile reads a journal from path.
+func loadFile(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no transfer journal found at %s", path)
+		}
+		return nil, fmt.Errorf("failed to read transfer journal: %w", err)
+	}
+
+	j := &Journal{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse transfer journal %s: %w", path, err)
+	}
+	j.path = path
+	if j.Objects == nil {
+		j.Objects = make(map[string]*Object)
+	}
+	if j.Values == nil {
+		j.Values = make(map[string]string)
+	}
+
+	return j, nil
+}
+
+// List returns all journals on disk, oldest first. Journals that cannot
+// be read are skipped with a warning so that one corrupt file does not
+// hide the others.
+func List() ([]*Journal, error) {
+	dir, err := directory()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transfer journals: %w", err)
+	}
+
+	journals := make([]*Journal, 0, len(paths))
+	for _, path := range paths {
+		j, err := loadFile(path)
+		if err != nil {
+			log.Warn("Skipping transfer journal: %v", err)
+			continue
+		}
+		journals = append(journals, j)
+	}
+
+	sort.Slice(journals, func(a, b int) bool {
+		return journals[a].CreatedAt.Before(journals[b].CreatedAt)
+	})
+
+	return journals, nil
+}
+
+// Save writes the journal to disk atomically.
+func (j *Journal) Save() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.saveLocked()
+}
+
+// Flush writes any progress that has not been saved yet to disk. Callers
+// flush at the end of each phase of a transfer, so that a failed phase
+// leaves all of its progress behind for resuming.
+func (j *Journal) Flush() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.pending == 0 {
+		return nil
+	}
+	return j.saveLocked()
+}
+
+// progressLocked records a progress update, saving the journal when the
+// batch of pending updates is full or due; j.mu must be held.
+func (j *Journal) progressLocked() error {
+	j.pending++
+	if j.pending < flushEvery && time.Since(j.savedAt) < flushInterval {
+		return nil
+	}
+	return j.saveLocked()
+}
+
+// saveLocked writes the journal to disk; j.mu must be held.
+func (j *Journal) saveLocked() error {
+	j.UpdatedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer journal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write transfer journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to write transfer journal: %w", err)
+	}
+
+	j.pending = 0
+	j.savedAt = time.Now()
+	return nil
+}
+
+// Remove deletes the journal from disk, typically once the transfer has
+// completed successfully.
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pending = 0
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove transfer journal: %w", err)
+	}
+	return nil
+}
+
+// PhaseDone reports whether phase has already completed.
+func (j *Journal) PhaseDone(phase Phase) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, done := range j.Phases {
+		if done == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkPhase records that phase completed.
+func (j *Journal) MarkPhase(phase Phase) error {
+	if j == nil || j.PhaseDone(phase) {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Phases = append(j.Phases, phase)
+	return j.saveLocked()
+}
+
+// Value returns a value previously stored with SetValue.
+func (j *Journal) Value(key string) string {
+	if j == nil {
+		return ""
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.Values[key]
+}
+
+// SetValue stores a value that must survive a resume, such as the
+// staging key chosen for the transfer.
+func (j *Journal) SetValue(key, value string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Values[key] = value
+	return j.saveLocked()
+}
+
+// Object returns a copy of the recorded state of the object at key, or
+// nil if nothing has been recorded.
+func (j *Journal) Object(key string) *Object {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	obj, ok := j.Objects[key]
+	if !ok {
+		return nil
+	}
+
+	cp := *obj
+	cp.Parts = make(map[int32]string, len(obj.Parts))
+	for n, etag := range obj.Parts {
+		cp.Parts[n] = etag
+	}
+	return &cp
+}
+
+// StartObject records that the upload of key has begun, replacing any
+// earlier progress. uploadID is empty for single-request uploads. The
+// journal is saved straight away for multipart uploads, so that an
+// interrupted transfer can still find and abort them.
+func (j *Journal) StartObject(key string, size int64, modTime time.Time, uploadID string, partSize int64) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Objects[key] = &Object{
+		Size:     size,
+		ModTime:  modTime.UTC(),
+		UploadID: uploadID,
+		PartSize: partSize,
+		Parts:    make(map[int32]string),
+	}
+	if uploadID == "" {
+		return j.progressLocked()
+	}
+	return j.saveLocked()
+}
+
+// RecordPart records that part partNumber of key's multipart upload was
+// uploaded with the given ETag.
+func (j *Journal) RecordPart(key string, partNumber int32, etag string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	obj, ok := j.Objects[key]
+	if !ok {
+		return fmt.Errorf("no upload recorded for %s", key)
+	}
+	if obj.Parts == nil {
+		obj.Parts = make(map[int32]string)
+	}
+	obj.Parts[partNumber] = etag
+	return j.progressLocked()
+}
+
+// CompleteObject records that key was fully uploaded.
+func (j *Journal) CompleteObject(key string, size int64, modTime time.Time) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Objects[key] = &Object{
+		Size:     size,
+		ModTime:  modTime.UTC(),
+		Complete: true,
+	}
+	return j.progressLocked()
+}
+
+// ResetObject discards any recorded progress for key.
+func (j *Journal) ResetObject(key string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.Objects, key)
+	return j.progressLocked()
+}
+
+// ResetProgress discards the recorded phases and objects so that resuming
+// the transfer starts it over, typically after its staged objects were
+// deleted. Values are kept.
+func (j *Journal) ResetProgress() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Phases = nil
+	j.Objects = make(map[string]*Object)
+	return j.saveLocked()
+}
+
+// PendingUploads returns the upload IDs of multipart uploads that were
+// started but not completed, keyed by object key.
+func (j *Journal) PendingUploads() map[string]string {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	uploads := make(map[string]string)
+	for key, obj := range j.Objects {
+		if obj.UploadID != "" && !obj.Complete {
+			uploads[key] = obj.UploadID
+		}
+	}
+	return uploads
+}
+
+// Matches reports whether the recorded object describes a file with the
+// given size and modification time, i.e. whether earlier progress still
+// applies to it.
+func (o *Object) Matches(size int64, modTime time.Time) bool {
+	return o != nil && o.Size == size && o.ModTime.Equal(modTime.UTC())
+}
@@ -0,0 +1,378 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func useTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	orig := Dir
+	Dir = dir
+	t.Cleanup(func() { Dir = orig })
+	return dir
+}
+
+func TestNewAndLoad(t *testing.T) {
+	dir := useTempDir(t)
+
+	transferConfig := model.TransferConfig{
+		Source:        "./files",
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   "/tmp/files",
+		BucketName:    "test-bucket",
+		Direction:     model.ToRemote,
+	}
+
+	j, err := New(transferConfig)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if j.ID == "" {
+		t.Fatal("New() did not assign a transfer ID")
+	}
+	if j.Transfer.TransferID != j.ID {
+		t.Errorf("Transfer.TransferID = %q, want %q", j.Transfer.TransferID, j.ID)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, j.ID+".json"))
+	if err != nil {
+		t.Fatalf("journal file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("journal file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	if err := j.MarkPhase(PhaseUpload); err != nil {
+		t.Fatalf("MarkPhase() error = %v", err)
+	}
+	if err := j.SetValue("staging_key", "bcp-download-1"); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+
+	loaded, err := Load(j.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !loaded.PhaseDone(PhaseUpload) {
+		t.Error("loaded journal lost the completed upload phase")
+	}
+	if loaded.PhaseDone(PhaseRemoteDownload) {
+		t.Error("loaded journal reports a phase that never ran")
+	}
+	if got := loaded.Value("staging_key"); got != "bcp-download-1" {
+		t.Errorf("Value(staging_key) = %q, want %q", got, "bcp-download-1")
+	}
+	if loaded.Transfer.Source != transferConfig.Source {
+		t.Errorf("Transfer.Source = %q, want %q", loaded.Transfer.Source, transferConfig.Source)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	useTempDir(t)
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"missing journal", "does-not-exist"},
+		{"empty ID", ""},
+		{"path traversal", "../config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.id); err == nil {
+				t.Errorf("Load(%q) expected error, got nil", tt.id)
+			}
+		})
+	}
+}
+
+func TestObjectProgress(t *testing.T) {
+	useTempDir(t)
+
+	j, err := New(model.TransferConfig{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	modTime := time.Now()
+	if err := j.StartObject("big.bin", 100, modTime, "upload-1", 10); err != nil {
+		t.Fatalf("StartObject() error = %v", err)
+	}
+	if err := j.RecordPart("big.bin", 1, "etag-1"); err != nil {
+		t.Fatalf("RecordPart() error = %v", err)
+	}
+	if err := j.RecordPart("missing.bin", 1, "etag-1"); err == nil {
+		t.Error("RecordPart() on an unknown object expected error, got nil")
+	}
+	if err := j.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	loaded, err := Load(j.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	obj := loaded.Object("big.bin")
+	if obj == nil {
+		t.Fatal("Object() = nil after StartObject")
+	}
+	if obj.UploadID != "upload-1" || obj.PartSize != 10 || obj.Parts[1] != "etag-1" {
+		t.Errorf("Object() = %+v, want upload-1 with part 1", obj)
+	}
+	if !obj.Matches(100, modTime) {
+		t.Error("Matches() = false for the unchanged file")
+	}
+	if obj.Matches(100, modTime.Add(time.Second)) {
+		t.Error("Matches() = true for a modified file")
+	}
+
+	if err := loaded.CompleteObject("big.bin", 100, modTime); err != nil {
+		t.Fatalf("CompleteObject() error = %v", err)
+	}
+	if obj := loaded.Object("big.bin"); !obj.Complete || obj.UploadID != "" {
+		t.Errorf("Object() = %+v, want a completed object", obj)
+	}
+
+	if err := loaded.ResetObject("big.bin"); err != nil {
+		t.Fatalf("ResetObject() error = %v", err)
+	}
+	if obj := loaded.Object("big.bin"); obj != nil {
+		t.Errorf("Object() = %+v after ResetObject, want nil", obj)
+	}
+}
+
+func TestProgressIsSavedInBatches(t *testing.T) {
+	useTempDir(t)
+
+	j, err := New(model.TransferConfig{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// saved returns the number of objects the journal on disk records
+	saved := func() int {
+		t.Helper()
+		loaded, err := Load(j.ID)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		return len(loaded.Objects)
+	}
+
+	modTime := time.Now()
+	for i := range flushEvery - 1 {
+		if err := j.CompleteObject(fmt.Sprintf("file-%d", i), 1, modTime); err != nil {
+			t.Fatalf("CompleteObject() error = %v", err)
+		}
+	}
+	if got := saved(); got != 0 {
+		t.Errorf("Journal on disk records %d objects before the batch is full, want 0", got)
+	}
+
+	if err := j.CompleteObject("last", 1, modTime); err != nil {
+		t.Fatalf("CompleteObject() error = %v", err)
+	}
+	if got := saved(); got != flushEvery {
+		t.Errorf("Journal on disk records %d objects after a full batch, want %d", got, flushEvery)
+	}
+
+	if err := j.CompleteObject("pending", 1, modTime); err != nil {
+		t.Fatalf("CompleteObject() error = %v", err)
+	}
+	if err := j.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got := saved(); got != flushEvery+1 {
+		t.Errorf("Journal on disk records %d objects after Flush(), want %d", got, flushEvery+1)
+	}
+
+	// Multipart uploads are saved straight away so they can be aborted
+	if err := j.StartObject("big.bin", 100, modTime, "upload-1", 10); err != nil {
+		t.Fatalf("StartObject() error = %v", err)
+	}
+	if got := saved(); got != flushEvery+2 {
+		t.Errorf("Journal on disk records %d objects after starting a multipart upload, want %d", got, flushEvery+2)
+	}
+}
+
+func TestListAndRemove(t *testing.T) {
+	useTempDir(t)
+
+	first, err := New(model.TransferConfig{TransferID: "first"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := New(model.TransferConfig{TransferID: "second"}); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	journals, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(journals) != 2 || journals[0].ID != "first" || journals[1].ID != "second" {
+		t.Fatalf("List() returned unexpected journals: %v", journals)
+	}
+
+	if err := first.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	journals, err = List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(journals) != 1 || journals[0].ID != "second" {
+		t.Errorf("List() after Remove() returned unexpected journals: %v", journals)
+	}
+}
+
+func TestList_SkipsCorruptJournals(t *testing.T) {
+	dir := useTempDir(t)
+
+	if _, err := New(model.TransferConfig{TransferID: "good"}); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write corrupt journal: %v", err)
+	}
+
+	journals, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(journals) != 1 || journals[0].ID != "good" {
+		t.Errorf("List() returned %v, want only the readable journal", journals)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+
+	if j.PhaseDone(PhaseUpload) {
+		t.Error("nil journal reports a completed phase")
+	}
+	if err := j.MarkPhase(PhaseUpload); err != nil {
+		t.Errorf("MarkPhase() on nil journal error = %v", err)
+	}
+	if err := j.SetValue("key", "value"); err != nil {
+		t.Errorf("SetValue() on nil journal error = %v", err)
+	}
+	if got := j.Value("key"); got != "" {
+		t.Errorf("Value() on nil journal = %q, want empty", got)
+	}
+	if obj := j.Object("key"); obj != nil {
+		t.Errorf("Object() on nil journal = %+v, want nil", obj)
+	}
+	if err := j.Flush(); err != nil {
+		t.Errorf("Flush() on nil journal error = %v", err)
+	}
+	if err := j.Remove(); err != nil {
+		t.Errorf("Remove() on nil journal error = %v", err)
+	}
+}
+
+func TestPendingUploads(t *testing.T) {
+	useTempDir(t)
+
+	j, err := New(model.TransferConfig{Source: "./data"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	modTime := time.Now()
+	if err := j.StartObject("multipart.bin", 20<<20, modTime, "upload-1", 8<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.StartObject("single.txt", 10, modTime, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.StartObject("done.bin", 20<<20, modTime, "upload-2", 8<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.CompleteObject("done.bin", 20<<20, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := j.PendingUploads()
+	if len(uploads) != 1 || uploads["multipart.bin"] != "upload-1" {
+		t.Errorf("PendingUploads() = %v, want only multipart.bin", uploads)
+	}
+
+	var nilJournal *Journal
+	if got := nilJournal.PendingUploads(); len(got) != 0 {
+		t.Errorf("nil PendingUploads() = %v, want empty", got)
+	}
+}
+
+func TestResetProgress(t *testing.T) {
+	useTempDir(t)
+
+	j, err := New(model.TransferConfig{Source: "./data"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := j.MarkPhase(PhaseUpload); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.CompleteObject("data/file.txt", 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.SetValue("platform", "posix"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.ResetProgress(); err != nil {
+		t.Fatalf("ResetProgress() error = %v", err)
+	}
+
+	loaded, err := Load(j.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.PhaseDone(PhaseUpload) {
+		t.Error("Expected the upload phase to be reset")
+	}
+	if loaded.Object("data/file.txt") != nil {
+		t.Error("Expected recorded objects to be reset")
+	}
+	if loaded.Value("platform") != "posix" {
+		t.Errorf("Value(platform) = %q, want values to be kept", loaded.Value("platform"))
+	}
+
+	var nilJournal *Journal
+	if err := nilJournal.ResetProgress(); err != nil {
+		t.Errorf("nil ResetProgress() error = %v", err)
+	}
+}
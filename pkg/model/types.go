@@ -32,21 +32,88 @@ const (
 	FromRemote TransferDirection = "from_remote"
 )
 
+// RemoteTransport selects how the remote instance moves bytes to and from
+// the staging bucket.
+type RemoteTransport string
+
+const (
+	// RemoteTransportAuto uses the AWS CLI when the instance has it and
+	// falls back to presigned URLs otherwise
+	RemoteTransportAuto RemoteTransport = "auto"
+	// RemoteTransportAWSCLI runs aws s3 cp on the instance
+	RemoteTransportAWSCLI RemoteTransport = "awscli"
+	// RemoteTransportPresigned moves bytes with curl or wget using S3
+	// presigned URLs generated locally
+	RemoteTransportPresigned RemoteTransport = "presigned"
+)
+
+// ServerSideEncryption selects how S3 encrypts staged objects at rest.
+type ServerSideEncryption string
+
+const (
+	// ServerSideEncryptionNone leaves encryption to the bucket's default
+	ServerSideEncryptionNone ServerSideEncryption = ""
+	// ServerSideEncryptionAES256 encrypts with S3 managed keys (SSE-S3)
+	ServerSideEncryptionAES256 ServerSideEncryption = "AES256"
+	// ServerSideEncryptionKMS encrypts with a KMS key (SSE-KMS)
+	ServerSideEncryptionKMS ServerSideEncryption = "aws:kms"
+)
+
 type TransferConfig struct {
+	TransferID    string
 	Source        string
 	SSMInstanceID string
-	Destination   string
-	BucketName    string
-	MaxRetries    int
-	RetryDelay    int
-	IsDirectory   bool
-	Direction     TransferDirection
+	// InstanceIDs lists the instances a fan-out transfer copies to with
+	// shared SSM commands; SSMInstanceID is unused when it is set
+	InstanceIDs        []string
+	Destination        string
+	BucketName         string
+	MaxRetries         int
+	RetryDelay         int
+	Concurrency        int
+	PartSize           int64
+	MultipartThreshold int64
+	IsDirectory        bool
+	Direction          TransferDirection
+	RemoteTransport    RemoteTransport
+	// CommandTimeout is how many seconds each SSM command may run before
+	// it is cancelled; zero uses the default
+	CommandTimeout int
+	// KeepStaged leaves the objects staged in S3 in place instead of
+	// deleting them once the transfer succeeds or fails
+	KeepStaged bool
+	// SSE is the server-side encryption staged objects are written with
+	SSE ServerSideEncryption
+	// KMSKeyID is the KMS key SSE-KMS encrypts staged objects with; empty
+	// uses the account's default aws/s3 key
+	KMSKeyID string
+	// BucketRegion is the region BucketName lives in, passed to the
+	// instance's AWS CLI; empty leaves it to the instance's configuration
+	BucketRegion string
+	// S3Endpoint is the S3-compatible endpoint the instance's AWS CLI is
+	// pointed at; empty uses AWS's
+	S3Endpoint string
+	// ClientEncryption encrypts files locally before they are staged and
+	// has the instance decrypt them after downloading
+	ClientEncryption bool
+	// EphemeralBucket stages the transfer in BucketName, a bucket that is
+	// created for the transfer and deleted once it finishes
+	EphemeralBucket bool
 }
 
 type AWSConfig struct {
-	Region  string
-	Profile string
-	Bucket  string
+	Region      string
+	Profile     string
+	Bucket      string
+	RoleARN     string `yaml:"role_arn" mapstructure:"role_arn"`
+	S3RoleARN   string `yaml:"s3_role_arn" mapstructure:"s3_role_arn"`
+	ExternalID  string `yaml:"external_id" mapstructure:"external_id"`
+	SessionName string `yaml:"session_name" mapstructure:"session_name"`
+	// S3Endpoint, S3ForcePathStyle and SSMEndpoint point bcp at
+	// S3-compatible object stores and alternate SSM endpoints
+	S3Endpoint       string `yaml:"s3_endpoint" mapstructure:"s3_endpoint"`
+	S3ForcePathStyle bool   `yaml:"s3_force_path_style" mapstructure:"s3_force_path_style"`
+	SSMEndpoint      string `yaml:"ssm_endpoint" mapstructure:"ssm_endpoint"`
 }
 
 type LogConfig struct {
@@ -61,6 +128,15 @@ type Config struct {
 }
 
 type TransferDefaults struct {
-	MaxRetries int `yaml:"max_retries"`
-	RetryDelay int `yaml:"retry_delay"`
+	MaxRetries         int    `yaml:"max_retries"`
+	RetryDelay         int    `yaml:"retry_delay"`
+	Concurrency        int    `yaml:"concurrency"`
+	PartSize           int64  `yaml:"part_size" mapstructure:"part_size"`
+	MultipartThreshold int64  `yaml:"multipart_threshold" mapstructure:"multipart_threshold"`
+	RemoteTransport    string `yaml:"remote_transport" mapstructure:"remote_transport"`
+	CommandTimeout     int    `yaml:"command_timeout" mapstructure:"command_timeout"`
+	KeepStaged         bool   `yaml:"keep_staged" mapstructure:"keep_staged"`
+	SSE                string `yaml:"sse"`
+	KMSKeyID           string `yaml:"kms_key_id" mapstructure:"kms_key_id"`
+	ClientEncryption   bool   `yaml:"client_encryption" mapstructure:"client_encryption"`
 }
@@ -0,0 +1,205 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// Lifecycle rule IDs bcp manages on staging buckets. Rules with other IDs
+// are left untouched when a bucket is initialized again.
+const (
+	stagingLifecycleRuleID = "bcp-expire-staging"
+	legacyLifecycleRuleID  = "bcp-expire-legacy-staging"
+)
+
+// abortIncompleteUploadDays is how long incomplete multipart uploads are
+// kept in a staging bucket before S3 aborts them.
+const abortIncompleteUploadDays = 1
+
+// InitBucket creates bucketName in region, or updates it if it already
+// exists and is owned by the caller, so it is safe to stage transfers in:
+// objects under bcp's staging prefixes expire after expireDays days,
+// incomplete multipart uploads are aborted, public access is blocked and
+// objects are encrypted with SSE-S3 by default, unless the bucket already
+// has default encryption of its own. It reports whether the bucket was
+// created.
+func InitBucket(ctx context.Context, client BucketAPI, bucketName, region string, expireDays int) (bool, error) {
+	created, err := createBucket(ctx, client, bucketName, region)
+	if err != nil {
+		return false, err
+	}
+	return created, configureBucket(ctx, client, bucketName, expireDays)
+}
+
+// configureBucket locks down bucketName and sets bcp's lifecycle rules on
+// it.
+func configureBucket(ctx context.Context, client BucketAPI, bucketName string, expireDays int) error {
+	log.Debug("Blocking public access to %s", bucketName)
+	if _, err := client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to block public access to bucket %s: %w", bucketName, err)
+	}
+
+	// Replacing a bucket's own default encryption, such as SSE-KMS under
+	// a key of the account's choosing, would weaken it
+	existing, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil && !isNoDefaultEncryption(err) {
+		return fmt.Errorf("failed to get default encryption of bucket %s: %w", bucketName, err)
+	}
+	if err == nil && existing.ServerSideEncryptionConfiguration != nil && len(existing.ServerSideEncryptionConfiguration.Rules) > 0 {
+		log.Debug("Keeping the default encryption of %s", bucketName)
+		return putStagingLifecycle(ctx, client, bucketName, expireDays)
+	}
+
+	log.Debug("Enabling default encryption on %s", bucketName)
+	if _, err := client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+		ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+					SSEAlgorithm: s3types.ServerSideEncryptionAes256,
+				},
+			}},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to enable default encryption on bucket %s: %w", bucketName, err)
+	}
+
+	return putStagingLifecycle(ctx, client, bucketName, expireDays)
+}
+
+// createBucket creates bucketName in region and reports whether it was
+// created. A bucket the caller already owns is not an error. In
+// us-east-1, CreateBucket succeeds again for a bucket the caller owns, so
+// HeadBucket tells whether the bucket existed beforehand; CreateBucket
+// still runs to reject buckets that belong to someone else.
+func createBucket(ctx context.Context, client BucketAPI, bucketName, region string) (bool, error) {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	existed := err == nil
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+	// us-east-1 is the default location and must not be named explicitly
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(region),
+		}
+	}
+
+	log.Debug("Creating bucket %s in %s", bucketName, region)
+	if _, err := client.CreateBucket(ctx, input); err != nil {
+		var owned *s3types.BucketAlreadyOwnedByYou
+		if errors.As(err, &owned) {
+			log.Debug("Bucket %s already exists, updating it", bucketName)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create bucket %s: %w", bucketName, err)
+	}
+	if existed {
+		log.Debug("Bucket %s already exists, updating it", bucketName)
+		return false, nil
+	}
+	return true, nil
+}
+
+// putStagingLifecycle sets bcp's lifecycle rules on bucketName, replacing
+// earlier versions of them and keeping every other rule.
+func putStagingLifecycle(ctx context.Context, client BucketAPI, bucketName string, expireDays int) error {
+	var rules []s3types.LifecycleRule
+	existing, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil && !isNoSuchLifecycleConfiguration(err) {
+		return fmt.Errorf("failed to get lifecycle configuration of bucket %s: %w", bucketName, err)
+	}
+	if err == nil {
+		for _, rule := range existing.Rules {
+			switch aws.ToString(rule.ID) {
+			case stagingLifecycleRuleID, legacyLifecycleRuleID:
+			default:
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	rules = append(rules,
+		stagingLifecycleRule(stagingLifecycleRuleID, stagingRoot, expireDays),
+		stagingLifecycleRule(legacyLifecycleRuleID, legacyDownloadPrefix, expireDays),
+	)
+
+	log.Debug("Expiring staged objects in %s after %d day(s)", bucketName, expireDays)
+	if _, err := client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucketName),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	}); err != nil {
+		return fmt.Errorf("failed to set lifecycle configuration of bucket %s: %w", bucketName, err)
+	}
+	return nil
+}
+
+// stagingLifecycleRule expires the objects under prefix after expireDays
+// days and aborts incomplete multipart uploads to it.
+func stagingLifecycleRule(id, prefix string, expireDays int) s3types.LifecycleRule {
+	return s3types.LifecycleRule{
+		ID:     aws.String(id),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+		Expiration: &s3types.LifecycleExpiration{
+			Days: aws.Int32(int32(expireDays)),
+		},
+		AbortIncompleteMultipartUpload: &s3types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(abortIncompleteUploadDays),
+		},
+	}
+}
+
+// isNoSuchLifecycleConfiguration reports whether err means the bucket has
+// no lifecycle configuration yet.
+func isNoSuchLifecycleConfiguration(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration"
+}
+
+// isNoDefaultEncryption reports whether err means the bucket has no
+// default encryption configured.
+func isNoDefaultEncryption(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ServerSideEncryptionConfigurationNotFoundError"
+}
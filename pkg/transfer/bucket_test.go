@@ -0,0 +1,239 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockBucketClient records the configuration InitBucket applies.
+type mockBucketClient struct {
+	// exists makes HeadBucket find the bucket
+	exists    bool
+	createErr error
+	existing  []s3types.LifecycleRule
+	// existingEncryption is the bucket's default encryption, if any
+	existingEncryption *s3types.ServerSideEncryptionConfiguration
+
+	create       *s3.CreateBucketInput
+	publicAccess *s3.PutPublicAccessBlockInput
+	encryption   *s3.PutBucketEncryptionInput
+	lifecycle    *s3.PutBucketLifecycleConfigurationInput
+	deleted      []string
+}
+
+func (m *mockBucketClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !m.exists {
+		return nil, &s3types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mockBucketClient) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.create = params
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (m *mockBucketClient) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	m.publicAccess = params
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (m *mockBucketClient) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if m.existingEncryption == nil {
+		return nil, &smithy.GenericAPIError{Code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: m.existingEncryption}, nil
+}
+
+func (m *mockBucketClient) PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	m.encryption = params
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+func (m *mockBucketClient) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if m.existing == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: m.existing}, nil
+}
+
+func (m *mockBucketClient) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.lifecycle = params
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (m *mockBucketClient) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	m.deleted = append(m.deleted, aws.ToString(params.Bucket))
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func TestInitBucket_Creates(t *testing.T) {
+	client := &mockBucketClient{}
+
+	created, err := InitBucket(context.Background(), client, "staging", "eu-west-1", 3)
+	if err != nil {
+		t.Fatalf("InitBucket() error = %v", err)
+	}
+	if !created {
+		t.Error("InitBucket() created = false, want true")
+	}
+
+	if got := client.create.CreateBucketConfiguration.LocationConstraint; got != "eu-west-1" {
+		t.Errorf("LocationConstraint = %q, want eu-west-1", got)
+	}
+
+	block := client.publicAccess.PublicAccessBlockConfiguration
+	if !aws.ToBool(block.BlockPublicAcls) || !aws.ToBool(block.BlockPublicPolicy) ||
+		!aws.ToBool(block.IgnorePublicAcls) || !aws.ToBool(block.RestrictPublicBuckets) {
+		t.Errorf("public access block = %+v, want everything blocked", block)
+	}
+
+	if got := client.encryption.ServerSideEncryptionConfiguration.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm; got != s3types.ServerSideEncryptionAes256 {
+		t.Errorf("SSEAlgorithm = %q, want AES256", got)
+	}
+
+	rules := client.lifecycle.LifecycleConfiguration.Rules
+	if len(rules) != 2 {
+		t.Fatalf("got %d lifecycle rules, want 2", len(rules))
+	}
+	for i, prefix := range []string{stagingRoot, legacyDownloadPrefix} {
+		rule := rules[i]
+		if aws.ToString(rule.Filter.Prefix) != prefix {
+			t.Errorf("rule %d prefix = %q, want %q", i, aws.ToString(rule.Filter.Prefix), prefix)
+		}
+		if aws.ToInt32(rule.Expiration.Days) != 3 {
+			t.Errorf("rule %d expires after %d days, want 3", i, aws.ToInt32(rule.Expiration.Days))
+		}
+		if rule.AbortIncompleteMultipartUpload == nil {
+			t.Errorf("rule %d does not abort incomplete multipart uploads", i)
+		}
+	}
+}
+
+func TestInitBucket_DefaultRegionHasNoLocationConstraint(t *testing.T) {
+	client := &mockBucketClient{}
+
+	if _, err := InitBucket(context.Background(), client, "staging", "us-east-1", 7); err != nil {
+		t.Fatalf("InitBucket() error = %v", err)
+	}
+	if client.create.CreateBucketConfiguration != nil {
+		t.Errorf("CreateBucketConfiguration = %+v, want none in us-east-1", client.create.CreateBucketConfiguration)
+	}
+}
+
+func TestInitBucket_UpdatesOwnedBucket(t *testing.T) {
+	client := &mockBucketClient{
+		createErr: &s3types.BucketAlreadyOwnedByYou{},
+		existing: []s3types.LifecycleRule{
+			{ID: aws.String("archive-logs"), Status: s3types.ExpirationStatusEnabled},
+			{ID: aws.String(stagingLifecycleRuleID), Status: s3types.ExpirationStatusEnabled},
+		},
+	}
+
+	created, err := InitBucket(context.Background(), client, "staging", "us-east-1", 7)
+	if err != nil {
+		t.Fatalf("InitBucket() error = %v", err)
+	}
+	if created {
+		t.Error("InitBucket() created = true, want false for an existing bucket")
+	}
+
+	var ids []string
+	for _, rule := range client.lifecycle.LifecycleConfiguration.Rules {
+		ids = append(ids, aws.ToString(rule.ID))
+	}
+	want := []string{"archive-logs", stagingLifecycleRuleID, legacyLifecycleRuleID}
+	if len(ids) != len(want) {
+		t.Fatalf("lifecycle rules = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("lifecycle rules = %v, want %v", ids, want)
+			break
+		}
+	}
+}
+
+func TestInitBucket_OwnedBucketInDefaultRegion(t *testing.T) {
+	// CreateBucket succeeds for a bucket the caller owns in us-east-1
+	client := &mockBucketClient{exists: true}
+
+	created, err := InitBucket(context.Background(), client, "staging", "us-east-1", 7)
+	if err != nil {
+		t.Fatalf("InitBucket() error = %v", err)
+	}
+	if created {
+		t.Error("InitBucket() created = true, want false for an existing bucket")
+	}
+	if client.lifecycle == nil {
+		t.Error("InitBucket() did not update the existing bucket")
+	}
+}
+
+func TestInitBucket_KeepsExistingEncryption(t *testing.T) {
+	client := &mockBucketClient{
+		createErr: &s3types.BucketAlreadyOwnedByYou{},
+		existingEncryption: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+					SSEAlgorithm:   s3types.ServerSideEncryptionAwsKms,
+					KMSMasterKeyID: aws.String("alias/staging"),
+				},
+			}},
+		},
+	}
+
+	if _, err := InitBucket(context.Background(), client, "staging", "us-east-1", 7); err != nil {
+		t.Fatalf("InitBucket() error = %v", err)
+	}
+	if client.encryption != nil {
+		t.Errorf("InitBucket() replaced the bucket's SSE-KMS default encryption with %+v", client.encryption.ServerSideEncryptionConfiguration)
+	}
+	if client.lifecycle == nil {
+		t.Error("InitBucket() did not set the staging lifecycle rules")
+	}
+}
+
+func TestInitBucket_CreateError(t *testing.T) {
+	client := &mockBucketClient{createErr: &s3types.BucketAlreadyExists{}}
+
+	_, err := InitBucket(context.Background(), client, "staging", "us-east-1", 7)
+	var exists *s3types.BucketAlreadyExists
+	if !errors.As(err, &exists) {
+		t.Errorf("InitBucket() error = %v, want BucketAlreadyExists", err)
+	}
+	if client.publicAccess != nil {
+		t.Error("Expected the bucket not to be configured after failing to create it")
+	}
+}
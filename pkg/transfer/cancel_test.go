@@ -0,0 +1,150 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func TestRetryOperation_CancelledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	operation := func() error {
+		attempts++
+		cancel()
+		return errors.New("connection reset by peer")
+	}
+
+	start := time.Now()
+	err := retryOperation(ctx, operation, 3, 60)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("retryOperation() error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("operation ran %d times, want 1", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retryOperation() waited %v after cancellation", elapsed)
+	}
+}
+
+func TestRunSSMDocument_CancelsCommandOnInterrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var cancelled *ssm.CancelCommandInput
+	mockSSM := &mockSSMClient{
+		cancelCommandFunc: func(ctx context.Context, params *ssm.CancelCommandInput, optFns ...func(*ssm.Options)) (*ssm.CancelCommandOutput, error) {
+			if ctx.Err() != nil {
+				t.Errorf("CancelCommand called with a cancelled context: %v", ctx.Err())
+			}
+			cancelled = params
+			return &ssm.CancelCommandOutput{}, nil
+		},
+	}
+
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"sleep 600"}, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("runSSMCommand() error = %v, want context.Canceled", err)
+	}
+	if cancelled == nil {
+		t.Fatal("Expected the running command to be cancelled")
+	}
+	if aws.ToString(cancelled.CommandId) != "test-command-id" {
+		t.Errorf("CancelCommand CommandId = %q, want test-command-id", aws.ToString(cancelled.CommandId))
+	}
+	if len(cancelled.InstanceIds) != 1 || cancelled.InstanceIds[0] != "i-1234567890abcdef0" {
+		t.Errorf("CancelCommand InstanceIds = %v", cancelled.InstanceIds)
+	}
+}
+
+func TestExecuteWithJournal_InterruptCleansUpStagedObjects(t *testing.T) {
+	testFile := writeTempFile(t, []byte("test content"))
+	transferConfig := model.TransferConfig{
+		Source:        testFile,
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   "/opt/app/large.bin",
+		BucketName:    "test-bucket",
+		MaxRetries:    3,
+		RetryDelay:    1,
+		Direction:     model.ToRemote,
+	}
+	j := newTestJournal(t, transferConfig)
+	if err := j.StartObject("earlier/part.bin", 10<<20, time.Now(), "upload-1", 5<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var uploaded, deleted, aborted []string
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			mu.Lock()
+			uploaded = append(uploaded, aws.ToString(params.Key))
+			mu.Unlock()
+			cancel()
+			return nil, ctx.Err()
+		},
+		deleteObjectFunc: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			if ctx.Err() != nil {
+				t.Errorf("DeleteObject called with a cancelled context: %v", ctx.Err())
+			}
+			mu.Lock()
+			deleted = append(deleted, aws.ToString(params.Key))
+			mu.Unlock()
+			return &s3.DeleteObjectOutput{}, nil
+		},
+		abortMPUFunc: func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+			mu.Lock()
+			aborted = append(aborted, aws.ToString(params.UploadId))
+			mu.Unlock()
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+	}
+
+	err := ExecuteWithJournal(ctx, j, mockS3, &mockSSMClient{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ExecuteWithJournal() error = %v, want context.Canceled", err)
+	}
+
+	if len(uploaded) != 1 {
+		t.Fatalf("Expected 1 upload attempt, got %v", uploaded)
+	}
+	if len(deleted) != 1 || deleted[0] != uploaded[0] {
+		t.Errorf("deleted = %v, want the staged key %s", deleted, uploaded[0])
+	}
+	if len(aborted) != 1 || aborted[0] != "upload-1" {
+		t.Errorf("aborted uploads = %v, want [upload-1]", aborted)
+	}
+}
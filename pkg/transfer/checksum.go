@@ -0,0 +1,311 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// checksumMetadataKey is the user metadata key staged objects carry their
+// hex-encoded SHA-256 in.
+const checksumMetadataKey = "bcp-sha256"
+
+// ChecksumMismatch describes a file whose contents differ between the
+// source and destination of a transfer.
+type ChecksumMismatch struct {
+	// Path is the destination path of the file.
+	Path string
+	// Expected is the SHA-256 of the source file.
+	Expected string
+	// Actual is the SHA-256 of the destination file, or empty if the file
+	// is missing.
+	Actual string
+}
+
+// ChecksumError is returned when one or more transferred files fail
+// SHA-256 verification.
+type ChecksumError struct {
+	Mismatches []ChecksumMismatch
+}
+
+// Error reports every mismatched file on its own line.
+func (e *ChecksumError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "checksum verification failed for %d file(s):", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		if m.Actual == "" {
+			fmt.Fprintf(&b, "\n  %s: missing (expected sha256 %s)", m.Path, m.Expected)
+		} else {
+			fmt.Fprintf(&b, "\n  %s: expected sha256 %s, got %s", m.Path, m.Expected, m.Actual)
+		}
+	}
+	return b.String()
+}
+
+// sha256Reader returns the hex-encoded SHA-256 of everything read from r.
+func sha256Reader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sha256File returns the hex-encoded SHA-256 of the file at path.
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	sum, err := sha256Reader(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return sum, nil
+}
+
+// uploadedChecksums records the SHA-256 uploadFile computes for each
+// file it stages, keyed by object key, so the transfer can be verified
+// without reading the files again. It is safe for concurrent use.
+type uploadedChecksums struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+// record notes that the file staged under key has the SHA-256 sum. A nil
+// *uploadedChecksums records nothing.
+func (u *uploadedChecksums) record(key, sum string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.sums == nil {
+		u.sums = make(map[string]string)
+	}
+	u.sums[key] = sum
+}
+
+// lookup returns the SHA-256 recorded for key, if any.
+func (u *uploadedChecksums) lookup(key string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	sum, ok := u.sums[key]
+	return sum, ok
+}
+
+// stagedChecksums returns the SHA-256 of the local files of staged, keyed
+// by staged key. Hashes recorded during the upload are reused, so only
+// files the upload skipped, such as those a resumed transfer had already uploaded,
+// are read again.
+func stagedChecksums(staged []stagedFile, uploaded *uploadedChecksums) (map[string]string, error) {
+	sums := make(map[string]string, len(staged))
+	for _, file := range staged {
+		if sum, ok := uploaded.lookup(file.Key); ok {
+			sums[file.Key] = sum
+			continue
+		}
+		sum, err := sha256File(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		sums[file.Key] = sum
+	}
+	return sums, nil
+}
+
+// expectedChecksums rekeys sums, the hashes stagedChecksums returns for
+// staged, the way checksumsFromOutput keys the hashes of the copies.
+func expectedChecksums(staged []stagedFile, sums map[string]string) map[string]string {
+	expected := make(map[string]string, len(staged))
+	for _, file := range staged {
+		expected[file.RelPath] = sums[file.Key]
+	}
+	return expected
+}
+
+// remoteChecksums hashes the files of a transfer on the instance and returns the hashes
+// keyed the same way as checksumsFromOutput.
+func remoteChecksums(ctx context.Context, host remoteHost, remotePath string, isDirectory bool, name string) (map[string]string, error) {
+	output, err := host.run(ctx, host.platform.checksumCommand(remotePath, isDirectory, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute checksums on remote instance: %w", err)
+	}
+	return checksumsFromOutput(output, isDirectory, name), nil
+}
+
+// checksumsFromOutput parses the output of checksumCommand into hashes.
+// Directories are keyed by each file's slash-separated path relative to
+// the directory; a single file is keyed by name.
+func checksumsFromOutput(output string, isDirectory bool, name string) map[string]string {
+	parsed := parseSHA256Sum(output)
+	if isDirectory {
+		return parsed
+	}
+
+	for _, sum := range parsed {
+		return map[string]string{name: sum}
+	}
+	return map[string]string{}
+}
+
+// parseSHA256Sum parses sha256sum output into a map of hashes keyed by
+// path, with any leading "./" removed. Lines sha256sum escaped because
+// the file name contains a backslash or newline are unescaped.
+func parseSHA256Sum(output string) map[string]string {
+	sums := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		escaped := strings.HasPrefix(line, "\\")
+		line = strings.TrimPrefix(line, "\\")
+
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		// sha256sum separates the hash from the name with " " or " *"
+		name = strings.TrimPrefix(name, " ")
+		name = strings.TrimPrefix(name, "*")
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+		sums[strings.TrimPrefix(name, "./")] = strings.ToLower(sum)
+	}
+
+	return sums
+}
+
+// compareChecksums checks every expected file against actual and returns
+// a *ChecksumError listing the files that differ or are missing. Files
+// only present in actual are ignored. destination joins a key onto the
+// destination root for the report.
+func compareChecksums(expected, actual map[string]string, destination func(key string) string) error {
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var mismatches []ChecksumMismatch
+	for _, key := range keys {
+		if actual[key] != expected[key] {
+			mismatches = append(mismatches, ChecksumMismatch{
+				Path:     destination(key),
+				Expected: expected[key],
+				Actual:   actual[key],
+			})
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &ChecksumError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// verifyToRemote compares expected, the SHA-256 of the local source files
+// keyed the way checksumsFromOutput keys them, with the copies downloaded
+// onto the instance. name is the base name of the source.
+func verifyToRemote(ctx context.Context, host remoteHost, expected map[string]string, name, destination string, isDirectory bool) error {
+	log.Info("Verifying checksums on remote instance...")
+
+	actual, err := remoteChecksums(ctx, host, destination, isDirectory, name)
+	if err != nil {
+		return err
+	}
+
+	if err := compareChecksums(expected, actual, remoteDestination(host.id, host.platform, destination, isDirectory)); err != nil {
+		return err
+	}
+
+	log.Info("Verified SHA-256 of %d file(s)", len(expected))
+	return nil
+}
+
+// remoteDestination returns how compareChecksums reports a file copied to
+// destination on instance id.
+func remoteDestination(id string, platform remotePlatform, destination string, isDirectory bool) func(key string) string {
+	return func(key string) string {
+		if !isDirectory {
+			return id + ":" + destination
+		}
+		return id + ":" + platform.join(destination, key)
+	}
+}
+
+// verifyFromRemote compares the SHA-256 of the remote source files with
+// the copies downloaded to destination.
+func verifyFromRemote(ctx context.Context, host remoteHost, source, destination string, isDirectory bool) error {
+	log.Info("Verifying checksums of downloaded files...")
+
+	name := host.platform.base(source)
+	expected, err := remoteChecksums(ctx, host, source, isDirectory, name)
+	if err != nil {
+		return err
+	}
+
+	actual := make(map[string]string, len(expected))
+	localPath := func(key string) string {
+		if !isDirectory {
+			return destination
+		}
+		return filepath.Join(destination, filepath.FromSlash(key))
+	}
+	for key := range expected {
+		sum, err := sha256File(localPath(key))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to compute local checksums: %w", err)
+		}
+		actual[key] = sum
+	}
+
+	if err := compareChecksums(expected, actual, localPath); err != nil {
+		return err
+	}
+
+	log.Info("Verified SHA-256 of %d file(s)", len(expected))
+	return nil
+}
@@ -0,0 +1,316 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func TestParseSHA256Sum(t *testing.T) {
+	hashA := sha256Hex("a")
+	hashB := sha256Hex("b")
+
+	tests := []struct {
+		name     string
+		output   string
+		expected map[string]string
+	}{
+		{
+			name:     "single file",
+			output:   hashA + "  /tmp/a.txt\n",
+			expected: map[string]string{"/tmp/a.txt": hashA},
+		},
+		{
+			name:     "find output strips leading dot slash",
+			output:   hashA + "  ./a.txt\n" + hashB + "  ./sub/b.txt\n",
+			expected: map[string]string{"a.txt": hashA, "sub/b.txt": hashB},
+		},
+		{
+			name:     "binary mode marker",
+			output:   hashA + " *./a.txt\n",
+			expected: map[string]string{"a.txt": hashA},
+		},
+		{
+			name:     "file name with spaces",
+			output:   hashA + "  ./my file.txt\n",
+			expected: map[string]string{"my file.txt": hashA},
+		},
+		{
+			name:     "escaped file name",
+			output:   `\` + hashA + `  ./new\nline\\name` + "\n",
+			expected: map[string]string{"new\nline\\name": hashA},
+		},
+		{
+			name:     "ignores noise",
+			output:   "sha256sum: ./gone: No such file or directory\n\n" + hashA + "  ./a.txt\n",
+			expected: map[string]string{"a.txt": hashA},
+		},
+		{
+			name:     "uppercase hash is normalized",
+			output:   strings.ToUpper(hashA) + "  ./a.txt\n",
+			expected: map[string]string{"a.txt": hashA},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSHA256Sum(tt.output)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("parseSHA256Sum() = %v, want %v", got, tt.expected)
+			}
+			for name, sum := range tt.expected {
+				if got[name] != sum {
+					t.Errorf("parseSHA256Sum()[%q] = %q, want %q", name, got[name], sum)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareChecksums(t *testing.T) {
+	expected := map[string]string{"a": "1", "b": "2", "c": "3"}
+	actual := map[string]string{"a": "1", "b": "9", "extra": "4"}
+
+	err := compareChecksums(expected, actual, func(key string) string { return "/dest/" + key })
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("compareChecksums() error = %v, want *ChecksumError", err)
+	}
+	if len(checksumErr.Mismatches) != 2 {
+		t.Fatalf("Expected 2 mismatches, got %+v", checksumErr.Mismatches)
+	}
+	if m := checksumErr.Mismatches[0]; m.Path != "/dest/b" || m.Expected != "2" || m.Actual != "9" {
+		t.Errorf("Mismatches[0] = %+v, want /dest/b 2 -> 9", m)
+	}
+	if m := checksumErr.Mismatches[1]; m.Path != "/dest/c" || m.Actual != "" {
+		t.Errorf("Mismatches[1] = %+v, want missing /dest/c", m)
+	}
+
+	msg := err.Error()
+	for _, want := range []string{"2 file(s)", "/dest/b: expected sha256 2, got 9", "/dest/c: missing"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error message %q does not contain %q", msg, want)
+		}
+	}
+
+	if err := compareChecksums(expected, expected, func(key string) string { return key }); err != nil {
+		t.Errorf("compareChecksums() with identical sums error = %v", err)
+	}
+}
+
+func TestStagedChecksums(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create subdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	staged, err := stagedFiles(dir, "bcp/transfer-1")
+	if err != nil {
+		t.Fatalf("stagedFiles() error = %v", err)
+	}
+	aKey := "bcp/transfer-1/" + filepath.Base(dir) + "/a.txt"
+	bKey := "bcp/transfer-1/" + filepath.Base(dir) + "/sub/b.txt"
+
+	// A hash recorded during the upload is used instead of reading the
+	// file again
+	uploaded := &uploadedChecksums{}
+	uploaded.record(aKey, sha256Hex("recorded"))
+
+	sums, err := stagedChecksums(staged, uploaded)
+	if err != nil {
+		t.Fatalf("stagedChecksums() error = %v", err)
+	}
+	if len(sums) != 2 || sums[aKey] != sha256Hex("recorded") || sums[bKey] != sha256Hex("b") {
+		t.Errorf("stagedChecksums() = %v", sums)
+	}
+
+	expected := expectedChecksums(staged, sums)
+	if len(expected) != 2 || expected["a.txt"] != sha256Hex("recorded") || expected["sub/b.txt"] != sha256Hex("b") {
+		t.Errorf("expectedChecksums() = %v", expected)
+	}
+
+	staged, err = stagedFiles(filepath.Join(dir, "a.txt"), "")
+	if err != nil {
+		t.Fatalf("stagedFiles() error = %v", err)
+	}
+	sums, err = stagedChecksums(staged, nil)
+	if err != nil {
+		t.Fatalf("stagedChecksums() error = %v", err)
+	}
+	if expected := expectedChecksums(staged, sums); len(expected) != 1 || expected["a.txt"] != sha256Hex("a") {
+		t.Errorf("expectedChecksums() for a file = %v", expected)
+	}
+}
+
+func TestVerifyToRemote_Mismatch(t *testing.T) {
+	expected := map[string]string{
+		"good.txt": sha256Hex("good"),
+		"bad.txt":  sha256Hex("bad"),
+		"gone.txt": sha256Hex("gone"),
+	}
+
+	var sent string
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		sent = command
+		return sha256Hex("good") + "  ./good.txt\n" + sha256Hex("corrupt") + "  ./bad.txt\n"
+	})
+
+	err := verifyToRemote(context.Background(), linuxHost(mockSSM), expected, "app", "/opt/app", true)
+
+	if !strings.Contains(sent, "cd /opt/app") || !strings.Contains(sent, "sha256sum") {
+		t.Errorf("Unexpected checksum command %q", sent)
+	}
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("verifyToRemote() error = %v, want *ChecksumError", err)
+	}
+	if len(checksumErr.Mismatches) != 2 {
+		t.Fatalf("Expected 2 mismatches, got %+v", checksumErr.Mismatches)
+	}
+	if checksumErr.Mismatches[0].Path != "i-1234567890abcdef0:/opt/app/bad.txt" {
+		t.Errorf("Mismatches[0].Path = %q", checksumErr.Mismatches[0].Path)
+	}
+	if checksumErr.Mismatches[1].Path != "i-1234567890abcdef0:/opt/app/gone.txt" || checksumErr.Mismatches[1].Actual != "" {
+		t.Errorf("Mismatches[1] = %+v, want missing gone.txt", checksumErr.Mismatches[1])
+	}
+}
+
+func TestVerifyFromRemote(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		output    string
+		wantPaths []string
+	}{
+		{"all match", sha256Hex("a") + "  ./a.txt\n", nil},
+		{"corrupt and missing", sha256Hex("A") + "  ./a.txt\n" + sha256Hex("b") + "  ./b.txt\n", []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSSM := commandOutputSSMClient(func(command string) string { return tt.output })
+
+			err := verifyFromRemote(context.Background(), linuxHost(mockSSM), "/var/log/app", dir, true)
+			if tt.wantPaths == nil {
+				if err != nil {
+					t.Errorf("verifyFromRemote() error = %v", err)
+				}
+				return
+			}
+
+			var checksumErr *ChecksumError
+			if !errors.As(err, &checksumErr) {
+				t.Fatalf("verifyFromRemote() error = %v, want *ChecksumError", err)
+			}
+			if len(checksumErr.Mismatches) != len(tt.wantPaths) {
+				t.Fatalf("Mismatches = %+v, want %v", checksumErr.Mismatches, tt.wantPaths)
+			}
+			for i, want := range tt.wantPaths {
+				if checksumErr.Mismatches[i].Path != want {
+					t.Errorf("Mismatches[%d].Path = %q, want %q", i, checksumErr.Mismatches[i].Path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadFile_StoresChecksumMetadata(t *testing.T) {
+	testFile := writeTempFile(t, []byte("hello"))
+
+	var metadata map[string]string
+	var body []byte
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			metadata = params.Metadata
+			var err error
+			body, err = io.ReadAll(params.Body)
+			return &s3.PutObjectOutput{}, err
+		},
+	}
+
+	uploaded := &uploadedChecksums{}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "hello", Options{checksums: uploaded}); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+	if metadata[checksumMetadataKey] != sha256Hex("hello") {
+		t.Errorf("Metadata[%s] = %q, want %q", checksumMetadataKey, metadata[checksumMetadataKey], sha256Hex("hello"))
+	}
+	if sum, _ := uploaded.lookup("hello"); sum != sha256Hex("hello") {
+		t.Errorf("Recorded checksum = %q, want %q", sum, sha256Hex("hello"))
+	}
+	if string(body) != "hello" {
+		t.Errorf("Uploaded body = %q, want the full file after hashing", body)
+	}
+}
+
+func TestExecuteToRemoteWithClients_ChecksumMismatch(t *testing.T) {
+	testFile := writeTempFile(t, []byte("test content"))
+
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		if strings.Contains(command, "sha256sum") {
+			return sha256Hex("truncated") + "  /tmp/large.bin\n"
+		}
+		return "/usr/bin/aws"
+	})
+
+	transferConfig := model.TransferConfig{
+		Source:        testFile,
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   "/tmp/large.bin",
+		BucketName:    "test-bucket",
+		MaxRetries:    0,
+		RetryDelay:    1,
+		Direction:     model.ToRemote,
+	}
+
+	err := ExecuteToRemoteWithClients(context.Background(), transferConfig, &mockS3Client{}, mockSSM)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("ExecuteToRemoteWithClients() error = %v, want *ChecksumError", err)
+	}
+	if checksumErr.Mismatches[0].Path != "i-1234567890abcdef0:/tmp/large.bin" {
+		t.Errorf("Mismatches[0].Path = %q", checksumErr.Mismatches[0].Path)
+	}
+}
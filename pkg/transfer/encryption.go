@@ -0,0 +1,421 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// Client-side encrypted objects start with a random nonce prefix followed
+// by the file in chunks of encryptionChunkSize bytes, each sealed with
+// AES-256-GCM under the nonce prefix || big-endian chunk index. Files are
+// cut into chunks so they can be encrypted without holding them in
+// memory and so instances can decrypt them with openssl, whose AES-CTR
+// mode produces the same keystream as GCM.
+const (
+	encryptionKeySize    = 32
+	encryptionPrefixSize = 8
+	encryptionChunkSize  = 1 << 20
+	gcmTagSize           = 16
+)
+
+// The data key of a transfer is derived from a random secret the way
+// openssl enc -pbkdf2 derives its key from a password, so instances can
+// decrypt with the secret read from a file instead of the key on their
+// command line. The secret is as strong as the key itself, so a single
+// PBKDF2 iteration under a fixed salt is enough.
+const (
+	encryptionSecretSize = 32
+	encryptionSalt       = "bcp-data"
+)
+
+// encryptionSecretValue is the journal value holding the hex-encoded
+// secret of a transfer, so that a resumed transfer can decrypt objects
+// staged before it was interrupted.
+const encryptionSecretValue = "encryption_secret"
+
+// keyExchangeBits is the size of the RSA key an instance generates to
+// receive the secret of a transfer.
+const keyExchangeBits = 3072
+
+// transferSecret returns the secret the data key of the transfer recorded
+// in j is derived from, generating one the first time. The secret is kept
+// only in the local journal and is never written to the bucket or sent
+// to an instance unwrapped.
+func transferSecret(j *journal.Journal) (string, error) {
+	if value := j.Value(encryptionSecretValue); value != "" {
+		if secret, err := hex.DecodeString(value); err == nil && len(secret) == encryptionSecretSize {
+			return value, nil
+		}
+		log.Warn("Ignoring invalid encryption secret in transfer journal")
+	}
+
+	secret := make([]byte, encryptionSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate encryption secret: %w", err)
+	}
+	value := hex.EncodeToString(secret)
+	logJournalError(j.SetValue(encryptionSecretValue, value))
+	return value, nil
+}
+
+// dataKey derives the AES-256 key files are encrypted with from secret.
+// It matches the key openssl enc -pbkdf2 -iter 1 -md sha256 derives from
+// secret as a password under the encryptionSalt salt.
+func dataKey(secret string) ([]byte, error) {
+	// openssl derives the IV along with the key
+	key, err := pbkdf2.Key(sha256.New, secret, []byte(encryptionSalt), 1, encryptionKeySize+aes.BlockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	return key[:encryptionKeySize], nil
+}
+
+// encryptedChunks returns the number of chunks a file of size bytes is
+// sealed in. Empty files are sealed as a single empty chunk so they are
+// authenticated too.
+func encryptedChunks(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + encryptionChunkSize - 1) / encryptionChunkSize
+}
+
+// alignToChunks rounds partSize up to a whole number of chunks, so every
+// part of a multipart upload can be encrypted on its own.
+func alignToChunks(partSize int64) int64 {
+	return (partSize + encryptionChunkSize - 1) / encryptionChunkSize * encryptionChunkSize
+}
+
+// objectCipher encrypts a single staged object.
+type objectCipher struct {
+	aead   cipher.AEAD
+	prefix []byte
+}
+
+// newObjectCipher returns a cipher for a new object encrypted with key,
+// under a random nonce prefix of its own.
+func newObjectCipher(key []byte) (*objectCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	prefix := make([]byte, encryptionPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return &objectCipher{aead: aead, prefix: prefix}, nil
+}
+
+// section returns a reader of the encrypted bytes of the length bytes of
+// file starting at offset, which must be a multiple of
+// encryptionChunkSize. The section starting at offset 0 begins with the
+// nonce prefix, so concatenating consecutive sections yields the whole
+// object.
+func (c *objectCipher) section(file io.ReaderAt, offset, length int64) *encryptingReader {
+	r := &encryptingReader{
+		cipher:     c,
+		file:       file,
+		offset:     offset,
+		length:     length,
+		chunkIndex: -1,
+	}
+	if offset == 0 {
+		r.header = encryptionPrefixSize
+	}
+	r.size = r.header + length + gcmTagSize*encryptedChunks(length)
+	return r
+}
+
+// encryptingReader reads the encrypted form of a section of a file,
+// sealing one chunk at a time. It implements io.Seeker so the AWS SDK can
+// rewind it to retry a request.
+type encryptingReader struct {
+	cipher *objectCipher
+	file   io.ReaderAt
+	// offset and length are the plaintext range of file this reads
+	offset, length int64
+	// header is the length of the nonce prefix the section starts with
+	header int64
+	// size is the encrypted length of the section
+	size int64
+	pos  int64
+
+	// chunk holds the sealed chunk at chunkIndex within the section
+	chunk      []byte
+	chunkIndex int64
+	plain      []byte
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.pos < r.header {
+		n := copy(p, r.cipher.prefix[r.pos:])
+		r.pos += int64(n)
+		return n, nil
+	}
+
+	rel := r.pos - r.header
+	index := rel / (encryptionChunkSize + gcmTagSize)
+	if err := r.seal(index); err != nil {
+		return 0, err
+	}
+
+	n := copy(p, r.chunk[rel%(encryptionChunkSize+gcmTagSize):])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// seal encrypts the chunk at index within the section into r.chunk.
+func (r *encryptingReader) seal(index int64) error {
+	if r.chunkIndex == index {
+		return nil
+	}
+
+	start := index * encryptionChunkSize
+	plainLen := min(encryptionChunkSize, r.length-start)
+	if cap(r.plain) < int(plainLen) {
+		r.plain = make([]byte, plainLen)
+	}
+	plain := r.plain[:plainLen]
+	// ReaderAt may report io.EOF along with the last bytes of the file
+	if n, err := r.file.ReadAt(plain, r.offset+start); err != nil && !(errors.Is(err, io.EOF) && int64(n) == plainLen) {
+		return fmt.Errorf("failed to read file for encryption: %w", err)
+	}
+
+	nonce := make([]byte, r.cipher.aead.NonceSize())
+	copy(nonce, r.cipher.prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionPrefixSize:], uint32((r.offset+start)/encryptionChunkSize))
+
+	r.chunk = r.cipher.aead.Seal(r.chunk[:0], nonce, plain, nil)
+	r.chunkIndex = index
+	return nil
+}
+
+func (r *encryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek to offset %d", offset)
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// decryptorCheckCommand succeeds on POSIX instances that can decrypt
+// client-side encrypted files: openssl must be recent enough to derive
+// keys with PBKDF2, and dd must support GNU's byte offsets.
+const decryptorCheckCommand = "command -v openssl && " +
+	"openssl enc -aes-256-ctr -pbkdf2 -pass pass:bcp -S 0000000000000000 -iv 00000000000000000000000000000000 < /dev/null > /dev/null 2>&1 && " +
+	"dd if=/dev/null of=/dev/null iflag=skip_bytes,count_bytes status=none"
+
+// requireDecryptor returns an error unless the instance can decrypt
+// client-side encrypted objects, which needs openssl 1.1.1 or later and
+// GNU dd on a POSIX instance.
+func requireDecryptor(ctx context.Context, host remoteHost) error {
+	if host.platform == platformWindows {
+		return fmt.Errorf("client-side encryption is not supported on Windows instance %s", host.id)
+	}
+
+	log.Info("Checking for openssl and GNU dd on instance %s...", host.id)
+	if _, err := host.run(ctx, decryptorCheckCommand); err != nil {
+		if strings.Contains(err.Error(), "command failed") {
+			return fmt.Errorf("client-side encryption requires openssl 1.1.1 or later and GNU dd on instance %s", host.id)
+		}
+		return fmt.Errorf("failed to check for openssl: %w", err)
+	}
+	return nil
+}
+
+// keyDirectory returns a new random path for the directory an instance
+// keeps its key exchange key and the unwrapped secret in.
+func keyDirectory() (string, error) {
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return "", fmt.Errorf("failed to generate key directory name: %w", err)
+	}
+	return "/tmp/bcp-key-" + hex.EncodeToString(name), nil
+}
+
+// keyExchangeCommand returns a shell command that creates dir, which must
+// not exist yet, readable only by its owner, generates an RSA key in it
+// and prints the PEM-encoded public key.
+func keyExchangeCommand(dir string) string {
+	return fmt.Sprintf(`d=%s; umask 077 && mkdir "$d" && `+
+		`openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:%d -out "$d/key" 2>/dev/null && `+
+		`openssl pkey -in "$d/key" -pubout`, shQuote(dir), keyExchangeBits)
+}
+
+// wrapSecret encrypts secret to the public key printed by
+// keyExchangeCommand with RSA-OAEP and returns it base64-encoded.
+func wrapSecret(output, secret string) (string, error) {
+	block, _ := pem.Decode([]byte(output))
+	if block == nil {
+		return "", fmt.Errorf("no public key in key exchange output")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("key exchange returned a %T key, want RSA", publicKey)
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, []byte(secret), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap encryption secret: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// unlockCommand returns a shell command that unwraps the secret in dir
+// with the key keyExchangeCommand generated there. A command sent to
+// several instances carries the secret wrapped for each of them, and each
+// instance keeps the one its key opens.
+func unlockCommand(dir string, wrapped []string) string {
+	quoted := make([]string, 0, len(wrapped))
+	for _, w := range wrapped {
+		quoted = append(quoted, shQuote(w))
+	}
+	return fmt.Sprintf(`d=%s; for w in %s; do printf %%s "$w" | openssl base64 -d -A | `+
+		`openssl pkeyutl -decrypt -inkey "$d/key" -pkeyopt rsa_padding_mode:oaep -pkeyopt rsa_oaep_md:sha256 -pkeyopt rsa_mgf1_md:sha256 -out "$d/unwrapped" 2>/dev/null && `+
+		`mv "$d/unwrapped" "$d/secret" && break; done; `+
+		`[ -s "$d/secret" ] || { echo "failed to unwrap the encryption secret" >&2; exit 1; }`,
+		shQuote(dir), strings.Join(quoted, " "))
+}
+
+// removeKeyCommand returns a shell command that deletes the key directory
+// dir.
+func removeKeyCommand(dir string) string {
+	return "rm -rf " + shQuote(dir)
+}
+
+// sha256Command returns a shell expression printing the hex-encoded
+// SHA-256 of the file at the shell variable named by variable.
+func sha256Command(variable string) string {
+	return fmt.Sprintf(`$(openssl dgst -sha256 -r < "$%s" | cut -c 1-64)`, variable)
+}
+
+// decryptCommand returns a shell command that decrypts the object
+// downloaded to remotePath in place, using the secret unwrapped into dir.
+// When intoDirectory is set and remotePath is an existing directory, the
+// file inside it named name is decrypted instead, mirroring where it was
+// downloaded to. Each chunk is decrypted with AES-CTR starting at the
+// counter GCM encrypts with. openssl cannot check the GCM tags, so the
+// plaintext is written to a temporary file that only replaces the object
+// once its SHA-256 matches sum, the hash of the source file. A file that
+// already matches sum was decrypted by an earlier attempt and is left
+// alone.
+func decryptCommand(remotePath, name string, intoDirectory bool, dir, sum string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "p=%s; ", shQuote(remotePath))
+	if intoDirectory {
+		fmt.Fprintf(&b, "[ -d \"$p\" ] && p=\"$p\"/%s; ", shQuote(name))
+	}
+	fmt.Fprintf(&b, `if [ "%s" != %s ]; then `, sha256Command("p"), sum)
+	fmt.Fprintf(&b, `d=%s; t="$p.bcp-decrypt"; : > "$t"; `, shQuote(dir))
+	fmt.Fprintf(&b, `n=$(head -c %d "$p" | od -An -tx1 | tr -d ' \n'); `, encryptionPrefixSize)
+	fmt.Fprintf(&b, `s=$(wc -c < "$p"); o=%d; i=0; `, encryptionPrefixSize)
+	fmt.Fprintf(&b, `while [ "$o" -lt "$s" ]; do l=$((s - o)); [ "$l" -gt %d ] && l=%d; `, encryptionChunkSize+gcmTagSize, encryptionChunkSize+gcmTagSize)
+	fmt.Fprintf(&b, `dd if="$p" iflag=skip_bytes,count_bytes skip="$o" count=$((l - %d)) bs=1M status=none | `, gcmTagSize)
+	fmt.Fprintf(&b, `openssl enc -d -aes-256-ctr -pbkdf2 -iter 1 -md sha256 -S %s -pass file:"$d/secret" -iv "$n$(printf %%08x "$i")00000002" >> "$t"; `, hex.EncodeToString([]byte(encryptionSalt)))
+	b.WriteString(`o=$((o + l)); i=$((i + 1)); done; `)
+	fmt.Fprintf(&b, `if [ "%s" != %s ]; then rm -f "$t"; echo "decrypted $p does not match the source file" >&2; exit 1; fi; `, sha256Command("t"), sum)
+	b.WriteString(`mv "$t" "$p"; fi`)
+	return b.String()
+}
+
+// remoteDecrypt has the instance decrypt the files downloaded to it in
+// place. The secret is sent wrapped with a key the instance generates for
+// the purpose, so neither it nor the data key appears in SSM's command
+// history, and the key and unwrapped secret are deleted again afterwards.
+// sums holds the SHA-256 of each source file by staged key.
+func remoteDecrypt(ctx context.Context, host remoteHost, transferConfig model.TransferConfig, files []presignedFile, secret string, sums map[string]string) error {
+	log.Info("Decrypting files on remote instance...")
+
+	dir, err := keyDirectory()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := host.run(ctx, removeKeyCommand(dir)); err != nil {
+			log.Warn("Failed to remove encryption keys from instance %s: %v", host.id, err)
+		}
+	}()
+
+	output, err := host.run(ctx, keyExchangeCommand(dir))
+	if err != nil {
+		return fmt.Errorf("failed to generate key exchange key: %w", err)
+	}
+	wrapped, err := wrapSecret(output, secret)
+	if err != nil {
+		return err
+	}
+	if _, err := host.run(ctx, unlockCommand(dir, []string{wrapped})); err != nil {
+		return fmt.Errorf("failed to send encryption secret: %w", err)
+	}
+
+	return runBatchedCommands(ctx, host, transferConfig, decryptCommands(transferConfig, files, dir, sums))
+}
+
+// decryptCommands returns a decryptCommand for each downloaded file.
+func decryptCommands(transferConfig model.TransferConfig, files []presignedFile, dir string, sums map[string]string) []string {
+	commands := make([]string, 0, len(files))
+	for _, file := range files {
+		commands = append(commands, decryptCommand(file.RemotePath, path.Base(file.Key), !transferConfig.IsDirectory, dir, sums[file.Key]))
+	}
+	return commands
+}
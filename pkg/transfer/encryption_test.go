@@ -0,0 +1,670 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// decryptObject decrypts a whole object encrypted by objectCipher with key,
+// verifying every chunk.
+func decryptObject(t *testing.T, key, object []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher() error = %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM() error = %v", err)
+	}
+	if len(object) < encryptionPrefixSize {
+		t.Fatalf("encrypted object is only %d bytes", len(object))
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, object[:encryptionPrefixSize])
+	object = object[encryptionPrefixSize:]
+
+	var plain []byte
+	for index := uint32(0); len(object) > 0 || index == 0; index++ {
+		n := min(len(object), encryptionChunkSize+gcmTagSize)
+		binary.BigEndian.PutUint32(nonce[encryptionPrefixSize:], index)
+		if plain, err = aead.Open(plain, nonce, object[:n], nil); err != nil {
+			t.Fatalf("failed to decrypt chunk %d: %v", index, err)
+		}
+		object = object[n:]
+	}
+	return plain
+}
+
+// testContent returns size bytes of content that differs from chunk to
+// chunk.
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i*7 + i/encryptionChunkSize)
+	}
+	return content
+}
+
+func testEncryptionKey() []byte {
+	return bytes.Repeat([]byte{0x42}, encryptionKeySize)
+}
+
+// testSecret is a transfer secret for tests.
+const testSecret = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+
+// testKeyDirectory returns a key directory on this machine holding
+// testSecret, the way unlockCommand leaves it on an instance.
+func testKeyDirectory(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte(testSecret), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return dir
+}
+
+func TestObjectCipher_RoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, encryptionChunkSize, encryptionChunkSize + 1, 2*encryptionChunkSize + 5} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			content := testContent(size)
+			enc, err := newObjectCipher(testEncryptionKey())
+			if err != nil {
+				t.Fatalf("newObjectCipher() error = %v", err)
+			}
+
+			section := enc.section(bytes.NewReader(content), 0, int64(size))
+			encrypted, err := io.ReadAll(section)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+
+			if int64(len(encrypted)) != section.size {
+				t.Errorf("Read %d bytes, want section size %d", len(encrypted), section.size)
+			}
+			// Short plaintexts turn up in random ciphertext by chance
+			if size >= aes.BlockSize && bytes.Contains(encrypted, content) {
+				t.Error("Encrypted object contains the plaintext")
+			}
+			if got := decryptObject(t, testEncryptionKey(), encrypted); !bytes.Equal(got, content) {
+				t.Errorf("Decrypted %d bytes that do not match the %d byte original", len(got), size)
+			}
+		})
+	}
+}
+
+func TestObjectCipher_UniqueNonces(t *testing.T) {
+	content := testContent(100)
+	var objects [][]byte
+	for i := 0; i < 2; i++ {
+		enc, err := newObjectCipher(testEncryptionKey())
+		if err != nil {
+			t.Fatalf("newObjectCipher() error = %v", err)
+		}
+		encrypted, err := io.ReadAll(enc.section(bytes.NewReader(content), 0, int64(len(content))))
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		objects = append(objects, encrypted)
+	}
+
+	if bytes.Equal(objects[0], objects[1]) {
+		t.Error("Two objects with the same content and key encrypted identically")
+	}
+}
+
+func TestObjectCipher_SectionsConcatenate(t *testing.T) {
+	content := testContent(3*encryptionChunkSize + 10)
+	enc, err := newObjectCipher(testEncryptionKey())
+	if err != nil {
+		t.Fatalf("newObjectCipher() error = %v", err)
+	}
+
+	whole, err := io.ReadAll(enc.section(bytes.NewReader(content), 0, int64(len(content))))
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	var joined []byte
+	for offset := int64(0); offset < int64(len(content)); offset += 2 * encryptionChunkSize {
+		length := min(2*encryptionChunkSize, int64(len(content))-offset)
+		part, err := io.ReadAll(enc.section(bytes.NewReader(content), offset, length))
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		joined = append(joined, part...)
+	}
+
+	if !bytes.Equal(joined, whole) {
+		t.Error("Concatenated sections differ from the whole object")
+	}
+}
+
+func TestEncryptingReader_Seek(t *testing.T) {
+	content := testContent(encryptionChunkSize + 100)
+	enc, err := newObjectCipher(testEncryptionKey())
+	if err != nil {
+		t.Fatalf("newObjectCipher() error = %v", err)
+	}
+	section := enc.section(bytes.NewReader(content), 0, int64(len(content)))
+
+	first, err := io.ReadAll(section)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	if end, err := section.Seek(0, io.SeekEnd); err != nil || end != section.size {
+		t.Errorf("Seek(0, SeekEnd) = %d, %v, want %d", end, err, section.size)
+	}
+	if _, err := section.Seek(-10, io.SeekStart); err == nil {
+		t.Error("Seek to a negative offset succeeded")
+	}
+
+	if _, err := section.Seek(encryptionChunkSize, io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	tail, err := io.ReadAll(section)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(tail, first[encryptionChunkSize:]) {
+		t.Error("Reading after seeking back returned different bytes")
+	}
+}
+
+func TestTransferSecret(t *testing.T) {
+	j := newTestJournal(t, model.TransferConfig{Direction: model.ToRemote})
+
+	secret, err := transferSecret(j)
+	if err != nil {
+		t.Fatalf("transferSecret() error = %v", err)
+	}
+	if raw, err := hex.DecodeString(secret); err != nil || len(raw) != encryptionSecretSize {
+		t.Fatalf("transferSecret() = %q, want %d hex-encoded bytes", secret, encryptionSecretSize)
+	}
+
+	again, err := transferSecret(j)
+	if err != nil {
+		t.Fatalf("transferSecret() error = %v", err)
+	}
+	if again != secret {
+		t.Error("transferSecret() generated a new secret instead of reusing the journaled one")
+	}
+
+	other, err := transferSecret(nil)
+	if err != nil {
+		t.Fatalf("transferSecret(nil) error = %v", err)
+	}
+	if other == secret {
+		t.Error("transferSecret(nil) returned the secret of another transfer")
+	}
+}
+
+func TestDataKey(t *testing.T) {
+	key, err := dataKey(testSecret)
+	if err != nil {
+		t.Fatalf("dataKey() error = %v", err)
+	}
+	if len(key) != encryptionKeySize {
+		t.Fatalf("dataKey() returned a %d byte key, want %d", len(key), encryptionKeySize)
+	}
+
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	// openssl prints the key it derives for a password with -P
+	output, err := exec.Command("openssl", "enc", "-aes-256-ctr", "-pbkdf2", "-iter", "1", "-md", "sha256",
+		"-S", hex.EncodeToString([]byte(encryptionSalt)), "-pass", "pass:"+testSecret, "-P").Output()
+	if err != nil {
+		t.Fatalf("openssl enc -P failed: %v", err)
+	}
+	want := "key=" + strings.ToUpper(hex.EncodeToString(key))
+	if !strings.Contains(string(output), want) {
+		t.Errorf("openssl derived a different key:\n%s\nwant %s", output, want)
+	}
+}
+
+func TestUploadFile_ClientEncryption(t *testing.T) {
+	content := []byte("top secret")
+	testFile := writeTempFile(t, content)
+
+	var uploaded []byte
+	var metadata map[string]string
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			body, err := io.ReadAll(params.Body)
+			if err != nil {
+				return nil, err
+			}
+			uploaded, metadata = body, params.Metadata
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	opts := Options{EncryptionKey: testEncryptionKey()}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "secret.txt", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	if _, ok := metadata[checksumMetadataKey]; ok {
+		t.Error("Encrypted upload recorded the plaintext checksum in its metadata")
+	}
+	if got := decryptObject(t, testEncryptionKey(), uploaded); !bytes.Equal(got, content) {
+		t.Errorf("Decrypted upload = %q, want %q", got, content)
+	}
+}
+
+func TestUploadFile_ClientEncryptionMultipart(t *testing.T) {
+	content := testContent(2*encryptionChunkSize + encryptionChunkSize/2)
+	testFile := writeTempFile(t, content)
+
+	var mu sync.Mutex
+	received := make(map[int32][]byte)
+	mockS3 := &mockS3Client{
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			body, err := io.ReadAll(params.Body)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(body)) != aws.ToInt64(params.ContentLength) {
+				t.Errorf("Part %d: body length %d does not match ContentLength %d", aws.ToInt32(params.PartNumber), len(body), aws.ToInt64(params.ContentLength))
+			}
+			mu.Lock()
+			received[aws.ToInt32(params.PartNumber)] = body
+			mu.Unlock()
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+		},
+	}
+
+	// A part size below the chunk size is rounded up to whole chunks
+	opts := Options{Concurrency: 2, PartSize: 1000, MultipartThreshold: 1000, EncryptionKey: testEncryptionKey()}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(received))
+	}
+	var object []byte
+	for i := int32(1); i <= 3; i++ {
+		object = append(object, received[i]...)
+	}
+	if got := decryptObject(t, testEncryptionKey(), object); !bytes.Equal(got, content) {
+		t.Error("Decrypted multipart upload does not match the original")
+	}
+}
+
+func TestUploadFile_ClientEncryptionDiscardsJournaledUpload(t *testing.T) {
+	content := testContent(2 * encryptionChunkSize)
+	testFile := writeTempFile(t, content)
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	j := newTestJournal(t, model.TransferConfig{Direction: model.ToRemote})
+	if err := j.StartObject("large.bin", info.Size(), info.ModTime(), "old-upload", encryptionChunkSize); err != nil {
+		t.Fatalf("StartObject() error = %v", err)
+	}
+	if err := j.RecordPart("large.bin", 1, "etag-1"); err != nil {
+		t.Fatalf("RecordPart() error = %v", err)
+	}
+
+	var aborted []string
+	var partsSent int
+	mockS3 := &mockS3Client{
+		abortMPUFunc: func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+			aborted = append(aborted, aws.ToString(params.UploadId))
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			partsSent++
+			return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 1, PartSize: encryptionChunkSize, MultipartThreshold: 1, EncryptionKey: testEncryptionKey(), Journal: j}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	if len(aborted) != 1 || aborted[0] != "old-upload" {
+		t.Errorf("Aborted uploads = %v, want [old-upload]", aborted)
+	}
+	if partsSent != 2 {
+		t.Errorf("Sent %d parts, want all 2 parts sent again", partsSent)
+	}
+}
+
+func TestDecryptCommand(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	key, err := dataKey(testSecret)
+	if err != nil {
+		t.Fatalf("dataKey() error = %v", err)
+	}
+	keyDir := testKeyDirectory(t)
+
+	// encryptTo writes content encrypted under key into a file named
+	// like the staged one inside a destination directory
+	encryptTo := func(t *testing.T, content []byte) string {
+		t.Helper()
+		enc, err := newObjectCipher(key)
+		if err != nil {
+			t.Fatalf("newObjectCipher() error = %v", err)
+		}
+		encrypted, err := io.ReadAll(enc.section(bytes.NewReader(content), 0, int64(len(content))))
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+
+		dir := filepath.Join(t.TempDir(), "dest dir")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Mkdir() error = %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "it's secret.bin"), encrypted, 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return dir
+	}
+
+	for _, size := range []int{0, 10, encryptionChunkSize, 2*encryptionChunkSize + 3} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			content := testContent(size)
+			dir := encryptTo(t, content)
+
+			command := decryptCommand(dir, "it's secret.bin", true, keyDir, sha256Hex(string(content)))
+			if strings.Contains(command, testSecret) || strings.Contains(command, hex.EncodeToString(key)) {
+				t.Fatalf("decryptCommand() contains the encryption key: %s", command)
+			}
+			// The second run finds the file already decrypted
+			for range 2 {
+				if output, err := exec.Command("sh", "-c", command).CombinedOutput(); err != nil {
+					t.Fatalf("decrypt command failed: %v\n%s", err, output)
+				}
+			}
+
+			got, err := os.ReadFile(filepath.Join(dir, "it's secret.bin"))
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("Decrypted %d bytes that do not match the %d byte original", len(got), size)
+			}
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		content := testContent(100)
+		dir := encryptTo(t, content)
+		remotePath := filepath.Join(dir, "it's secret.bin")
+		encrypted, err := os.ReadFile(remotePath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		encrypted[encryptionPrefixSize] ^= 1
+		if err := os.WriteFile(remotePath, encrypted, 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+
+		command := decryptCommand(dir, "it's secret.bin", true, keyDir, sha256Hex(string(content)))
+		output, err := exec.Command("sh", "-c", command).CombinedOutput()
+		if err == nil || !strings.Contains(string(output), "does not match") {
+			t.Fatalf("decrypt command error = %v, output %q, want a mismatch", err, output)
+		}
+
+		// Unauthenticated plaintext never replaces the object
+		got, err := os.ReadFile(remotePath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if !bytes.Equal(got, encrypted) {
+			t.Error("Decrypt command replaced the object with unauthenticated plaintext")
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("Decrypt command left %d files in the destination, want only the object", len(entries))
+		}
+	})
+}
+
+func TestKeyExchange(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "key")
+
+	output, err := exec.Command("sh", "-c", keyExchangeCommand(dir)).Output()
+	if err != nil {
+		t.Fatalf("key exchange command failed: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("Key directory mode = %v (error %v), want 0700", info.Mode().Perm(), err)
+	}
+	wrapped, err := wrapSecret(string(output), testSecret)
+	if err != nil {
+		t.Fatalf("wrapSecret() error = %v", err)
+	}
+
+	// A fleet command carries the secret wrapped for other instances too
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	other, err := wrapSecret(testPublicKeyPEM(t, otherKey), testSecret)
+	if err != nil {
+		t.Fatalf("wrapSecret() error = %v", err)
+	}
+
+	command := unlockCommand(dir, []string{other, wrapped})
+	if strings.Contains(command, testSecret) {
+		t.Fatalf("unlockCommand() contains the secret: %s", command)
+	}
+	if output, err := exec.Command("sh", "-c", command).CombinedOutput(); err != nil {
+		t.Fatalf("unlock command failed: %v\n%s", err, output)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "secret"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(got) != testSecret {
+		t.Errorf("Unwrapped secret = %q, want %q", got, testSecret)
+	}
+
+	if output, err := exec.Command("sh", "-c", unlockCommand(filepath.Join(t.TempDir(), "none"), []string{other})).CombinedOutput(); err == nil {
+		t.Errorf("unlock command without a matching key succeeded: %s", output)
+	}
+
+	if err := exec.Command("sh", "-c", removeKeyCommand(dir)).Run(); err != nil {
+		t.Fatalf("remove key command failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Key directory still exists after removal: %v", err)
+	}
+}
+
+// testPublicKeyPEM returns the public half of key the way openssl pkey
+// -pubout prints it.
+func testPublicKeyPEM(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestRequireDecryptor(t *testing.T) {
+	windows := remoteHost{client: &mockSSMClient{}, id: "i-1234567890abcdef0", platform: platformWindows}
+	if err := requireDecryptor(context.Background(), windows); err == nil || !strings.Contains(err.Error(), "Windows") {
+		t.Errorf("requireDecryptor() on Windows error = %v, want an unsupported platform error", err)
+	}
+
+	withoutOpenSSL, _ := toolSSMClient([]string{"curl"}, nil)
+	if err := requireDecryptor(context.Background(), linuxHost(withoutOpenSSL)); err == nil || !strings.Contains(err.Error(), "requires openssl") {
+		t.Errorf("requireDecryptor() without openssl error = %v, want a missing openssl error", err)
+	}
+
+	withOpenSSL, sent := toolSSMClient([]string{"openssl"}, nil)
+	if err := requireDecryptor(context.Background(), linuxHost(withOpenSSL)); err != nil {
+		t.Errorf("requireDecryptor() error = %v", err)
+	}
+	if len(*sent) != 1 || !strings.Contains((*sent)[0], "iflag=skip_bytes,count_bytes") {
+		t.Errorf("requireDecryptor() sent %q, want a check for GNU dd", *sent)
+	}
+}
+
+func TestExecuteToRemoteWithClients_ClientEncryption(t *testing.T) {
+	content := []byte("top secret")
+	testFile := writeTempFile(t, content)
+
+	var uploaded []byte
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			body, err := io.ReadAll(params.Body)
+			if err != nil {
+				return nil, err
+			}
+			uploaded = body
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+	exchangeKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	mockSSM, sent := toolSSMClient([]string{"aws", "openssl"}, func(command string) string {
+		switch {
+		case strings.Contains(command, "genpkey"):
+			return testPublicKeyPEM(t, exchangeKey)
+		case strings.Contains(command, "sha256sum"):
+			return sha256Hex(string(content)) + "  /tmp/large.bin\n"
+		}
+		return ""
+	})
+
+	j := newTestJournal(t, model.TransferConfig{Direction: model.ToRemote})
+	transferConfig := model.TransferConfig{
+		Source:           testFile,
+		SSMInstanceID:    "i-1234567890abcdef0",
+		Destination:      "/tmp/large.bin",
+		BucketName:       "test-bucket",
+		MaxRetries:       1,
+		RetryDelay:       0,
+		Direction:        model.ToRemote,
+		ClientEncryption: true,
+	}
+	if err := executeToRemote(context.Background(), transferConfig, mockS3, mockSSM, j); err != nil {
+		t.Fatalf("executeToRemote() error = %v", err)
+	}
+
+	secret := j.Value(encryptionSecretValue)
+	key, err := dataKey(secret)
+	if err != nil {
+		t.Fatalf("dataKey() error = %v", err)
+	}
+	if got := decryptObject(t, key, uploaded); !bytes.Equal(got, content) {
+		t.Errorf("Decrypted upload = %q, want %q", got, content)
+	}
+
+	var unlocked, decrypted, removed bool
+	for _, command := range *sent {
+		if strings.Contains(command, secret) || strings.Contains(command, hex.EncodeToString(key)) {
+			t.Errorf("Command sent to the instance contains the encryption key: %s", command)
+		}
+		switch {
+		case strings.Contains(command, "pkeyutl -decrypt"):
+			unlocked = unwrapsTo(t, exchangeKey, command, secret)
+		case strings.Contains(command, "openssl enc -d"):
+			decrypted = strings.Contains(command, sha256Hex(string(content)))
+		case strings.HasPrefix(command, "rm -rf /tmp/bcp-key-"):
+			removed = true
+		}
+	}
+	if !unlocked {
+		t.Errorf("The secret was not sent wrapped for the instance's key, sent %q", *sent)
+	}
+	if !decrypted {
+		t.Errorf("No decrypt command checking the source checksum was sent, sent %q", *sent)
+	}
+	if !removed {
+		t.Errorf("The key directory was not removed from the instance, sent %q", *sent)
+	}
+}
+
+// unwrapsTo reports whether the unlock command carries secret wrapped for
+// key.
+func unwrapsTo(t *testing.T, key *rsa.PrivateKey, command, secret string) bool {
+	t.Helper()
+	for _, field := range strings.Fields(command) {
+		wrapped, err := base64.StdEncoding.DecodeString(strings.Trim(field, "';"))
+		if err != nil || len(wrapped) != key.Size() {
+			continue
+		}
+		if plain, err := rsa.DecryptOAEP(sha256.New(), nil, key, wrapped, nil); err == nil && string(plain) == secret {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExecuteFromRemoteWithClients_ClientEncryptionUnsupported(t *testing.T) {
+	transferConfig := model.TransferConfig{
+		Source:           "/tmp/file.txt",
+		SSMInstanceID:    "i-1234567890abcdef0",
+		Destination:      t.TempDir(),
+		BucketName:       "test-bucket",
+		Direction:        model.FromRemote,
+		ClientEncryption: true,
+	}
+	err := ExecuteFromRemoteWithClients(context.Background(), transferConfig, &mockS3Client{}, &mockSSMClient{})
+	if err == nil || !strings.Contains(err.Error(), "only supported for transfers to a remote instance") {
+		t.Errorf("ExecuteFromRemoteWithClients() error = %v, want an unsupported direction error", err)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// ephemeralBucketPrefix starts the name of every bucket bcp creates for a
+// single transfer.
+const ephemeralBucketPrefix = "bcp-ephemeral-"
+
+// ephemeralExpireDays is how long objects may stay in an ephemeral bucket
+// if bcp dies before deleting it.
+const ephemeralExpireDays = 1
+
+// EphemeralDir overrides the directory ephemeral buckets are recorded in.
+// When empty, records live in $HOME/.bcp/buckets.
+var EphemeralDir string
+
+// EphemeralBucket records a bucket bcp created for a single transfer, so
+// it can be found and deleted if bcp dies before deleting it.
+type EphemeralBucket struct {
+	Bucket     string    `json:"bucket"`
+	Region     string    `json:"region"`
+	TransferID string    `json:"transfer_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EphemeralBucketName returns the name of the ephemeral bucket for the
+// transfer with the given ID.
+func EphemeralBucketName(transferID string) string {
+	return ephemeralBucketPrefix + transferID
+}
+
+// ephemeralDirectory returns the directory ephemeral buckets are recorded
+// in.
+func ephemeralDirectory() (string, error) {
+	if EphemeralDir != "" {
+		return EphemeralDir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".bcp", "buckets"), nil
+}
+
+// ephemeralRecordPath returns the path bucketName is recorded at.
+func ephemeralRecordPath(bucketName string) (string, error) {
+	dir, err := ephemeralDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, bucketName+".json"), nil
+}
+
+// recordEphemeralBucket writes the record of bucket to disk.
+func recordEphemeralBucket(bucket EphemeralBucket) error {
+	path, err := ephemeralRecordPath(bucket.Bucket)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create bucket record directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(bucket, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bucket record: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write bucket record: %w", err)
+	}
+	return nil
+}
+
+// removeEphemeralRecord deletes the record of bucketName, if any.
+func removeEphemeralRecord(bucketName string) error {
+	path, err := ephemeralRecordPath(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove bucket record: %w", err)
+	}
+	return nil
+}
+
+// ListEphemeralBuckets returns the recorded ephemeral buckets that have
+// not been deleted yet, oldest first.
+func ListEphemeralBuckets() ([]EphemeralBucket, error) {
+	dir, err := ephemeralDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bucket records: %w", err)
+	}
+
+	buckets := make([]EphemeralBucket, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bucket record: %w", err)
+		}
+
+		var bucket EphemeralBucket
+		if err := json.Unmarshal(data, &bucket); err != nil {
+			return nil, fmt.Errorf("failed to parse bucket record %s: %w", path, err)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	sort.Slice(buckets, func(a, b int) bool {
+		return buckets[a].CreatedAt.Before(buckets[b].CreatedAt)
+	})
+
+	return buckets, nil
+}
+
+// createEphemeralBucket records and then creates a locked-down bucket,
+// reporting whether it was created or already existed because the
+// transfer is being resumed. The bucket is recorded first so it can still
+// be found if bcp dies while creating it. On failure, nothing is left
+// behind: a bucket that could not be set up is deleted again, and a
+// bucket that could not be created, which may belong to someone else, is
+// left alone.
+func createEphemeralBucket(ctx context.Context, client EphemeralBucketAPI, bucket EphemeralBucket) (bool, error) {
+	bucket.CreatedAt = time.Now().UTC()
+	if err := recordEphemeralBucket(bucket); err != nil {
+		return false, err
+	}
+
+	log.Info("Creating ephemeral bucket %s in %s...", bucket.Bucket, bucket.Region)
+	created, err := createBucket(ctx, client, bucket.Bucket, bucket.Region)
+	if err != nil {
+		if err := removeEphemeralRecord(bucket.Bucket); err != nil {
+			log.Warn("%v", err)
+		}
+		return false, fmt.Errorf("failed to create ephemeral bucket: %w", err)
+	}
+
+	if err := configureBucket(ctx, client, bucket.Bucket, ephemeralExpireDays); err != nil {
+		if deleteErr := DeleteEphemeralBucket(ctx, client, bucket); deleteErr != nil {
+			log.Warn("%v", deleteErr)
+		}
+		return false, fmt.Errorf("failed to set up ephemeral bucket: %w", err)
+	}
+	return created, nil
+}
+
+// DeleteEphemeralBucket deletes bucket along with everything in it and
+// removes its record. A bucket that no longer exists is not an error. It
+// runs without ctx's cancellation so that interrupted transfers are
+// cleaned up too.
+func DeleteEphemeralBucket(ctx context.Context, client EphemeralBucketAPI, bucket EphemeralBucket) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	log.Info("Deleting ephemeral bucket %s...", bucket.Bucket)
+	err := CleanupS3Objects(ctx, client, bucket.Bucket, "", true)
+	if err == nil {
+		_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket.Bucket)})
+	}
+	if err != nil && !isNoSuchBucket(err) {
+		return fmt.Errorf("failed to delete ephemeral bucket %s: %w", bucket.Bucket, err)
+	}
+
+	return removeEphemeralRecord(bucket.Bucket)
+}
+
+// sweepEphemeralBuckets deletes the recorded ephemeral buckets in region
+// whose transfers can no longer be resumed, which bcp died before
+// deleting.
+func sweepEphemeralBuckets(ctx context.Context, client EphemeralBucketAPI, region string) {
+	buckets, err := ListEphemeralBuckets()
+	if err != nil {
+		log.Warn("Failed to list ephemeral buckets: %v", err)
+		return
+	}
+	journals, err := journal.List()
+	if err != nil {
+		log.Warn("Failed to list transfers: %v", err)
+		return
+	}
+
+	// Transfers that can still be resumed delete their buckets themselves
+	resumable := make(map[string]bool, len(journals))
+	for _, j := range journals {
+		resumable[j.ID] = true
+	}
+
+	for _, bucket := range buckets {
+		if bucket.Region != region || resumable[bucket.TransferID] {
+			continue
+		}
+
+		log.Info("Deleting ephemeral bucket %s left behind by transfer %s", bucket.Bucket, bucket.TransferID)
+		if err := DeleteEphemeralBucket(ctx, client, bucket); err != nil {
+			log.Warn("%v", err)
+		}
+	}
+}
+
+// isNoSuchBucket reports whether err means the bucket does not exist.
+func isNoSuchBucket(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchBucket"
+}
@@ -0,0 +1,283 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// mockEphemeralClient stages objects through mockS3Client and configures
+// buckets through mockBucketClient.
+type mockEphemeralClient struct {
+	*mockS3Client
+	*mockBucketClient
+}
+
+// useEphemeralDir records ephemeral buckets in a temporary directory for
+// the rest of the test.
+func useEphemeralDir(t *testing.T) {
+	t.Helper()
+
+	orig := EphemeralDir
+	EphemeralDir = t.TempDir()
+	t.Cleanup(func() { EphemeralDir = orig })
+}
+
+func TestEphemeralBucketName(t *testing.T) {
+	name := EphemeralBucketName("20250101t120000-1a2b3c4d")
+	if name != "bcp-ephemeral-20250101t120000-1a2b3c4d" {
+		t.Errorf("EphemeralBucketName() = %q", name)
+	}
+}
+
+func TestEphemeralBucketRecords(t *testing.T) {
+	useEphemeralDir(t)
+
+	for _, bucket := range []EphemeralBucket{
+		{Bucket: "bcp-ephemeral-b", Region: "us-east-1", TransferID: "b"},
+		{Bucket: "bcp-ephemeral-a", Region: "eu-west-1", TransferID: "a"},
+	} {
+		if err := recordEphemeralBucket(bucket); err != nil {
+			t.Fatalf("recordEphemeralBucket() error = %v", err)
+		}
+	}
+
+	if err := removeEphemeralRecord("bcp-ephemeral-b"); err != nil {
+		t.Fatalf("removeEphemeralRecord() error = %v", err)
+	}
+	if err := removeEphemeralRecord("bcp-ephemeral-missing"); err != nil {
+		t.Errorf("removeEphemeralRecord() of a missing record error = %v", err)
+	}
+
+	buckets, err := ListEphemeralBuckets()
+	if err != nil {
+		t.Fatalf("ListEphemeralBuckets() error = %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Bucket != "bcp-ephemeral-a" || buckets[0].Region != "eu-west-1" {
+		t.Errorf("ListEphemeralBuckets() = %+v, want only bcp-ephemeral-a", buckets)
+	}
+}
+
+func TestDeleteEphemeralBucket_AlreadyGone(t *testing.T) {
+	useEphemeralDir(t)
+
+	bucket := EphemeralBucket{Bucket: "bcp-ephemeral-gone", Region: "us-east-1", TransferID: "gone"}
+	if err := recordEphemeralBucket(bucket); err != nil {
+		t.Fatalf("recordEphemeralBucket() error = %v", err)
+	}
+
+	client := mockEphemeralClient{
+		mockS3Client: &mockS3Client{
+			listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				return nil, &s3types.NoSuchBucket{}
+			},
+		},
+		mockBucketClient: &mockBucketClient{},
+	}
+
+	if err := DeleteEphemeralBucket(context.Background(), client, bucket); err != nil {
+		t.Fatalf("DeleteEphemeralBucket() error = %v", err)
+	}
+	if buckets, _ := ListEphemeralBuckets(); len(buckets) != 0 {
+		t.Errorf("records = %+v, want the record removed", buckets)
+	}
+}
+
+func TestSweepEphemeralBuckets(t *testing.T) {
+	useEphemeralDir(t)
+	j := newTestJournal(t, model.TransferConfig{TransferID: "resumable"})
+
+	for _, bucket := range []EphemeralBucket{
+		{Bucket: "bcp-ephemeral-resumable", Region: "us-east-1", TransferID: j.ID},
+		{Bucket: "bcp-ephemeral-orphaned", Region: "us-east-1", TransferID: "orphaned"},
+		{Bucket: "bcp-ephemeral-elsewhere", Region: "eu-west-1", TransferID: "elsewhere"},
+	} {
+		if err := recordEphemeralBucket(bucket); err != nil {
+			t.Fatalf("recordEphemeralBucket() error = %v", err)
+		}
+	}
+
+	bucketClient := &mockBucketClient{}
+	sweepEphemeralBuckets(context.Background(), mockEphemeralClient{&mockS3Client{}, bucketClient}, "us-east-1")
+
+	if len(bucketClient.deleted) != 1 || bucketClient.deleted[0] != "bcp-ephemeral-orphaned" {
+		t.Errorf("deleted buckets = %v, want only bcp-ephemeral-orphaned", bucketClient.deleted)
+	}
+	buckets, err := ListEphemeralBuckets()
+	if err != nil {
+		t.Fatalf("ListEphemeralBuckets() error = %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Errorf("records = %+v, want the resumable and other-region buckets kept", buckets)
+	}
+}
+
+func TestExecuteEphemeral(t *testing.T) {
+	tests := []struct {
+		name        string
+		keepStaged  bool
+		failCopy    bool
+		wantDeleted bool
+	}{
+		{"success", false, false, true},
+		{"failure", false, true, true},
+		{"keep staged on success", true, false, true},
+		{"keep staged on failure", true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEphemeralDir(t)
+			testFile := writeTempFile(t, []byte("test content"))
+			j := newTestJournal(t, model.TransferConfig{
+				TransferID:      "transfer-1",
+				Source:          testFile,
+				SSMInstanceID:   "i-1234567890abcdef0",
+				Destination:     "/opt/app/large.bin",
+				BucketName:      EphemeralBucketName("transfer-1"),
+				Direction:       model.ToRemote,
+				KeepStaged:      tt.keepStaged,
+				EphemeralBucket: true,
+			})
+
+			bucketClient := &mockBucketClient{}
+			client := mockEphemeralClient{&mockS3Client{}, bucketClient}
+			ssmClient := commandOutputSSMClient(func(command string) string {
+				if strings.Contains(command, "sha256sum") {
+					return sha256Hex("test content") + "  /opt/app/large.bin\n"
+				}
+				return "/usr/bin/aws"
+			})
+			if tt.failCopy {
+				ssmClient.getCommandInvocationFunc = func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					return &ssm.GetCommandInvocationOutput{Status: types.CommandInvocationStatusFailed}, nil
+				}
+			}
+
+			err := executeEphemeral(context.Background(), j, client, ssmClient, "eu-west-1")
+			if (err != nil) != tt.failCopy {
+				t.Fatalf("executeEphemeral() error = %v, wantErr %v", err, tt.failCopy)
+			}
+
+			if bucketClient.create == nil || aws.ToString(bucketClient.create.Bucket) != "bcp-ephemeral-transfer-1" {
+				t.Fatal("Expected the ephemeral bucket to be created")
+			}
+			if got := bucketClient.create.CreateBucketConfiguration.LocationConstraint; got != "eu-west-1" {
+				t.Errorf("LocationConstraint = %q, want eu-west-1", got)
+			}
+
+			buckets, err := ListEphemeralBuckets()
+			if err != nil {
+				t.Fatalf("ListEphemeralBuckets() error = %v", err)
+			}
+			if tt.wantDeleted {
+				if len(bucketClient.deleted) != 1 || len(buckets) != 0 {
+					t.Errorf("deleted buckets = %v, records = %+v, want the bucket deleted", bucketClient.deleted, buckets)
+				}
+			} else if len(bucketClient.deleted) != 0 || len(buckets) != 1 {
+				t.Errorf("deleted buckets = %v, records = %+v, want the bucket kept", bucketClient.deleted, buckets)
+			}
+
+			_, loadErr := journal.Load(j.ID)
+			if (loadErr == nil) != (tt.failCopy && tt.keepStaged) {
+				t.Errorf("journal.Load() error = %v, want the journal kept only after a failure that kept its bucket", loadErr)
+			}
+		})
+	}
+}
+
+func TestExecuteEphemeral_CreateFailure(t *testing.T) {
+	useEphemeralDir(t)
+	j := newTestJournal(t, model.TransferConfig{
+		TransferID:      "transfer-1",
+		BucketName:      EphemeralBucketName("transfer-1"),
+		Direction:       model.ToRemote,
+		EphemeralBucket: true,
+	})
+
+	bucketClient := &mockBucketClient{createErr: &s3types.BucketAlreadyExists{}}
+	err := executeEphemeral(context.Background(), j, mockEphemeralClient{&mockS3Client{}, bucketClient}, &mockSSMClient{}, "us-east-1")
+
+	var exists *s3types.BucketAlreadyExists
+	if !errors.As(err, &exists) {
+		t.Errorf("executeEphemeral() error = %v, want BucketAlreadyExists", err)
+	}
+	if len(bucketClient.deleted) != 0 {
+		t.Errorf("deleted buckets = %v, want a bucket bcp did not create left alone", bucketClient.deleted)
+	}
+	if buckets, _ := ListEphemeralBuckets(); len(buckets) != 0 {
+		t.Errorf("records = %+v, want the record removed", buckets)
+	}
+}
+
+func TestExecuteEphemeral_ResumeKeepsProgress(t *testing.T) {
+	useEphemeralDir(t)
+	testFile := writeTempFile(t, []byte("test content"))
+	j := newTestJournal(t, model.TransferConfig{
+		TransferID:      "transfer-1",
+		Source:          testFile,
+		SSMInstanceID:   "i-1234567890abcdef0",
+		Destination:     "/opt/app/large.bin",
+		BucketName:      EphemeralBucketName("transfer-1"),
+		Direction:       model.ToRemote,
+		EphemeralBucket: true,
+	})
+	if err := j.MarkPhase(journal.PhaseUpload); err != nil {
+		t.Fatalf("MarkPhase() error = %v", err)
+	}
+
+	var puts int
+	s3Client := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			puts++
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+	// In us-east-1, CreateBucket succeeds again for the bucket the
+	// interrupted attempt created
+	bucketClient := &mockBucketClient{exists: true}
+	ssmClient := commandOutputSSMClient(func(command string) string {
+		if strings.Contains(command, "sha256sum") {
+			return sha256Hex("test content") + "  /opt/app/large.bin\n"
+		}
+		return "/usr/bin/aws"
+	})
+
+	if err := executeEphemeral(context.Background(), j, mockEphemeralClient{s3Client, bucketClient}, ssmClient, "us-east-1"); err != nil {
+		t.Fatalf("executeEphemeral() error = %v", err)
+	}
+	if puts != 0 {
+		t.Errorf("Uploaded %d object(s) again, want the completed upload phase kept", puts)
+	}
+}
@@ -0,0 +1,531 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// InstanceResult is the outcome of a fan-out transfer on one instance.
+type InstanceResult struct {
+	InstanceID string
+	// Err is why the transfer failed on the instance, or nil if it
+	// succeeded
+	Err error
+}
+
+// ExecuteFanOut copies the transfer source to every instance in
+// transferConfig.InstanceIDs. The source is staged in S3 once and each
+// step is sent to all instances together, as one SSM command per 50 of
+// them. An instance that fails a step drops out while the others carry
+// on, and the outcome on each instance is returned in order of instance
+// ID. The error is only set when the transfer failed as a whole. Fan-out
+// transfers are not journaled, so they cannot be resumed.
+func ExecuteFanOut(ctx context.Context, transferConfig model.TransferConfig) ([]InstanceResult, error) {
+	if transferConfig.EphemeralBucket {
+		return nil, fmt.Errorf("ephemeral buckets are not supported when copying to several instances")
+	}
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = journal.NewID()
+	}
+	log.Info("Transfer ID: %s", transferConfig.TransferID)
+
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	s3Client, region := BucketClient(ctx, clients, transferConfig.BucketName)
+	transferConfig.BucketRegion = region
+	warnCrossRegion(transferConfig.BucketName, region, clients.Region())
+	return executeFanOut(ctx, transferConfig, s3Client, clients.SSM())
+}
+
+// executeFanOut performs a fan-out transfer using the provided AWS
+// clients.
+func executeFanOut(ctx context.Context, transferConfig model.TransferConfig, s3Client S3API, ssmClient SSMAPI) (results []InstanceResult, err error) {
+	log.Info("Starting transfer from %s to %s on %d instances", transferConfig.Source, transferConfig.Destination, len(transferConfig.InstanceIDs))
+
+	if transferConfig.Direction == model.FromRemote {
+		return nil, fmt.Errorf("copying from several instances is not supported")
+	}
+
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = journal.NewID()
+	}
+
+	keyPrefix := stagingPrefix(transferConfig.TransferID)
+	staged, err := stagedFiles(transferConfig.Source, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	s3URL := fmt.Sprintf("s3://%s/%s", transferConfig.BucketName, stagedRoot(staged, keyPrefix, transferConfig.IsDirectory))
+
+	defer func() {
+		if !transferConfig.KeepStaged {
+			cleanupStaged(ctx, s3Client, transferConfig.BucketName, nil, err, func(ctx context.Context) error {
+				return deleteStagedFiles(ctx, s3Client, transferConfig.BucketName, staged)
+			})
+		}
+	}()
+
+	f, err := connectFleet(ctx, ssmClient, s3Client, transferConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := optionsFromConfig(transferConfig)
+	opts.checksums = &uploadedChecksums{}
+	var secret string
+	if transferConfig.ClientEncryption {
+		if err := f.requireDecryptor(ctx); err != nil {
+			return nil, err
+		}
+		if secret, err = transferSecret(nil); err != nil {
+			return nil, err
+		}
+		if opts.EncryptionKey, err = dataKey(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.active()) == 0 {
+		log.Warn("None of the instances can be copied to, skipping the upload")
+		return f.results(), nil
+	}
+
+	log.Info("Uploading %s to S3 bucket %s...", transferConfig.Source, transferConfig.BucketName)
+	if err := retryOperation(ctx, func() error {
+		return UploadToS3WithOptions(ctx, s3Client, transferConfig.BucketName, transferConfig.Source, keyPrefix, opts)
+	}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
+		return nil, fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	log.Info("Upload to S3 completed successfully")
+
+	tool, err := f.selectTool(ctx, transferConfig.RemoteTransport)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Downloading from S3 to %d remote instance(s)...", len(f.active()))
+	if err := f.download(ctx, s3Client, transferConfig, tool, s3URL, staged); err != nil {
+		return nil, fmt.Errorf("failed to download from S3 to remote instances: %w", err)
+	}
+
+	sums, err := stagedChecksums(staged, opts.checksums)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute local checksums: %w", err)
+	}
+	if secret != "" {
+		if err := f.decrypt(ctx, transferConfig, remoteFiles(f.platform, transferConfig, staged), secret, sums); err != nil {
+			return nil, fmt.Errorf("failed to decrypt files on remote instances: %w", err)
+		}
+	}
+
+	if err := f.verify(ctx, transferConfig, expectedChecksums(staged, sums)); err != nil {
+		return nil, err
+	}
+
+	return f.results(), nil
+}
+
+// fleet is the set of instances a fan-out transfer copies to. Each step
+// runs the same commands on all of them, so they must share a platform. Instances drop out of the transfer at the first step that
+// fails on them.
+type fleet struct {
+	client   SSMAPI
+	ids      []string
+	platform remotePlatform
+	// timeout bounds how long each command may run; zero uses
+	// defaultCommandTimeout
+	timeout time.Duration
+	// output is where SSM writes the full output of commands, if set
+	output *commandOutputStore
+	// failed holds why each instance that dropped out failed
+	failed map[string]error
+}
+
+// connectFleet returns the fleet of transferConfig.InstanceIDs, looking
+// up their platforms from SSM's inventory of managed instances. Instances
+// that SSM cannot reach right now are failed straight away.
+func connectFleet(ctx context.Context, client SSMAPI, s3Client S3API, transferConfig model.TransferConfig) (*fleet, error) {
+	f := &fleet{
+		client:  client,
+		ids:     slices.Sorted(slices.Values(transferConfig.InstanceIDs)),
+		timeout: time.Duration(transferConfig.CommandTimeout) * time.Second,
+		output: &commandOutputStore{
+			client: s3Client,
+			bucket: transferConfig.BucketName,
+			prefix: commandOutputPrefix(transferConfig.TransferID),
+		},
+		failed: make(map[string]error),
+	}
+
+	infos := make(map[string]types.InstanceInformation, len(f.ids))
+	for batch := range slices.Chunk(f.ids, maxCommandInstances) {
+		paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{
+			Filters: []types.InstanceInformationStringFilter{
+				{Key: aws.String("InstanceIds"), Values: batch},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe instances: %w", err)
+			}
+			for _, info := range page.InstanceInformationList {
+				infos[aws.ToString(info.InstanceId)] = info
+			}
+		}
+	}
+
+	var first string
+	for _, id := range f.ids {
+		info, ok := infos[id]
+		if !ok {
+			f.fail(id, fmt.Errorf("instance is not managed by SSM"))
+			continue
+		}
+		if info.PingStatus != types.PingStatusOnline {
+			f.fail(id, fmt.Errorf("SSM agent is %s", info.PingStatus))
+			continue
+		}
+
+		platform := platformPOSIX
+		if info.PlatformType == types.PlatformTypeWindows {
+			platform = platformWindows
+		}
+		if first == "" {
+			first, f.platform = id, platform
+		} else if platform != f.platform {
+			return nil, fmt.Errorf("instances %s and %s run different platforms; copy to Linux and Windows instances separately", first, id)
+		}
+	}
+	return f, nil
+}
+
+// active returns the instances that have not failed, in order.
+func (f *fleet) active() []string {
+	var ids []string
+	for _, id := range f.ids {
+		if _, failed := f.failed[id]; !failed {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// fail drops id from the transfer because of err.
+func (f *fleet) fail(id string, err error) {
+	log.Warn("Transfer to instance %s failed: %v", id, err)
+	f.failed[id] = err
+}
+
+// results returns the outcome of the transfer on every instance.
+func (f *fleet) results() []InstanceResult {
+	results := make([]InstanceResult, 0, len(f.ids))
+	for _, id := range f.ids {
+		results = append(results, InstanceResult{InstanceID: id, Err: f.failed[id]})
+	}
+	return results
+}
+
+// run sends commands to every active instance with runSSMDocument and
+// waits for each invocation to finish, returning the standard output of
+// the instances it succeeded on. Instances it fails or times out on are
+// dropped from the transfer; an error is only returned when the command
+// could not be sent or was interrupted.
+func (f *fleet) run(ctx context.Context, commands ...string) (map[string]string, error) {
+	ids := f.active()
+	outputs := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return outputs, nil
+	}
+
+	timeout := f.timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	results, err := runSSMDocument(ctx, f.client, ids, f.platform.document(), commands, timeout, f.output)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if result := results[id]; result.err != nil {
+			f.fail(id, result.err)
+		} else {
+			outputs[id] = result.output
+		}
+	}
+	return outputs, nil
+}
+
+// runBatched sends per-file commands to the fleet in batches of
+// commandBatchSize, stopping each instance at the first command that
+// fails on it.
+func (f *fleet) runBatched(ctx context.Context, commands []string) error {
+	return f.runBatches(ctx, len(commands), func(i int) (string, error) {
+		return commands[i], nil
+	})
+}
+
+// runBatches sends the commands build returns for count files to the
+// fleet the way runBatched does, building each batch just before it is
+// sent so that the presigned URLs in it are fresh.
+func (f *fleet) runBatches(ctx context.Context, count int, build func(i int) (string, error)) error {
+	for start := 0; start < count; start += commandBatchSize {
+		end := min(start+commandBatchSize, count)
+		log.Debug("Running commands for files %d-%d of %d", start+1, end, count)
+		batch, err := buildBatch(f.platform, start, end, build)
+		if err != nil {
+			return err
+		}
+		if _, err := f.run(ctx, batch...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectTool picks the tool the fleet uses to reach S3 for the given
+// transport mode. Every instance runs the same commands, so the tool
+// installed on the most instances is used, preferring the AWS CLI, and
+// the instances without it are failed.
+func (f *fleet) selectTool(ctx context.Context, mode model.RemoteTransport) (remoteTool, error) {
+	if len(f.active()) == 0 {
+		return "", nil
+	}
+
+	log.Info("Checking which tools the remote instances can reach S3 with...")
+	outputs, err := f.run(ctx, f.platform.toolsCommand())
+	if err != nil {
+		return "", fmt.Errorf("failed to check for tools on remote instances: %w", err)
+	}
+
+	installed := make(map[remoteTool][]string)
+	for _, id := range f.active() {
+		for _, tool := range installedTools(f.platform, outputs[id]) {
+			installed[tool] = append(installed[tool], id)
+		}
+	}
+
+	candidates := fanOutTools(f.platform, mode)
+	var tool remoteTool
+	for _, candidate := range candidates {
+		if len(installed[candidate]) > len(installed[tool]) {
+			tool = candidate
+		}
+	}
+	if tool == "" {
+		names := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			names = append(names, string(candidate))
+		}
+		return "", fmt.Errorf("none of the instances has %s installed", strings.Join(names, " or "))
+	}
+
+	for _, id := range f.active() {
+		if !slices.Contains(installed[tool], id) {
+			f.fail(id, fmt.Errorf("%s is not installed", tool))
+		}
+	}
+	log.Info("Using %s on remote instances", tool)
+	return tool, nil
+}
+
+// fanOutTools returns the tools a fleet running platform may use for the
+// given transport mode, in order of preference.
+func fanOutTools(platform remotePlatform, mode model.RemoteTransport) []remoteTool {
+	presigned := []remoteTool{toolCurl, toolWget}
+	if platform == platformWindows {
+		presigned = []remoteTool{toolInvokeWebRequest}
+	}
+
+	switch mode {
+	case model.RemoteTransportAWSCLI:
+		return []remoteTool{toolAWSCLI}
+	case model.RemoteTransportPresigned:
+		return presigned
+	}
+	return append([]remoteTool{toolAWSCLI}, presigned...)
+}
+
+// installedTools parses the output of toolsCommand. Windows instances
+// always have Invoke-WebRequest.
+func installedTools(platform remotePlatform, output string) []remoteTool {
+	var tools []remoteTool
+	if platform == platformWindows {
+		tools = append(tools, toolInvokeWebRequest)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if platform == platformWindows {
+			if strings.Contains(strings.ToLower(line), `\aws`) {
+				tools = append(tools, toolAWSCLI)
+			}
+			continue
+		}
+		switch tool := remoteTool(path.Base(line)); tool {
+		case toolAWSCLI, toolCurl, toolWget:
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// requireDecryptor fails the instances that cannot decrypt client-side
+// encrypted files.
+func (f *fleet) requireDecryptor(ctx context.Context) error {
+	if f.platform == platformWindows {
+		return fmt.Errorf("client-side encryption is not supported on Windows instances")
+	}
+
+	log.Info("Checking for openssl and GNU dd on remote instances...")
+	outputs, err := f.run(ctx, "{ "+decryptorCheckCommand+"; } > /dev/null 2>&1 && echo ok; true")
+	if err != nil {
+		return fmt.Errorf("failed to check for openssl: %w", err)
+	}
+	for _, id := range f.active() {
+		if strings.TrimSpace(outputs[id]) != "ok" {
+			f.fail(id, fmt.Errorf("client-side encryption requires openssl 1.1.1 or later and GNU dd"))
+		}
+	}
+	return nil
+}
+
+// decrypt has every instance decrypt the files downloaded to it in place,
+// the way remoteDecrypt does for a single instance. Each instance
+// generates its own key exchange key, and the secret wrapped for all of
+// them is sent in one command.
+func (f *fleet) decrypt(ctx context.Context, transferConfig model.TransferConfig, files []presignedFile, secret string, sums map[string]string) error {
+	if len(f.active()) == 0 {
+		return nil
+	}
+	log.Info("Decrypting files on remote instances...")
+
+	dir, err := keyDirectory()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := f.run(ctx, removeKeyCommand(dir)); err != nil {
+			log.Warn("Failed to remove encryption keys from remote instances: %v", err)
+		}
+	}()
+
+	outputs, err := f.run(ctx, keyExchangeCommand(dir))
+	if err != nil {
+		return fmt.Errorf("failed to generate key exchange keys: %w", err)
+	}
+	var wrapped []string
+	for _, id := range f.active() {
+		w, err := wrapSecret(outputs[id], secret)
+		if err != nil {
+			f.fail(id, err)
+			continue
+		}
+		wrapped = append(wrapped, w)
+	}
+	if len(wrapped) == 0 {
+		return nil
+	}
+
+	if _, err := f.run(ctx, unlockCommand(dir, wrapped)); err != nil {
+		return fmt.Errorf("failed to send encryption secret: %w", err)
+	}
+	return f.runBatched(ctx, decryptCommands(transferConfig, files, dir, sums))
+}
+
+// download has every instance copy the staged files, rooted at s3URL, to
+// the transfer destination using tool.
+func (f *fleet) download(ctx context.Context, s3Client S3API, transferConfig model.TransferConfig, tool remoteTool, s3URL string, staged []stagedFile) error {
+	if len(f.active()) == 0 {
+		return nil
+	}
+
+	if tool != toolAWSCLI {
+		presigner, err := presignerFor(s3Client)
+		if err != nil {
+			return err
+		}
+		files := remoteFiles(f.platform, transferConfig, staged)
+		return f.runBatches(ctx, len(files), func(i int) (string, error) {
+			return presignedGet(ctx, presigner, transferConfig, tool, files[i])
+		})
+	}
+
+	_, err := f.run(ctx, awsS3DownloadCommand(f.platform, transferConfig, s3URL))
+	return err
+}
+
+// verify compares expected, the SHA-256 of the local source files keyed
+// the way checksumsFromOutput keys them, with the copies on each
+// instance, failing the instances whose copies differ.
+func (f *fleet) verify(ctx context.Context, transferConfig model.TransferConfig, expected map[string]string) error {
+	if len(f.active()) == 0 {
+		return nil
+	}
+	log.Info("Verifying checksums on remote instances...")
+
+	name := filepath.Base(transferConfig.Source)
+	outputs, err := f.run(ctx, f.platform.checksumCommand(transferConfig.Destination, transferConfig.IsDirectory, name))
+	if err != nil {
+		return fmt.Errorf("failed to compute checksums on remote instances: %w", err)
+	}
+
+	ids := f.active()
+	var verified int
+	for _, id := range ids {
+		actual := checksumsFromOutput(outputs[id], transferConfig.IsDirectory, name)
+		destination := remoteDestination(id, f.platform, transferConfig.Destination, transferConfig.IsDirectory)
+		if err := compareChecksums(expected, actual, destination); err != nil {
+			f.fail(id, err)
+			continue
+		}
+		verified++
+	}
+
+	if verified == len(ids) {
+		log.Info("Verified SHA-256 of %d file(s) on %d instance(s)", len(expected), verified)
+	}
+	return nil
+}
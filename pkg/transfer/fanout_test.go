@@ -0,0 +1,509 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// onlineInstance describes a managed instance SSM can reach.
+func onlineInstance(id string, platform types.PlatformType) types.InstanceInformation {
+	return types.InstanceInformation{InstanceId: aws.String(id), PlatformType: platform, PingStatus: types.PingStatusOnline}
+}
+
+// fleetSSMClient returns a mock managing instances whose commands succeed
+// with the output respond returns for each instance, or fail when it
+// returns an error. It records every command that was sent.
+func fleetSSMClient(instances []types.InstanceInformation, respond func(instanceID, command string) (string, error)) (*mockSSMClient, *[]*ssm.SendCommandInput) {
+	var mu sync.Mutex
+	var sent []*ssm.SendCommandInput
+
+	client := &mockSSMClient{
+		describeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+			var matched []types.InstanceInformation
+			for _, instance := range instances {
+				if slices.Contains(params.Filters[0].Values, aws.ToString(instance.InstanceId)) {
+					matched = append(matched, instance)
+				}
+			}
+			return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: matched}, nil
+		},
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, params)
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String(fmt.Sprintf("command-%d", len(sent)-1))}}, nil
+		},
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			mu.Lock()
+			var index int
+			_, _ = fmt.Sscanf(aws.ToString(params.CommandId), "command-%d", &index)
+			command := strings.Join(sent[index].Parameters["commands"], "\n")
+			mu.Unlock()
+
+			output, err := respond(aws.ToString(params.InstanceId), command)
+			if err != nil {
+				return &ssm.GetCommandInvocationOutput{
+					Status:               types.CommandInvocationStatusFailed,
+					StandardErrorContent: aws.String(err.Error()),
+				}, nil
+			}
+			return &ssm.GetCommandInvocationOutput{
+				Status:                types.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(output),
+			}, nil
+		},
+	}
+	return client, &sent
+}
+
+func TestExecuteFanOut(t *testing.T) {
+	testFile := writeTempFile(t, []byte("app config"))
+
+	var puts int
+	s3Client := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			puts++
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	ssmClient, sent := fleetSSMClient([]types.InstanceInformation{
+		onlineInstance("i-0000000000000000a", types.PlatformTypeLinux),
+		onlineInstance("i-0000000000000000b", types.PlatformTypeLinux),
+		onlineInstance("i-0000000000000000c", types.PlatformTypeLinux),
+	}, func(instanceID, command string) (string, error) {
+		switch {
+		case strings.Contains(command, "command -v"):
+			return "/usr/bin/aws\n/usr/bin/curl\n", nil
+		case strings.Contains(command, "aws s3 cp") && instanceID == "i-0000000000000000b":
+			return "", fmt.Errorf("access denied")
+		case strings.Contains(command, "sha256sum") && instanceID == "i-0000000000000000c":
+			return sha256Hex("stale config") + "  /etc/app/app.conf\n", nil
+		case strings.Contains(command, "sha256sum"):
+			return sha256Hex("app config") + "  /etc/app/app.conf\n", nil
+		}
+		return "", nil
+	})
+
+	transferConfig := model.TransferConfig{
+		Source:      testFile,
+		InstanceIDs: []string{"i-0000000000000000c", "i-0000000000000000a", "i-0000000000000000b", "i-0000000000000000d"},
+		Destination: "/etc/app/app.conf",
+		BucketName:  "test-bucket",
+		Direction:   model.ToRemote,
+	}
+
+	results, err := executeFanOut(context.Background(), transferConfig, s3Client, ssmClient)
+	if err != nil {
+		t.Fatalf("executeFanOut() error = %v", err)
+	}
+
+	if puts != 1 {
+		t.Errorf("Uploaded %d time(s), want once", puts)
+	}
+
+	want := map[string]string{
+		"i-0000000000000000a": "",
+		"i-0000000000000000b": "access denied",
+		"i-0000000000000000c": "checksum verification failed",
+		"i-0000000000000000d": "not managed by SSM",
+	}
+	if len(results) != len(want) {
+		t.Fatalf("executeFanOut() returned %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if i > 0 && result.InstanceID < results[i-1].InstanceID {
+			t.Errorf("Results are not sorted by instance ID: %v", results)
+		}
+		wantErr := want[result.InstanceID]
+		if wantErr == "" {
+			if result.Err != nil {
+				t.Errorf("Instance %s error = %v, want success", result.InstanceID, result.Err)
+			}
+		} else if result.Err == nil || !strings.Contains(result.Err.Error(), wantErr) {
+			t.Errorf("Instance %s error = %v, want it to contain %q", result.InstanceID, result.Err, wantErr)
+		}
+	}
+
+	// Each step is one command, sent only to the instances still in the
+	// transfer
+	wantTargets := [][]string{
+		{"i-0000000000000000a", "i-0000000000000000b", "i-0000000000000000c"},
+		{"i-0000000000000000a", "i-0000000000000000b", "i-0000000000000000c"},
+		{"i-0000000000000000a", "i-0000000000000000c"},
+	}
+	if len(*sent) != len(wantTargets) {
+		t.Fatalf("Sent %d commands, want %d", len(*sent), len(wantTargets))
+	}
+	for i, input := range *sent {
+		if !slices.Equal(input.InstanceIds, wantTargets[i]) {
+			t.Errorf("Command %d targeted %v, want %v", i, input.InstanceIds, wantTargets[i])
+		}
+	}
+	if download := strings.Join((*sent)[1].Parameters["commands"], "\n"); !strings.Contains(download, "aws s3 cp") {
+		t.Errorf("Download command = %q, want the AWS CLI", download)
+	}
+}
+
+func TestExecuteFanOut_MoreThanOneCommandOfInstances(t *testing.T) {
+	testFile := writeTempFile(t, []byte("app config"))
+
+	var puts int
+	s3Client := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			puts++
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	var instances []types.InstanceInformation
+	var ids []string
+	for i := range 2*maxCommandInstances + 20 {
+		id := fmt.Sprintf("i-%017x", i)
+		instances = append(instances, onlineInstance(id, types.PlatformTypeLinux))
+		ids = append(ids, id)
+	}
+	ssmClient, sent := fleetSSMClient(instances, func(instanceID, command string) (string, error) {
+		switch {
+		case strings.Contains(command, "command -v"):
+			return "/usr/bin/aws\n", nil
+		case strings.Contains(command, "sha256sum"):
+			return sha256Hex("app config") + "  /etc/app/app.conf\n", nil
+		}
+		return "", nil
+	})
+	describe := ssmClient.describeInstanceInformationFunc
+	ssmClient.describeInstanceInformationFunc = func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+		if n := len(params.Filters[0].Values); n > maxCommandInstances {
+			t.Errorf("Described %d instances at once, want at most %d", n, maxCommandInstances)
+		}
+		return describe(ctx, params, optFns...)
+	}
+
+	transferConfig := model.TransferConfig{
+		Source:      testFile,
+		InstanceIDs: ids,
+		Destination: "/etc/app/app.conf",
+		BucketName:  "test-bucket",
+		Direction:   model.ToRemote,
+	}
+
+	results, err := executeFanOut(context.Background(), transferConfig, s3Client, ssmClient)
+	if err != nil {
+		t.Fatalf("executeFanOut() error = %v", err)
+	}
+	if puts != 1 {
+		t.Errorf("Uploaded %d time(s), want once", puts)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("executeFanOut() returned %d results, want %d", len(results), len(ids))
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("Instance %s error = %v, want success", result.InstanceID, result.Err)
+		}
+	}
+
+	// Each of the three steps goes out as three commands
+	if len(*sent) != 9 {
+		t.Errorf("Sent %d commands, want 9", len(*sent))
+	}
+	for i, input := range *sent {
+		if len(input.InstanceIds) > maxCommandInstances {
+			t.Errorf("Command %d targeted %d instances, want at most %d", i, len(input.InstanceIds), maxCommandInstances)
+		}
+	}
+}
+
+func TestExecuteFanOut_NoInstanceOnline(t *testing.T) {
+	offline := onlineInstance("i-0000000000000000a", types.PlatformTypeLinux)
+	offline.PingStatus = types.PingStatusConnectionLost
+
+	var puts int
+	s3Client := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			puts++
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+	ssmClient, sent := fleetSSMClient([]types.InstanceInformation{offline}, func(instanceID, command string) (string, error) {
+		return "", nil
+	})
+
+	transferConfig := model.TransferConfig{
+		Source:      writeTempFile(t, []byte("app config")),
+		InstanceIDs: []string{"i-0000000000000000a", "i-0000000000000000b"},
+		Destination: "/etc/app/app.conf",
+		BucketName:  "test-bucket",
+		Direction:   model.ToRemote,
+	}
+
+	results, err := executeFanOut(context.Background(), transferConfig, s3Client, ssmClient)
+	if err != nil {
+		t.Fatalf("executeFanOut() error = %v", err)
+	}
+	if puts != 0 || len(*sent) != 0 {
+		t.Errorf("Uploaded %d file(s) and sent %d command(s), want nothing with no instance online", puts, len(*sent))
+	}
+	for _, result := range results {
+		if result.Err == nil {
+			t.Errorf("Instance %s succeeded, want it to fail", result.InstanceID)
+		}
+	}
+}
+
+func TestExecuteFanOut_FromRemote(t *testing.T) {
+	transferConfig := model.TransferConfig{
+		Source:      "/var/log/app.log",
+		InstanceIDs: []string{"i-0000000000000000a", "i-0000000000000000b"},
+		Destination: t.TempDir(),
+		BucketName:  "test-bucket",
+		Direction:   model.FromRemote,
+	}
+
+	_, err := executeFanOut(context.Background(), transferConfig, &mockS3Client{}, &mockSSMClient{})
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("executeFanOut() error = %v, want a not supported error", err)
+	}
+}
+
+func TestConnectFleet(t *testing.T) {
+	offline := onlineInstance("i-0000000000000000b", types.PlatformTypeLinux)
+	offline.PingStatus = types.PingStatusConnectionLost
+	ssmClient, _ := fleetSSMClient([]types.InstanceInformation{
+		onlineInstance("i-0000000000000000a", types.PlatformTypeLinux),
+		offline,
+	}, nil)
+
+	f, err := connectFleet(context.Background(), ssmClient, &mockS3Client{}, model.TransferConfig{
+		InstanceIDs: []string{"i-0000000000000000b", "i-0000000000000000a"},
+	})
+	if err != nil {
+		t.Fatalf("connectFleet() error = %v", err)
+	}
+	if f.platform != platformPOSIX {
+		t.Errorf("connectFleet() platform = %q, want %q", f.platform, platformPOSIX)
+	}
+	if active := f.active(); !slices.Equal(active, []string{"i-0000000000000000a"}) {
+		t.Errorf("connectFleet() active = %v, want only the online instance", active)
+	}
+	if err := f.failed["i-0000000000000000b"]; err == nil || !strings.Contains(err.Error(), "ConnectionLost") {
+		t.Errorf("Offline instance error = %v, want ConnectionLost", err)
+	}
+}
+
+func TestConnectFleet_MixedPlatforms(t *testing.T) {
+	ssmClient, _ := fleetSSMClient([]types.InstanceInformation{
+		onlineInstance("i-0000000000000000a", types.PlatformTypeLinux),
+		onlineInstance("i-0000000000000000b", types.PlatformTypeWindows),
+	}, nil)
+
+	_, err := connectFleet(context.Background(), ssmClient, &mockS3Client{}, model.TransferConfig{
+		InstanceIDs: []string{"i-0000000000000000a", "i-0000000000000000b"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "different platforms") {
+		t.Errorf("connectFleet() error = %v, want a different platforms error", err)
+	}
+}
+
+func TestFleetSelectTool(t *testing.T) {
+	tests := []struct {
+		name       string
+		platform   remotePlatform
+		mode       model.RemoteTransport
+		tools      map[string]string
+		want       remoteTool
+		wantFailed []string
+		wantErrMsg string
+	}{
+		{
+			name:     "AWS CLI everywhere",
+			platform: platformPOSIX,
+			mode:     model.RemoteTransportAuto,
+			tools:    map[string]string{"i-a": "/usr/bin/aws\n/usr/bin/curl", "i-b": "/usr/local/bin/aws"},
+			want:     toolAWSCLI,
+		},
+		{
+			name:     "curl on more instances than the AWS CLI",
+			platform: platformPOSIX,
+			mode:     model.RemoteTransportAuto,
+			tools:    map[string]string{"i-a": "/usr/bin/aws\n/usr/bin/curl", "i-b": "/usr/bin/curl"},
+			want:     toolCurl,
+		},
+		{
+			name:       "AWS CLI required",
+			platform:   platformPOSIX,
+			mode:       model.RemoteTransportAWSCLI,
+			tools:      map[string]string{"i-a": "/usr/bin/aws", "i-b": "/usr/bin/curl"},
+			want:       toolAWSCLI,
+			wantFailed: []string{"i-b"},
+		},
+		{
+			name:     "presigned with wget",
+			platform: platformPOSIX,
+			mode:     model.RemoteTransportPresigned,
+			tools:    map[string]string{"i-a": "/usr/bin/aws\n/usr/bin/wget", "i-b": "/usr/bin/curl\n/usr/bin/wget"},
+			want:     toolWget,
+		},
+		{
+			name:       "nothing installed",
+			platform:   platformPOSIX,
+			mode:       model.RemoteTransportPresigned,
+			tools:      map[string]string{"i-a": "/usr/bin/aws", "i-b": ""},
+			wantErrMsg: "none of the instances has curl or wget installed",
+		},
+		{
+			name:     "Windows without the AWS CLI",
+			platform: platformWindows,
+			mode:     model.RemoteTransportAuto,
+			tools:    map[string]string{"i-a": `C:\Program Files\Amazon\AWSCLIV2\aws.exe`, "i-b": ""},
+			want:     toolInvokeWebRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ssmClient, _ := fleetSSMClient(nil, func(instanceID, command string) (string, error) {
+				return tt.tools[instanceID], nil
+			})
+			f := &fleet{client: ssmClient, ids: []string{"i-a", "i-b"}, platform: tt.platform, failed: make(map[string]error)}
+
+			got, err := f.selectTool(context.Background(), tt.mode)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Fatalf("selectTool() error = %v, want it to contain %q", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectTool() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("selectTool() = %q, want %q", got, tt.want)
+			}
+
+			var failed []string
+			for id := range f.failed {
+				failed = append(failed, id)
+			}
+			slices.Sort(failed)
+			if !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("selectTool() failed instances %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestFleetRun_Timeout(t *testing.T) {
+	var cancelled []string
+	ssmClient := &mockSSMClient{
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			if aws.ToString(params.InstanceId) == "i-a" {
+				return &ssm.GetCommandInvocationOutput{Status: types.CommandInvocationStatusSuccess, StandardOutputContent: aws.String("done")}, nil
+			}
+			return &ssm.GetCommandInvocationOutput{Status: types.CommandInvocationStatusInProgress}, nil
+		},
+		cancelCommandFunc: func(ctx context.Context, params *ssm.CancelCommandInput, optFns ...func(*ssm.Options)) (*ssm.CancelCommandOutput, error) {
+			cancelled = params.InstanceIds
+			return &ssm.CancelCommandOutput{}, nil
+		},
+	}
+	f := &fleet{client: ssmClient, ids: []string{"i-a", "i-b"}, platform: platformPOSIX, timeout: 50 * time.Millisecond, failed: make(map[string]error)}
+
+	outputs, err := f.run(context.Background(), "sleep 600")
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if outputs["i-a"] != "done" {
+		t.Errorf("run() output of i-a = %q, want %q", outputs["i-a"], "done")
+	}
+	if err := f.failed["i-b"]; err == nil || !strings.Contains(err.Error(), "did not complete") {
+		t.Errorf("i-b error = %v, want a timeout", err)
+	}
+	if !slices.Equal(cancelled, []string{"i-b"}) {
+		t.Errorf("Cancelled command on %v, want only i-b", cancelled)
+	}
+}
+
+func TestFleetDecrypt(t *testing.T) {
+	keys := make(map[string]*rsa.PrivateKey)
+	for _, id := range []string{"i-a", "i-b"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey() error = %v", err)
+		}
+		keys[id] = key
+	}
+
+	ssmClient, sent := fleetSSMClient(nil, func(instanceID, command string) (string, error) {
+		if strings.Contains(command, "genpkey") {
+			if key, ok := keys[instanceID]; ok {
+				return testPublicKeyPEM(t, key), nil
+			}
+			return "genpkey: command not found", nil
+		}
+		return "", nil
+	})
+	f := &fleet{client: ssmClient, ids: []string{"i-a", "i-b", "i-c"}, platform: platformPOSIX, failed: make(map[string]error)}
+
+	files := []presignedFile{{Key: "bcp/id/staged/app.conf", RemotePath: "/etc/app/app.conf"}}
+	sums := map[string]string{"bcp/id/staged/app.conf": sha256Hex("app config")}
+	if err := f.decrypt(context.Background(), model.TransferConfig{}, files, testSecret, sums); err != nil {
+		t.Fatalf("decrypt() error = %v", err)
+	}
+
+	if got := f.active(); !slices.Equal(got, []string{"i-a", "i-b"}) {
+		t.Errorf("Active instances = %v, want the ones that returned a public key", got)
+	}
+
+	var commands []string
+	for _, input := range *sent {
+		commands = append(commands, strings.Join(input.Parameters["commands"], "\n"))
+	}
+	if len(commands) != 4 {
+		t.Fatalf("Sent %d commands, want key exchange, unlock, decrypt and removal", len(commands))
+	}
+	for id, key := range keys {
+		if !unwrapsTo(t, key, commands[1], testSecret) {
+			t.Errorf("Unlock command does not carry the secret wrapped for %s", id)
+		}
+	}
+	if !strings.Contains(commands[2], "openssl enc -d") || !strings.HasPrefix(commands[3], "rm -rf /tmp/bcp-key-") {
+		t.Errorf("Sent %q, want a decrypt command followed by the key directory's removal", commands[2:])
+	}
+}
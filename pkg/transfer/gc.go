@@ -0,0 +1,128 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// legacyDownloadPrefix is the staging key prefix used for transfers from
+// remote instances before transfers were staged under stagingRoot.
+const legacyDownloadPrefix = "bcp-download-"
+
+// StagingGroup is the set of objects a single transfer left in the
+// staging bucket.
+type StagingGroup struct {
+	// Prefix is the key prefix of the group's objects, or the key of its
+	// only object when IsDirectory is false.
+	Prefix      string
+	IsDirectory bool
+	// Objects is the number of objects in the group.
+	Objects int
+	// Size is the combined size of the group's objects in bytes.
+	Size int64
+	// LastModified is when the newest object of the group was written.
+	LastModified time.Time
+}
+
+// FindStaleStaging lists the objects under bcp's staging prefixes in
+// bucketName, grouped by the transfer that wrote them, and returns the
+// groups whose newest object was last modified before cutoff. Groups are
+// judged by their newest object so the objects of a transfer that is
+// still running are never collected.
+func FindStaleStaging(ctx context.Context, client S3API, bucketName string, cutoff time.Time) ([]StagingGroup, error) {
+	groups := make(map[string]*StagingGroup)
+
+	for _, prefix := range []string{stagingRoot, legacyDownloadPrefix} {
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucketName),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list staged objects: %w", err)
+			}
+
+			for _, obj := range page.Contents {
+				groupPrefix, isDirectory := stagingGroupOf(aws.ToString(obj.Key))
+				group, ok := groups[groupPrefix]
+				if !ok {
+					group = &StagingGroup{Prefix: groupPrefix, IsDirectory: isDirectory}
+					groups[groupPrefix] = group
+				}
+				group.Objects++
+				group.Size += aws.ToInt64(obj.Size)
+				if modified := aws.ToTime(obj.LastModified); modified.After(group.LastModified) {
+					group.LastModified = modified
+				}
+			}
+		}
+	}
+
+	var stale []StagingGroup
+	for _, group := range groups {
+		if group.LastModified.Before(cutoff) {
+			stale = append(stale, *group)
+		}
+	}
+	sort.Slice(stale, func(i, k int) bool { return stale[i].Prefix < stale[k].Prefix })
+	return stale, nil
+}
+
+// stagingGroupOf returns the prefix of the staging group key belongs to
+// and whether the group is a prefix rather than a single object.
+func stagingGroupOf(key string) (string, bool) {
+	if rest, ok := strings.CutPrefix(key, stagingRoot); ok {
+		if id, _, _ := strings.Cut(rest, "/"); id != "" {
+			return transferPrefix(id), true
+		}
+		return key, false
+	}
+	if name, _, ok := strings.Cut(key, "/"); ok {
+		return name + "/", true
+	}
+	return key, false
+}
+
+// DeleteStaging deletes the objects of every group, continuing past
+// groups that fail and returning their errors together.
+func DeleteStaging(ctx context.Context, client S3API, bucketName string, groups []StagingGroup) error {
+	var errs []error
+	for _, group := range groups {
+		log.Debug("Deleting %d staged object(s) under s3://%s/%s", group.Objects, bucketName, group.Prefix)
+		if err := CleanupS3Objects(ctx, client, bucketName, group.Prefix, group.IsDirectory); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", group.Prefix, err))
+		}
+	}
+	return errors.Join(errs...)
+}
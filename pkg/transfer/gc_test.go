@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// stagedBucket returns a mock bucket holding objects, keyed by name with
+// their last modified time, that records the keys deleted from it.
+func stagedBucket(objects map[string]time.Time, deleted *[]string) *mockS3Client {
+	return &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			var contents []s3types.Object
+			for key, modified := range objects {
+				if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+					contents = append(contents, s3types.Object{
+						Key:          aws.String(key),
+						Size:         aws.Int64(10),
+						LastModified: aws.Time(modified),
+					})
+				}
+			}
+			return &s3.ListObjectsV2Output{Contents: contents}, nil
+		},
+		deleteObjectFunc: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			*deleted = append(*deleted, aws.ToString(params.Key))
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+}
+
+func TestFindStaleStaging(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	objects := map[string]time.Time{
+		"bcp/old-transfer/staged/data/a.txt":          old,
+		"bcp/old-transfer/staged/data/b.txt":          old,
+		"bcp/old-transfer/ssm-output/cmd/i-1/stdout":  old,
+		"bcp/running/staged/large.bin":                old,
+		"bcp/running/ssm-output/cmd/i-1/stdout":       now,
+		"bcp-download-1700000000":                     old,
+		"bcp-download-1700000001/logs/app.log":        old,
+		"bcp-download-1800000000":                     now,
+		"unrelated/bcp/old-transfer/staged/other.txt": old,
+	}
+
+	var deleted []string
+	groups, err := FindStaleStaging(context.Background(), stagedBucket(objects, &deleted), "test-bucket", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("FindStaleStaging() error = %v", err)
+	}
+
+	want := []StagingGroup{
+		{Prefix: "bcp-download-1700000000", IsDirectory: false, Objects: 1, Size: 10},
+		{Prefix: "bcp-download-1700000001/", IsDirectory: true, Objects: 1, Size: 10},
+		{Prefix: "bcp/old-transfer/", IsDirectory: true, Objects: 3, Size: 30},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("FindStaleStaging() = %+v, want %d groups", groups, len(want))
+	}
+	for i, group := range groups {
+		if group.Prefix != want[i].Prefix || group.IsDirectory != want[i].IsDirectory ||
+			group.Objects != want[i].Objects || group.Size != want[i].Size {
+			t.Errorf("group %d = %+v, want %+v", i, group, want[i])
+		}
+		if !group.LastModified.Equal(old) {
+			t.Errorf("group %s LastModified = %v, want %v", group.Prefix, group.LastModified, old)
+		}
+	}
+}
+
+func TestDeleteStaging(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	objects := map[string]time.Time{
+		"bcp/t1/staged/a.txt":     old,
+		"bcp/t1/staged/b.txt":     old,
+		"bcp-download-1700000000": old,
+		"bcp/t2/staged/keep.txt":  old,
+	}
+
+	var deleted []string
+	groups := []StagingGroup{
+		{Prefix: "bcp/t1/", IsDirectory: true},
+		{Prefix: "bcp-download-1700000000", IsDirectory: false},
+	}
+	if err := DeleteStaging(context.Background(), stagedBucket(objects, &deleted), "test-bucket", groups); err != nil {
+		t.Fatalf("DeleteStaging() error = %v", err)
+	}
+
+	sort.Strings(deleted)
+	want := []string{"bcp-download-1700000000", "bcp/t1/staged/a.txt", "bcp/t1/staged/b.txt"}
+	if strings.Join(deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+}
+
+func TestDeleteStaging_ContinuesPastFailures(t *testing.T) {
+	var attempted []string
+	client := &mockS3Client{
+		deleteObjectFunc: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			attempted = append(attempted, aws.ToString(params.Key))
+			if aws.ToString(params.Key) == "bcp-download-1" {
+				return nil, errors.New("access denied")
+			}
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+
+	groups := []StagingGroup{{Prefix: "bcp-download-1"}, {Prefix: "bcp-download-2"}}
+	err := DeleteStaging(context.Background(), client, "test-bucket", groups)
+	if err == nil || !strings.Contains(err.Error(), "bcp-download-1") {
+		t.Errorf("DeleteStaging() error = %v, want the failed group", err)
+	}
+	if len(attempted) != 2 {
+		t.Errorf("attempted = %v, want both groups", attempted)
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// maxUploadParts is the largest number of parts S3 accepts in a single
+// multipart upload.
+const maxUploadParts = 10000
+
+// multipartEnabled reports whether large objects should be split into
+// parts at all.
+func (o Options) multipartEnabled() bool {
+	return o.PartSize > 0 && o.MultipartThreshold > 0
+}
+
+// useMultipart reports whether an object of the given size should be
+// transferred in parts.
+func (o Options) useMultipart(size int64) bool {
+	return o.multipartEnabled() && size >= o.MultipartThreshold
+}
+
+// uploadPartSize returns the part size to use for an upload of size bytes,
+// growing the configured part size when needed to stay within S3's part
+// count limit.
+func uploadPartSize(size, partSize int64) int64 {
+	minimum := (size + maxUploadParts - 1) / maxUploadParts
+	if partSize < minimum {
+		return minimum
+	}
+	return partSize
+}
+
+// uploadMultipart uploads file to S3 as a multipart upload, sending up to
+// opts.Concurrency parts in parallel. Without a journal the upload is
+// aborted if any part fails so no orphaned parts are left behind. With a
+// journal the uploaded parts are kept and recorded, and a later attempt
+// against the same unchanged file only sends the missing parts.
+func uploadMultipart(ctx context.Context, client S3API, bucketName string, file *os.File, info os.FileInfo, s3Key string, metadata map[string]string, opts Options) error {
+	size := info.Size()
+	partSize := uploadPartSize(size, opts.PartSize)
+
+	enc, err := opts.objectCipher()
+	if err != nil {
+		return err
+	}
+	var uploadID string
+	var uploaded map[int32]string
+	if enc == nil {
+		uploadID, uploaded = resumableUpload(opts.Journal, s3Key, info, partSize)
+	} else {
+		// Each part must hold whole chunks to be encrypted on its own, and
+		// the nonce of an interrupted encrypted upload is not kept, so its
+		// parts are discarded rather than resumed
+		partSize = alignToChunks(partSize)
+		if obj := opts.Journal.Object(s3Key); obj != nil && obj.UploadID != "" {
+			abortMultipartUpload(ctx, client, bucketName, s3Key, obj.UploadID)
+			logJournalError(opts.Journal.ResetObject(s3Key))
+		}
+	}
+	partCount := int((size + partSize - 1) / partSize)
+	resumed := uploadID != ""
+	if resumed {
+		log.Info("Resuming multipart upload of %s with %d of %d parts already uploaded", file.Name(), len(uploaded), partCount)
+	} else {
+		log.Debug("Uploading %s to s3://%s/%s in %d parts of %d bytes", file.Name(), bucketName, s3Key, partCount, partSize)
+
+		sse, kmsKeyID := opts.encryption()
+		created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String(bucketName),
+			Key:                  aws.String(s3Key),
+			Metadata:             metadata,
+			ServerSideEncryption: sse,
+			SSEKMSKeyId:          kmsKeyID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload of %s: %w", file.Name(), err)
+		}
+		uploadID = aws.ToString(created.UploadId)
+		logJournalError(opts.Journal.StartObject(s3Key, size, info.ModTime(), uploadID, partSize))
+	}
+
+	parts := make([]s3types.CompletedPart, partCount)
+	jobs := make([]job, 0, partCount)
+	for i := 0; i < partCount; i++ {
+		partNumber := int32(i + 1)
+		if etag, ok := uploaded[partNumber]; ok {
+			parts[i] = s3types.CompletedPart{ETag: aws.String(etag), PartNumber: aws.Int32(partNumber)}
+			continue
+		}
+
+		offset := int64(i) * partSize
+		length := min(partSize, size-offset)
+		jobs = append(jobs, func(ctx context.Context) error {
+			var body io.ReadSeeker = io.NewSectionReader(file, offset, length)
+			bodyLength := length
+			if enc != nil {
+				section := enc.section(file, offset, length)
+				body, bodyLength = section, section.size
+			}
+
+			out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        aws.String(bucketName),
+				Key:           aws.String(s3Key),
+				UploadId:      aws.String(uploadID),
+				PartNumber:    aws.Int32(partNumber),
+				Body:          body,
+				ContentLength: aws.Int64(bodyLength),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to upload part %d of %s: %w", partNumber, file.Name(), err)
+			}
+
+			parts[partNumber-1] = s3types.CompletedPart{
+				ETag:       out.ETag,
+				PartNumber: aws.Int32(partNumber),
+			}
+			logJournalError(opts.Journal.RecordPart(s3Key, partNumber, aws.ToString(out.ETag)))
+			return nil
+		})
+	}
+
+	err = runPool(ctx, opts.Concurrency, jobs)
+	if err == nil {
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucketName),
+			Key:             aws.String(s3Key),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to complete multipart upload of %s: %w", file.Name(), err)
+		}
+	}
+
+	if err != nil {
+		if resumed && isNoSuchUpload(err) {
+			// The upload expired or was aborted since it was journaled,
+			// so its parts are gone and it has to start over.
+			log.Warn("Multipart upload of %s no longer exists, restarting it", file.Name())
+			logJournalError(opts.Journal.ResetObject(s3Key))
+			return uploadMultipart(ctx, client, bucketName, file, info, s3Key, metadata, opts)
+		}
+		if opts.Journal == nil {
+			abortMultipartUpload(ctx, client, bucketName, s3Key, uploadID)
+		}
+		return err
+	}
+
+	logJournalError(opts.Journal.CompleteObject(s3Key, size, info.ModTime()))
+	return nil
+}
+
+// resumableUpload returns the upload ID and already uploaded parts that j
+// recorded for key, or an empty ID if there is nothing to resume because
+// the file changed or was split differently.
+func resumableUpload(j *journal.Journal, key string, info os.FileInfo, partSize int64) (string, map[int32]string) {
+	obj := j.Object(key)
+	if obj == nil || obj.UploadID == "" || obj.PartSize != partSize || !obj.Matches(info.Size(), info.ModTime()) {
+		return "", nil
+	}
+	return obj.UploadID, obj.Parts
+}
+
+// isNoSuchUpload reports whether err means the multipart upload being
+// written to no longer exists.
+func isNoSuchUpload(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload"
+}
+
+// abortMultipartUpload discards the parts of a failed multipart upload.
+// It runs even if ctx has been cancelled so interrupted uploads don't keep
+// accruing storage charges.
+func abortMultipartUpload(ctx context.Context, client S3API, bucketName, s3Key, uploadID string) {
+	_, err := client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(s3Key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		log.Warn("Failed to abort multipart upload %s for s3://%s/%s: %v", uploadID, bucketName, s3Key, err)
+	}
+}
+
+// downloadRanges downloads an object of the given size as parallel byte
+// range requests written directly into their offsets in localPath. The
+// object's ETag is pinned so a concurrent overwrite fails the download
+// instead of producing a corrupt file.
+func downloadRanges(ctx context.Context, client S3API, bucketName, s3Key, localPath string, size int64, etag string, opts Options) error {
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file %s: %w", localPath, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			log.Warn("Failed to close file %s: %v", localPath, closeErr)
+		}
+	}()
+
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to allocate local file %s: %w", localPath, err)
+	}
+
+	var jobs []job
+	for offset := int64(0); offset < size; offset += opts.PartSize {
+		start := offset
+		end := min(offset+opts.PartSize, size) - 1
+
+		jobs = append(jobs, func(ctx context.Context) error {
+			return downloadRange(ctx, client, bucketName, s3Key, etag, file, start, end)
+		})
+	}
+
+	log.Debug("Downloading s3://%s/%s in %d ranges", bucketName, s3Key, len(jobs))
+	return runPool(ctx, opts.Concurrency, jobs)
+}
+
+// downloadRange fetches bytes start through end (inclusive) of an object
+// and writes them at the same offset in file.
+func downloadRange(ctx context.Context, client S3API, bucketName, s3Key, etag string, file *os.File, start, end int64) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(s3Key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(etag)
+	}
+
+	result, err := client.GetObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to get range %d-%d of %s: %w", start, end, s3Key, err)
+	}
+	defer func() {
+		if closeErr := result.Body.Close(); closeErr != nil {
+			log.Warn("Failed to close S3 object body: %v", closeErr)
+		}
+	}()
+
+	written, err := io.Copy(io.NewOffsetWriter(file, start), result.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write range %d-%d to %s: %w", start, end, file.Name(), err)
+	}
+	if written != end-start+1 {
+		return fmt.Errorf("short read for range %d-%d of %s: got %d bytes", start, end, s3Key, written)
+	}
+
+	return nil
+}
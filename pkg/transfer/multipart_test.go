@@ -0,0 +1,403 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func TestUploadPartSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		partSize int64
+		expected int64
+	}{
+		{"configured size fits", 100 << 20, 8 << 20, 8 << 20},
+		{"grows to stay under part limit", 200 << 30, 8 << 20, (200<<30 + maxUploadParts - 1) / maxUploadParts},
+		{"exact multiple", 10, 5, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uploadPartSize(tt.size, tt.partSize)
+			if got != tt.expected {
+				t.Errorf("uploadPartSize(%d, %d) = %d, want %d", tt.size, tt.partSize, got, tt.expected)
+			}
+			if (tt.size+got-1)/got > maxUploadParts {
+				t.Errorf("uploadPartSize(%d, %d) = %d produces more than %d parts", tt.size, tt.partSize, got, maxUploadParts)
+			}
+		})
+	}
+}
+
+func TestOptionsUseMultipart(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		size     int64
+		expected bool
+	}{
+		{"zero options", Options{}, 1 << 30, false},
+		{"below threshold", Options{PartSize: 10, MultipartThreshold: 100}, 99, false},
+		{"at threshold", Options{PartSize: 10, MultipartThreshold: 100}, 100, true},
+		{"missing part size", Options{MultipartThreshold: 100}, 1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.useMultipart(tt.size); got != tt.expected {
+				t.Errorf("useMultipart(%d) = %v, want %v", tt.size, got, tt.expected)
+			}
+		})
+	}
+}
+
+func writeTempFile(t *testing.T, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return path
+}
+
+func TestUploadFile_Multipart(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxy")
+	testFile := writeTempFile(t, content)
+
+	var mu sync.Mutex
+	received := make(map[int32][]byte)
+	var completedParts []int32
+	putCalled := false
+
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			putCalled = true
+			return &s3.PutObjectOutput{}, nil
+		},
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			body, err := io.ReadAll(params.Body)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(body)) != aws.ToInt64(params.ContentLength) {
+				t.Errorf("Part %d: body length %d does not match ContentLength %d", aws.ToInt32(params.PartNumber), len(body), aws.ToInt64(params.ContentLength))
+			}
+			mu.Lock()
+			received[aws.ToInt32(params.PartNumber)] = body
+			mu.Unlock()
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+		},
+		completeMPUFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+			if aws.ToString(params.UploadId) != "test-upload-id" {
+				t.Errorf("Expected upload ID 'test-upload-id', got %s", aws.ToString(params.UploadId))
+			}
+			for _, part := range params.MultipartUpload.Parts {
+				completedParts = append(completedParts, aws.ToInt32(part.PartNumber))
+				if aws.ToString(part.ETag) != fmt.Sprintf("etag-%d", aws.ToInt32(part.PartNumber)) {
+					t.Errorf("Part %d has unexpected ETag %s", aws.ToInt32(part.PartNumber), aws.ToString(part.ETag))
+				}
+			}
+			return &s3.CompleteMultipartUploadOutput{}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 3, PartSize: 10, MultipartThreshold: 10}
+	err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts)
+	if err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	if putCalled {
+		t.Error("Expected multipart upload, but PutObject was called")
+	}
+	if len(received) != 4 {
+		t.Fatalf("Expected 4 parts, got %d", len(received))
+	}
+
+	var reassembled []byte
+	for i := int32(1); i <= 4; i++ {
+		reassembled = append(reassembled, received[i]...)
+	}
+	if !bytes.Equal(reassembled, content) {
+		t.Errorf("Reassembled parts = %q, want %q", reassembled, content)
+	}
+
+	for i, partNumber := range completedParts {
+		if partNumber != int32(i+1) {
+			t.Errorf("Completed parts out of order: %v", completedParts)
+			break
+		}
+	}
+}
+
+func TestUploadFile_BelowThresholdUsesPutObject(t *testing.T) {
+	testFile := writeTempFile(t, []byte("small"))
+
+	putCalled := false
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			putCalled = true
+			return &s3.PutObjectOutput{}, nil
+		},
+		createMPUFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			t.Error("CreateMultipartUpload should not be called for small files")
+			return nil, errors.New("unexpected call")
+		},
+	}
+
+	opts := Options{Concurrency: 2, PartSize: 10, MultipartThreshold: 100}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "small", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+	if !putCalled {
+		t.Error("Expected PutObject to be used below the multipart threshold")
+	}
+}
+
+func TestUploadFile_ServerSideEncryption(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		opts      Options
+		wantSSE   s3types.ServerSideEncryption
+		wantKeyID string
+	}{
+		{"put default", []byte("small"), Options{MultipartThreshold: 100}, "", ""},
+		{"put AES256", []byte("small"), Options{MultipartThreshold: 100, SSE: model.ServerSideEncryptionAES256}, s3types.ServerSideEncryptionAes256, ""},
+		{"put KMS", []byte("small"), Options{MultipartThreshold: 100, SSE: model.ServerSideEncryptionKMS, KMSKeyID: "alias/staging"}, s3types.ServerSideEncryptionAwsKms, "alias/staging"},
+		{"multipart KMS", bytes.Repeat([]byte("x"), 30), Options{PartSize: 10, MultipartThreshold: 10, SSE: model.ServerSideEncryptionKMS, KMSKeyID: "alias/staging"}, s3types.ServerSideEncryptionAwsKms, "alias/staging"},
+		{"multipart KMS default key", bytes.Repeat([]byte("x"), 30), Options{PartSize: 10, MultipartThreshold: 10, SSE: model.ServerSideEncryptionKMS}, s3types.ServerSideEncryptionAwsKms, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := writeTempFile(t, tt.content)
+
+			var gotSSE s3types.ServerSideEncryption
+			var gotKeyID *string
+			mockS3 := &mockS3Client{
+				putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					gotSSE, gotKeyID = params.ServerSideEncryption, params.SSEKMSKeyId
+					return &s3.PutObjectOutput{}, nil
+				},
+				createMPUFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+					gotSSE, gotKeyID = params.ServerSideEncryption, params.SSEKMSKeyId
+					return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+				},
+			}
+
+			if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "staged", tt.opts); err != nil {
+				t.Fatalf("uploadFile() error = %v", err)
+			}
+			if gotSSE != tt.wantSSE {
+				t.Errorf("ServerSideEncryption = %q, want %q", gotSSE, tt.wantSSE)
+			}
+			if aws.ToString(gotKeyID) != tt.wantKeyID {
+				t.Errorf("SSEKMSKeyId = %q, want %q", aws.ToString(gotKeyID), tt.wantKeyID)
+			}
+		})
+	}
+}
+
+func TestUploadFile_MultipartFailureAborts(t *testing.T) {
+	testFile := writeTempFile(t, bytes.Repeat([]byte("x"), 30))
+
+	var aborted atomic.Bool
+	completed := false
+	mockS3 := &mockS3Client{
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			if aws.ToInt32(params.PartNumber) == 2 {
+				return nil, errors.New("invalid part")
+			}
+			return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+		},
+		completeMPUFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+			completed = true
+			return &s3.CompleteMultipartUploadOutput{}, nil
+		},
+		abortMPUFunc: func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+			aborted.Store(true)
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 1, PartSize: 10, MultipartThreshold: 10}
+	err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts)
+	if err == nil {
+		t.Fatal("Expected error from failed part upload")
+	}
+	if !aborted.Load() {
+		t.Error("Expected multipart upload to be aborted")
+	}
+	if completed {
+		t.Error("CompleteMultipartUpload should not be called after a part failure")
+	}
+}
+
+func TestUploadFile_CreateMultipartUploadError(t *testing.T) {
+	testFile := writeTempFile(t, bytes.Repeat([]byte("x"), 30))
+
+	mockS3 := &mockS3Client{
+		createMPUFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			return nil, errors.New("create failed")
+		},
+	}
+
+	opts := Options{PartSize: 10, MultipartThreshold: 10}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err == nil {
+		t.Error("Expected error from CreateMultipartUpload")
+	}
+}
+
+// rangedGetObject serves byte ranges of content the way S3 does.
+func rangedGetObject(t *testing.T, content []byte, etag string) func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		if aws.ToString(params.IfMatch) != etag {
+			t.Errorf("Expected IfMatch %q, got %q", etag, aws.ToString(params.IfMatch))
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &start, &end); err != nil {
+			t.Errorf("Unexpected range %q: %v", aws.ToString(params.Range), err)
+			return nil, err
+		}
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content[start : end+1])),
+		}, nil
+	}
+}
+
+func TestDownloadFile_Ranged(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxy")
+	localPath := filepath.Join(t.TempDir(), "out.bin")
+
+	var gets atomic.Int32
+	serve := rangedGetObject(t, content, `"abc"`)
+	mockS3 := &mockS3Client{
+		headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(int64(len(content))),
+				ETag:          aws.String(`"abc"`),
+			}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			gets.Add(1)
+			return serve(ctx, params, optFns...)
+		},
+	}
+
+	opts := Options{Concurrency: 4, PartSize: 8, MultipartThreshold: 8}
+	if err := downloadFile(context.Background(), mockS3, "test-bucket", "large.bin", localPath, opts); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Downloaded content = %q, want %q", got, content)
+	}
+	if gets.Load() != 5 {
+		t.Errorf("Expected 5 ranged GetObject calls, got %d", gets.Load())
+	}
+}
+
+func TestDownloadFile_BelowThresholdSingleRequest(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "out.txt")
+
+	mockS3 := &mockS3Client{
+		headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(5)}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			if params.Range != nil {
+				t.Errorf("Expected a single whole-object request, got range %s", aws.ToString(params.Range))
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("small")))}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 4, PartSize: 8, MultipartThreshold: 8}
+	if err := downloadFile(context.Background(), mockS3, "test-bucket", "small", localPath, opts); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(got) != "small" {
+		t.Errorf("Downloaded content = %q, want %q", got, "small")
+	}
+}
+
+func TestDownloadFile_RangedShortRead(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "out.bin")
+
+	mockS3 := &mockS3Client{
+		headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(16)}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("abc")))}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 2, PartSize: 8, MultipartThreshold: 8}
+	if err := downloadFile(context.Background(), mockS3, "test-bucket", "large.bin", localPath, opts); err == nil {
+		t.Error("Expected error for short range read")
+	}
+}
+
+func TestDownloadFile_HeadObjectError(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "out.bin")
+
+	mockS3 := &mockS3Client{
+		headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			return nil, errors.New("head failed")
+		},
+	}
+
+	opts := Options{PartSize: 8, MultipartThreshold: 8}
+	if err := downloadFile(context.Background(), mockS3, "test-bucket", "large.bin", localPath, opts); err == nil {
+		t.Error("Expected error from HeadObject")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// maxInlineOutput is how many characters of standard output and standard
+// error GetCommandInvocation returns before truncating them.
+const maxInlineOutput = 24000
+
+// Output streams SSM writes for each command.
+const (
+	stdoutStream = "stdout"
+	stderrStream = "stderr"
+)
+
+// commandOutputStore is the S3 location SSM writes the complete output of
+// commands to, read back when GetCommandInvocation truncates it.
+type commandOutputStore struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+// commandOutputPrefix returns the key prefix SSM writes the output of the
+// commands run for transferID under.
+func commandOutputPrefix(transferID string) string {
+	return transferPrefix(transferID) + "ssm-output"
+}
+
+// apply has SSM write the output of the command sent with input to s.
+func (s *commandOutputStore) apply(input *ssm.SendCommandInput) {
+	if s == nil {
+		return
+	}
+	input.OutputS3BucketName = aws.String(s.bucket)
+	input.OutputS3KeyPrefix = aws.String(s.prefix)
+}
+
+// complete returns content, the stream of commandID's invocation on
+// instanceID as returned by GetCommandInvocation, replaced with the full
+// stream from S3 when it was truncated.
+func (s *commandOutputStore) complete(ctx context.Context, commandID, instanceID, stream, content string) string {
+	if s == nil || utf8.RuneCountInString(content) < maxInlineOutput {
+		return content
+	}
+
+	full, err := s.fetch(ctx, commandID, instanceID, stream)
+	if err != nil {
+		log.Warn("Output of command %s is truncated, failed to read the full %s from S3: %v", commandID, stream, err)
+		return content
+	}
+	return full
+}
+
+// fetch reads stream of commandID's invocation on instanceID from S3.
+// SSM nests it under a directory for each plugin the document ran, so
+// the stream is found by name rather than by its full key.
+func (s *commandOutputStore) fetch(ctx context.Context, commandID, instanceID, stream string) (string, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(path.Join(s.prefix, commandID, instanceID) + "/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list command output: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if path.Base(key) != stream {
+				continue
+			}
+
+			result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to download command output: %w", err)
+			}
+			defer func() {
+				if closeErr := result.Body.Close(); closeErr != nil {
+					log.Warn("Failed to close S3 object body: %v", closeErr)
+				}
+			}()
+
+			data, err := io.ReadAll(result.Body)
+			if err != nil {
+				return "", fmt.Errorf("failed to read command output: %w", err)
+			}
+			return string(data), nil
+		}
+	}
+	return "", fmt.Errorf("no %s was written to s3://%s/%s", stream, s.bucket, s.prefix)
+}
+
+// cleanup deletes the output SSM wrote for commandID. It runs without
+// ctx's cancellation so the output of interrupted commands is removed
+// too.
+func (s *commandOutputStore) cleanup(ctx context.Context, commandID string) {
+	if s == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	if err := CleanupS3Objects(ctx, s.client, s.bucket, path.Join(s.prefix, commandID)+"/", true); err != nil {
+		log.Warn("Failed to clean up output of command %s: %v", commandID, err)
+	}
+}
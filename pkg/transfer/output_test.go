@@ -0,0 +1,186 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// outputS3Client returns a mock bucket holding objects, recording the
+// keys deleted from it.
+func outputS3Client(objects map[string]string, deleted *[]string) *mockS3Client {
+	return &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			var contents []s3types.Object
+			for key := range objects {
+				if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+					contents = append(contents, s3types.Object{Key: aws.String(key)})
+				}
+			}
+			return &s3.ListObjectsV2Output{Contents: contents}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			content, ok := objects[aws.ToString(params.Key)]
+			if !ok {
+				return nil, errors.New("NoSuchKey")
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(content))}, nil
+		},
+		deleteObjectFunc: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			*deleted = append(*deleted, aws.ToString(params.Key))
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+}
+
+func TestRunSSMDocument_ReadsTruncatedOutputFromS3(t *testing.T) {
+	full := strings.Repeat("./file\n", 5000)
+	prefix := "bcp/transfer-1/ssm-output/test-command-id/i-1234567890abcdef0/awsrunShellScript/0.awsrunShellScript/"
+	var deleted []string
+	store := &commandOutputStore{
+		client: outputS3Client(map[string]string{prefix + "stdout": full, prefix + "stderr": ""}, &deleted),
+		bucket: "test-bucket",
+		prefix: commandOutputPrefix("transfer-1"),
+	}
+
+	var sent *ssm.SendCommandInput
+	mockSSM := &mockSSMClient{
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			sent = params
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String("test-command-id")}}, nil
+		},
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                types.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(full[:maxInlineOutput]),
+			}, nil
+		},
+	}
+
+	host := remoteHost{client: mockSSM, id: "i-1234567890abcdef0", platform: platformPOSIX, timeout: time.Minute, output: store}
+	output, err := host.run(context.Background(), "find .")
+	if err != nil {
+		t.Fatalf("remoteHost.run() error = %v", err)
+	}
+	if output != full {
+		t.Errorf("remoteHost.run() returned %d bytes, want the full %d bytes", len(output), len(full))
+	}
+	if aws.ToString(sent.OutputS3BucketName) != "test-bucket" || aws.ToString(sent.OutputS3KeyPrefix) != "bcp/transfer-1/ssm-output" {
+		t.Errorf("SendCommand output location = s3://%s/%s", aws.ToString(sent.OutputS3BucketName), aws.ToString(sent.OutputS3KeyPrefix))
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Expected the stdout and stderr objects to be deleted, got %v", deleted)
+	}
+}
+
+func TestRunSSMDocument_ReadsTruncatedErrorFromS3(t *testing.T) {
+	full := strings.Repeat("permission denied\n", 2000)
+	var deleted []string
+	store := &commandOutputStore{
+		client: outputS3Client(map[string]string{
+			"bcp/ssm-output/test-command-id/i-1234567890abcdef0/awsrunShellScript/0.awsrunShellScript/stderr": full,
+		}, &deleted),
+		bucket: "test-bucket",
+		prefix: commandOutputPrefix(""),
+	}
+	mockSSM := &mockSSMClient{
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:               types.CommandInvocationStatusFailed,
+				StandardErrorContent: aws.String(full[:maxInlineOutput]),
+			}, nil
+		},
+	}
+
+	host := remoteHost{client: mockSSM, id: "i-1234567890abcdef0", platform: platformPOSIX, timeout: time.Minute, output: store}
+	_, err := host.run(context.Background(), "cat /root/x")
+	if err == nil || !strings.HasSuffix(err.Error(), full) {
+		t.Errorf("remoteHost.run() error should carry the full standard error")
+	}
+}
+
+func TestCommandOutputStore_Complete(t *testing.T) {
+	truncated := strings.Repeat("a", maxInlineOutput)
+
+	tests := []struct {
+		name    string
+		objects map[string]string
+		content string
+		want    string
+	}{
+		{
+			name:    "short output is not fetched",
+			objects: map[string]string{"out/cmd/i-1/step/stdout": "unexpected"},
+			content: "short",
+			want:    "short",
+		},
+		{
+			name:    "truncated output is fetched",
+			objects: map[string]string{"out/cmd/i-1/step/stdout": truncated + "tail"},
+			content: truncated,
+			want:    truncated + "tail",
+		},
+		{
+			name:    "missing object keeps truncated output",
+			objects: map[string]string{},
+			content: truncated,
+			want:    truncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			store := &commandOutputStore{client: outputS3Client(tt.objects, &deleted), bucket: "test-bucket", prefix: "out"}
+
+			if got := store.complete(context.Background(), "cmd", "i-1", stdoutStream, tt.content); got != tt.want {
+				t.Errorf("complete() returned %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestCommandOutputStore_Nil(t *testing.T) {
+	var store *commandOutputStore
+	input := &ssm.SendCommandInput{}
+
+	store.apply(input)
+	if input.OutputS3BucketName != nil || input.OutputS3KeyPrefix != nil {
+		t.Error("nil store should not set an output location")
+	}
+	if got := store.complete(context.Background(), "cmd", "i-1", stdoutStream, "content"); got != "content" {
+		t.Errorf("complete() = %q, want content", got)
+	}
+	store.cleanup(context.Background(), "cmd")
+}
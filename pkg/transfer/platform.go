@@ -0,0 +1,235 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// remotePlatform is the kind of shell commands run in on an instance.
+type remotePlatform string
+
+const (
+	// platformPOSIX instances (Linux and macOS) run commands with sh.
+	platformPOSIX remotePlatform = "posix"
+	// platformWindows instances run commands with PowerShell.
+	platformWindows remotePlatform = "windows"
+)
+
+// SSM documents used to run commands on each platform.
+const (
+	shellScriptDocument      = "AWS-RunShellScript"
+	powerShellScriptDocument = "AWS-RunPowerShellScript"
+)
+
+// defaultCommandTimeout is how long SSM commands may run when the
+// transfer does not set a timeout, matching SSM's own default.
+const defaultCommandTimeout = time.Hour
+
+// remoteHost is a managed instance that commands are run on through SSM.
+type remoteHost struct {
+	client   SSMAPI
+	id       string
+	platform remotePlatform
+	// timeout bounds how long each command may run; zero uses
+	// defaultCommandTimeout
+	timeout time.Duration
+	// output is where SSM writes the full output of commands, if set
+	output *commandOutputStore
+}
+
+// run executes commands on the host with the SSM document for its
+// platform and returns their standard output.
+func (h remoteHost) run(ctx context.Context, commands ...string) (string, error) {
+	timeout := h.timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	results, err := runSSMDocument(ctx, h.client, []string{h.id}, h.platform.document(), commands, timeout, h.output)
+	if err != nil {
+		return "", err
+	}
+	return results[h.id].output, results[h.id].err
+}
+
+// detectPlatform looks up the platform of instanceID from SSM's inventory
+// of managed instances.
+func detectPlatform(ctx context.Context, client SSMAPI, instanceID string) (remotePlatform, error) {
+	result, err := client.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []types.InstanceInformationStringFilter{
+			{Key: aws.String("InstanceIds"), Values: []string{instanceID}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+	if len(result.InstanceInformationList) == 0 {
+		return "", fmt.Errorf("instance %s is not managed by SSM", instanceID)
+	}
+
+	if result.InstanceInformationList[0].PlatformType == types.PlatformTypeWindows {
+		return platformWindows, nil
+	}
+	return platformPOSIX, nil
+}
+
+// connectHost returns the remote host for transferConfig, reusing the
+// platform recorded in j when resuming. Command output is written to the
+// transfer's staging bucket through s3Client.
+func connectHost(ctx context.Context, client SSMAPI, s3Client S3API, transferConfig model.TransferConfig, j *journal.Journal) (remoteHost, error) {
+	host := remoteHost{
+		client:   client,
+		id:       transferConfig.SSMInstanceID,
+		platform: remotePlatform(j.Value(platformValue)),
+		timeout:  time.Duration(transferConfig.CommandTimeout) * time.Second,
+		output: &commandOutputStore{
+			client: s3Client,
+			bucket: transferConfig.BucketName,
+			prefix: commandOutputPrefix(transferConfig.TransferID),
+		},
+	}
+	if host.platform != "" {
+		return host, nil
+	}
+
+	platform, err := detectPlatform(ctx, client, host.id)
+	if err != nil {
+		return remoteHost{}, err
+	}
+	log.Debug("Instance %s runs %s commands", host.id, platform)
+
+	host.platform = platform
+	logJournalError(j.SetValue(platformValue, string(platform)))
+	return host, nil
+}
+
+// document returns the SSM document that runs shell commands on p.
+func (p remotePlatform) document() string {
+	if p == platformWindows {
+		return powerShellScriptDocument
+	}
+	return shellScriptDocument
+}
+
+// join appends the slash-separated relative path rel to dir using the
+// platform's path separator.
+func (p remotePlatform) join(dir, rel string) string {
+	if p == platformWindows {
+		return strings.TrimRight(dir, `\/`) + `\` + strings.ReplaceAll(rel, "/", `\`)
+	}
+	return path.Join(dir, rel)
+}
+
+// base returns the last element of remotePath.
+func (p remotePlatform) base(remotePath string) string {
+	if p == platformWindows {
+		remotePath = strings.TrimRight(remotePath, `\/`)
+		if i := strings.LastIndexAny(remotePath, `\/`); i >= 0 {
+			return remotePath[i+1:]
+		}
+		return remotePath
+	}
+	return path.Base(remotePath)
+}
+
+// awsCLICheckCommand prints the location of the AWS CLI, failing if it is
+// not installed.
+func (p remotePlatform) awsCLICheckCommand() string {
+	if p == platformWindows {
+		return "(Get-Command aws -ErrorAction Stop).Source"
+	}
+	return "which aws"
+}
+
+// toolsCommand prints the location of each program the instance can
+// reach S3 with, one per line, succeeding even when none is installed.
+func (p remotePlatform) toolsCommand() string {
+	if p == platformWindows {
+		return "(Get-Command aws -ErrorAction SilentlyContinue).Source"
+	}
+	return "for t in aws curl wget; do command -v \"$t\"; done; true"
+}
+
+// isDirectoryCommand prints "directory" if remotePath is a directory and
+// "file" otherwise.
+func (p remotePlatform) isDirectoryCommand(remotePath string) string {
+	if p == platformWindows {
+		return fmt.Sprintf("if (Test-Path -LiteralPath %s -PathType Container) { 'directory' } else { 'file' }", psQuote(remotePath))
+	}
+	return fmt.Sprintf("test -d %s && echo 'directory' || echo 'file'", shQuote(remotePath))
+}
+
+// listFilesCommand prints the path of every regular file under dir,
+// relative to dir and prefixed with "./", one per line.
+func (p remotePlatform) listFilesCommand(dir string) string {
+	if p == platformWindows {
+		return fmt.Sprintf("$root = (Resolve-Path -LiteralPath %s).Path; "+
+			"Get-ChildItem -LiteralPath $root -Recurse -File | ForEach-Object { './' + %s }", psQuote(dir), psRelativePath)
+	}
+	return fmt.Sprintf("cd %s && find . -type f", shQuote(dir))
+}
+
+// psRelativePath is a PowerShell expression for the slash-separated path
+// of $_ relative to $root.
+const psRelativePath = `$_.FullName.Substring($root.Length).TrimStart('\').Replace('\', '/')`
+
+// checksumCommand prints sha256sum-formatted hashes for the files of a
+// transfer. For a single file whose path turned out to be a directory,
+// the file inside it is hashed instead, mirroring where it is copied to.
+func (p remotePlatform) checksumCommand(remotePath string, isDirectory bool, name string) string {
+	if p == platformWindows {
+		if isDirectory {
+			return fmt.Sprintf("$root = (Resolve-Path -LiteralPath %s).Path; "+
+				"Get-ChildItem -LiteralPath $root -Recurse -File | ForEach-Object { '{0}  ./{1}' -f (Get-FileHash -LiteralPath $_.FullName -Algorithm SHA256).Hash.ToLower(), %s }",
+				psQuote(remotePath), psRelativePath)
+		}
+		return fmt.Sprintf("$p = %s; if (Test-Path -LiteralPath $p -PathType Container) { $p = Join-Path $p %s }; "+
+			"'{0}  {1}' -f (Get-FileHash -LiteralPath $p -Algorithm SHA256).Hash.ToLower(), $p",
+			psQuote(remotePath), psQuote(name))
+	}
+
+	if isDirectory {
+		return fmt.Sprintf("cd %s && find . -type f -exec sha256sum {} +", shQuote(remotePath))
+	}
+	return fmt.Sprintf("p=%s; [ -d \"$p\" ] && p=\"$p\"/%s; sha256sum \"$p\"", shQuote(remotePath), shQuote(name))
+}
+
+// stopOnErrorCommand makes the rest of a command batch stop at the first
+// failing command.
+func (p remotePlatform) stopOnErrorCommand() string {
+	if p == platformWindows {
+		return "$ErrorActionPreference = 'Stop'"
+	}
+	return "set -e"
+}
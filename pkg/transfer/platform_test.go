@@ -0,0 +1,274 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances []types.InstanceInformation
+		err       error
+		expected  remotePlatform
+		wantErr   bool
+	}{
+		{
+			name:      "linux",
+			instances: []types.InstanceInformation{{PlatformType: types.PlatformTypeLinux}},
+			expected:  platformPOSIX,
+		},
+		{
+			name:      "macos",
+			instances: []types.InstanceInformation{{PlatformType: types.PlatformTypeMacos}},
+			expected:  platformPOSIX,
+		},
+		{
+			name:      "windows",
+			instances: []types.InstanceInformation{{PlatformType: types.PlatformTypeWindows}},
+			expected:  platformWindows,
+		},
+		{
+			name:    "not managed by SSM",
+			wantErr: true,
+		},
+		{
+			name:    "describe fails",
+			err:     errors.New("access denied"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSSM := &mockSSMClient{
+				describeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+					if got := params.Filters[0].Values; len(got) != 1 || got[0] != "i-1234567890abcdef0" {
+						t.Errorf("filter values = %v, want the instance ID", got)
+					}
+					return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: tt.instances}, tt.err
+				},
+			}
+
+			got, err := detectPlatform(context.Background(), mockSSM, "i-1234567890abcdef0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectPlatform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("detectPlatform() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConnectHost_ReusesJournaledPlatform(t *testing.T) {
+	j := newTestJournal(t, model.TransferConfig{Direction: model.ToRemote})
+	if err := j.SetValue(platformValue, string(platformWindows)); err != nil {
+		t.Fatal(err)
+	}
+
+	mockSSM := &mockSSMClient{
+		describeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+			t.Error("platform should not be detected again when resuming")
+			return nil, errors.New("unexpected call")
+		},
+	}
+
+	host, err := connectHost(context.Background(), mockSSM, &mockS3Client{}, model.TransferConfig{SSMInstanceID: "i-1234567890abcdef0"}, j)
+	if err != nil {
+		t.Fatalf("connectHost() error = %v", err)
+	}
+	if host.platform != platformWindows {
+		t.Errorf("connectHost() platform = %q, want %q", host.platform, platformWindows)
+	}
+}
+
+func TestRemotePlatformPaths(t *testing.T) {
+	tests := []struct {
+		platform remotePlatform
+		dir      string
+		rel      string
+		joined   string
+		base     string
+	}{
+		{platformPOSIX, "/opt/app", "conf/app.yaml", "/opt/app/conf/app.yaml", "app.yaml"},
+		{platformPOSIX, "/opt/app/", "app.yaml", "/opt/app/app.yaml", "app.yaml"},
+		{platformWindows, `C:\app`, "conf/app.yaml", `C:\app\conf\app.yaml`, "app.yaml"},
+		{platformWindows, `C:\app\`, "app.yaml", `C:\app\app.yaml`, "app.yaml"},
+		{platformWindows, "C:/app", "app.yaml", `C:/app\app.yaml`, "app.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.platform)+" "+tt.dir, func(t *testing.T) {
+			joined := tt.platform.join(tt.dir, tt.rel)
+			if joined != tt.joined {
+				t.Errorf("join() = %q, want %q", joined, tt.joined)
+			}
+			if base := tt.platform.base(joined); base != tt.base {
+				t.Errorf("base() = %q, want %q", base, tt.base)
+			}
+		})
+	}
+}
+
+func TestRemotePlatformCommands(t *testing.T) {
+	if got := platformWindows.document(); got != "AWS-RunPowerShellScript" {
+		t.Errorf("windows document() = %q", got)
+	}
+	if got := platformPOSIX.document(); got != "AWS-RunShellScript" {
+		t.Errorf("posix document() = %q", got)
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		contains []string
+	}{
+		{
+			name:     "windows directory check",
+			command:  platformWindows.isDirectoryCommand(`C:\Program Files\app`),
+			contains: []string{"Test-Path -LiteralPath 'C:\\Program Files\\app' -PathType Container"},
+		},
+		{
+			name:     "windows quotes single quotes",
+			command:  platformWindows.isDirectoryCommand(`C:\it's`),
+			contains: []string{`'C:\it''s'`},
+		},
+		{
+			name:     "windows directory checksums",
+			command:  platformWindows.checksumCommand(`C:\app`, true, "app"),
+			contains: []string{"Get-FileHash", "-Recurse -File", "'C:\\app'"},
+		},
+		{
+			name:     "windows file checksum",
+			command:  platformWindows.checksumCommand(`C:\app`, false, "app.exe"),
+			contains: []string{"Join-Path $p 'app.exe'", "Get-FileHash -LiteralPath $p -Algorithm SHA256"},
+		},
+		{
+			name:     "windows file listing",
+			command:  platformWindows.listFilesCommand(`C:\logs`),
+			contains: []string{"Get-ChildItem -LiteralPath $root -Recurse -File", "'./' +"},
+		},
+		{
+			name:     "posix directory check",
+			command:  platformPOSIX.isDirectoryCommand("/var/log"),
+			contains: []string{"test -d /var/log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range tt.contains {
+				if !strings.Contains(tt.command, want) {
+					t.Errorf("command %q does not contain %q", tt.command, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPresignedCommands_Windows(t *testing.T) {
+	get := presignedGetCommand(toolInvokeWebRequest, "https://b.s3.amazonaws.com/k?sig", `C:\app`, "app.exe", true)
+	for _, want := range []string{
+		"$p = 'C:\\app';",
+		"Join-Path $p 'app.exe'",
+		"New-Item -ItemType Directory -Force -Path (Split-Path -Parent $p)",
+		"Invoke-WebRequest -UseBasicParsing -Uri 'https://b.s3.amazonaws.com/k?sig' -OutFile $p",
+	} {
+		if !strings.Contains(get, want) {
+			t.Errorf("presignedGetCommand() = %q, want it to contain %q", get, want)
+		}
+	}
+
+	put := presignedPutCommand(toolInvokeWebRequest, "https://b.s3.amazonaws.com/k?sig", `C:\logs\app.log`, nil)
+	for _, want := range []string{
+		"$p = 'C:\\logs\\app.log';",
+		"if ((Get-Item -LiteralPath $p).Length -gt 5368709120) { throw",
+		"Invoke-WebRequest -UseBasicParsing -Method Put -Uri 'https://b.s3.amazonaws.com/k?sig' -InFile $p",
+	} {
+		if !strings.Contains(put, want) {
+			t.Errorf("presignedPutCommand() = %q, want it to contain %q", put, want)
+		}
+	}
+}
+
+func TestExecuteToRemoteWithClients_Windows(t *testing.T) {
+	testFile := writeTempFile(t, []byte("test content"))
+
+	var mu sync.Mutex
+	var documents []string
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		switch {
+		case strings.Contains(command, "Get-Command aws"):
+			return `C:\Program Files\Amazon\AWSCLIV2\aws.exe` + "\n"
+		case strings.Contains(command, "Get-FileHash"):
+			return sha256Hex("test content") + `  C:\app\app.conf` + "\n"
+		}
+		return ""
+	})
+	sendCommand := mockSSM.sendCommandFunc
+	mockSSM.sendCommandFunc = func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+		mu.Lock()
+		documents = append(documents, aws.ToString(params.DocumentName))
+		mu.Unlock()
+		return sendCommand(ctx, params, optFns...)
+	}
+	mockSSM.describeInstanceInformationFunc = func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+		return &ssm.DescribeInstanceInformationOutput{
+			InstanceInformationList: []types.InstanceInformation{{PlatformType: types.PlatformTypeWindows}},
+		}, nil
+	}
+
+	transferConfig := model.TransferConfig{
+		Source:        testFile,
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   `C:\app\app.conf`,
+		BucketName:    "test-bucket",
+		MaxRetries:    0,
+		RetryDelay:    1,
+		Direction:     model.ToRemote,
+	}
+
+	if err := ExecuteToRemoteWithClients(context.Background(), transferConfig, &mockS3Client{}, mockSSM); err != nil {
+		t.Fatalf("ExecuteToRemoteWithClients() error = %v", err)
+	}
+
+	if len(documents) == 0 {
+		t.Fatal("Expected SSM commands to be sent")
+	}
+	for _, document := range documents {
+		if document != powerShellScriptDocument {
+			t.Errorf("SendCommand document = %q, want %q", document, powerShellScriptDocument)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		jobErrors   []error
+		expectError bool
+	}{
+		{
+			name:        "no jobs",
+			concurrency: 4,
+			jobErrors:   nil,
+			expectError: false,
+		},
+		{
+			name:        "all succeed",
+			concurrency: 2,
+			jobErrors:   []error{nil, nil, nil, nil, nil},
+			expectError: false,
+		},
+		{
+			name:        "zero concurrency runs sequentially",
+			concurrency: 0,
+			jobErrors:   []error{nil, nil},
+			expectError: false,
+		},
+		{
+			name:        "transient errors are aggregated",
+			concurrency: 2,
+			jobErrors:   []error{nil, errors.New("connection reset"), nil, errors.New("i/o timeout")},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran atomic.Int32
+			jobs := make([]job, 0, len(tt.jobErrors))
+			for _, jobErr := range tt.jobErrors {
+				jobs = append(jobs, func(ctx context.Context) error {
+					ran.Add(1)
+					return jobErr
+				})
+			}
+
+			err := runPool(context.Background(), tt.concurrency, jobs)
+			if (err != nil) != tt.expectError {
+				t.Errorf("runPool() error = %v, expectError %v", err, tt.expectError)
+			}
+			if int(ran.Load()) != len(tt.jobErrors) {
+				t.Errorf("Expected %d jobs to run, got %d", len(tt.jobErrors), ran.Load())
+			}
+		})
+	}
+}
+
+func TestRunPool_AggregatesAllErrors(t *testing.T) {
+	first := errors.New("connection reset on a")
+	second := errors.New("connection reset on b")
+
+	jobs := []job{
+		func(ctx context.Context) error { return first },
+		func(ctx context.Context) error { return nil },
+		func(ctx context.Context) error { return second },
+	}
+
+	err := runPool(context.Background(), 3, jobs)
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Errorf("Expected both job errors to be reported, got: %v", err)
+	}
+}
+
+func TestRunPool_BoundsConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+
+	jobs := make([]job, 20)
+	for i := range jobs {
+		jobs[i] = func(ctx context.Context) error {
+			n := active.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			active.Add(-1)
+			return nil
+		}
+	}
+
+	if err := runPool(context.Background(), 3, jobs); err != nil {
+		t.Fatalf("runPool() error = %v", err)
+	}
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 concurrent jobs, got %d", peak.Load())
+	}
+}
+
+func TestRunPool_FatalErrorCancelsRemainingWork(t *testing.T) {
+	var ran atomic.Int32
+	fatal := errors.New("access denied")
+
+	jobs := make([]job, 50)
+	jobs[0] = func(ctx context.Context) error {
+		ran.Add(1)
+		return fatal
+	}
+	for i := 1; i < len(jobs); i++ {
+		jobs[i] = func(ctx context.Context) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			ran.Add(1)
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+	}
+
+	err := runPool(context.Background(), 1, jobs)
+	if !errors.Is(err, fatal) {
+		t.Errorf("Expected fatal error to be returned, got: %v", err)
+	}
+	if ran.Load() != 1 {
+		t.Errorf("Expected remaining jobs to be skipped after fatal error, %d ran", ran.Load())
+	}
+}
+
+func TestRunPool_ParentContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	jobs := []job{
+		func(ctx context.Context) error { return nil },
+	}
+
+	err := runPool(ctx, 1, jobs)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// remoteTool names the program the instance uses to move bytes to and
+// from the staging bucket.
+type remoteTool string
+
+const (
+	toolAWSCLI remoteTool = "aws"
+	toolCurl   remoteTool = "curl"
+	toolWget   remoteTool = "wget"
+	// toolInvokeWebRequest is PowerShell's built-in HTTP client, always
+	// present on Windows instances.
+	toolInvokeWebRequest remoteTool = "Invoke-WebRequest"
+)
+
+// URLs are presigned just before the batch of commands using them is
+// sent, so they only need to stay valid while the batch runs: for
+// presignExpiry, or for as long as the batch may run if that is longer,
+// up to the longest expiry S3 accepts.
+const (
+	presignExpiry    = time.Hour
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// maxPresignedUploadSize is the largest file a single presigned PUT can
+// upload. Larger files need a multipart upload, which only the AWS CLI
+// can make.
+const maxPresignedUploadSize = 5 << 30
+
+// commandBatchSize caps how many files are handled by a single SSM
+// command so the command document stays well within SSM's size limit.
+const commandBatchSize = 25
+
+// presignerFor returns a presigner for client. Clients that already
+// implement PresignAPI are used directly.
+func presignerFor(client S3API) (PresignAPI, error) {
+	switch c := client.(type) {
+	case PresignAPI:
+		return c, nil
+	case *s3.Client:
+		return s3.NewPresignClient(c), nil
+	}
+	return nil, fmt.Errorf("S3 client does not support presigned URLs")
+}
+
+// selectRemoteTool decides how the instance will reach S3 for the given
+// transport mode.
+func selectRemoteTool(ctx context.Context, host remoteHost, mode model.RemoteTransport) (remoteTool, error) {
+	switch mode {
+	case model.RemoteTransportAWSCLI:
+		if err := requireAWSCLI(ctx, host); err != nil {
+			return "", err
+		}
+		return toolAWSCLI, nil
+	case model.RemoteTransportPresigned:
+		return requireDownloader(ctx, host)
+	}
+
+	log.Info("Checking if AWS CLI is installed on instance %s...", host.id)
+	installed, err := checkAWSCLIInstalled(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to check AWS CLI installation: %w", err)
+	}
+	if installed {
+		log.Info("AWS CLI is installed on remote instance")
+		return toolAWSCLI, nil
+	}
+
+	log.Info("AWS CLI is not installed on instance %s, falling back to presigned URLs", host.id)
+	return requireDownloader(ctx, host)
+}
+
+// requireDownloader returns the HTTP client available on the instance
+// for presigned transfers, preferring curl over wget. Windows instances
+// always use Invoke-WebRequest.
+func requireDownloader(ctx context.Context, host remoteHost) (remoteTool, error) {
+	if host.platform == platformWindows {
+		log.Info("Using Invoke-WebRequest with presigned URLs on remote instance")
+		return toolInvokeWebRequest, nil
+	}
+
+	log.Info("Checking for curl or wget on instance %s...", host.id)
+	output, err := host.run(ctx, "command -v curl || command -v wget")
+	if err != nil && !strings.Contains(err.Error(), "command failed") {
+		return "", fmt.Errorf("failed to check for curl or wget: %w", err)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		switch path.Base(strings.TrimSpace(line)) {
+		case string(toolCurl):
+			log.Info("Using curl with presigned URLs on remote instance")
+			return toolCurl, nil
+		case string(toolWget):
+			log.Info("Using wget with presigned URLs on remote instance")
+			return toolWget, nil
+		}
+	}
+
+	return "", fmt.Errorf("neither the AWS CLI nor curl or wget is installed on instance %s", host.id)
+}
+
+// presignedFile pairs a staged object with its path on the instance.
+type presignedFile struct {
+	Key        string
+	RemotePath string
+}
+
+// presignedGetCommand returns a shell command that downloads url to
+// remotePath with tool, creating parent directories as needed. When
+// intoDirectory is set and remotePath is an existing directory, the file
+// is written inside it as name, the way aws s3 cp behaves.
+func presignedGetCommand(tool remoteTool, url, remotePath, name string, intoDirectory bool) string {
+	var b strings.Builder
+	if tool == toolInvokeWebRequest {
+		fmt.Fprintf(&b, "$p = %s; ", psQuote(remotePath))
+		if intoDirectory {
+			fmt.Fprintf(&b, "if (Test-Path -LiteralPath $p -PathType Container) { $p = Join-Path $p %s }; ", psQuote(name))
+		}
+		b.WriteString("New-Item -ItemType Directory -Force -Path (Split-Path -Parent $p) | Out-Null; ")
+		fmt.Fprintf(&b, "Invoke-WebRequest -UseBasicParsing -Uri %s -OutFile $p", psQuote(url))
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "p=%s; ", shQuote(remotePath))
+	if intoDirectory {
+		fmt.Fprintf(&b, "[ -d \"$p\" ] && p=\"$p\"/%s; ", shQuote(name))
+	}
+	b.WriteString("mkdir -p \"$(dirname \"$p\")\" && ")
+	if tool == toolWget {
+		fmt.Fprintf(&b, "wget -q -O \"$p\" %s", shQuote(url))
+	} else {
+		fmt.Fprintf(&b, "curl -fsSL -o \"$p\" %s", shQuote(url))
+	}
+	return b.String()
+}
+
+// presignedPutCommand returns a shell command that uploads remotePath to
+// url with tool, sending the headers url was signed with, such as the
+// server-side encryption to apply. The command fails without uploading
+// anything when the file is larger than a presigned PUT can send.
+func presignedPutCommand(tool remoteTool, url, remotePath string, headers http.Header) string {
+	var names []string
+	for name := range headers {
+		if !strings.EqualFold(name, "Host") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(headers.Values(name), ",")
+		switch tool {
+		case toolInvokeWebRequest:
+			fmt.Fprintf(&b, "%s = %s; ", psQuote(name), psQuote(value))
+		case toolWget:
+			fmt.Fprintf(&b, " --header=%s", shQuote(name+": "+value))
+		default:
+			fmt.Fprintf(&b, " -H %s", shQuote(name+": "+value))
+		}
+	}
+
+	tooLarge := fmt.Sprintf("is larger than %d bytes, the most a presigned upload can send; install the AWS CLI on the instance to copy it", maxPresignedUploadSize)
+	switch tool {
+	case toolInvokeWebRequest:
+		var headerArg string
+		if b.Len() > 0 {
+			headerArg = " -Headers @{ " + strings.TrimSuffix(b.String(), " ") + " }"
+		}
+		return fmt.Sprintf("$p = %s; if ((Get-Item -LiteralPath $p).Length -gt %d) { throw \"$p %s\" }; Invoke-WebRequest -UseBasicParsing -Method Put -Uri %s -InFile $p%s",
+			psQuote(remotePath), maxPresignedUploadSize, tooLarge, psQuote(url), headerArg)
+	}
+
+	command := fmt.Sprintf("curl -fsS -T \"$p\"%s %s", b.String(), shQuote(url))
+	if tool == toolWget {
+		command = fmt.Sprintf("wget -q -O /dev/null --method=PUT --body-file=\"$p\"%s %s", b.String(), shQuote(url))
+	}
+	return fmt.Sprintf("p=%s; [ \"$(wc -c < \"$p\")\" -le %d ] || { echo \"$p %s\" >&2; exit 1; }; %s",
+		shQuote(remotePath), maxPresignedUploadSize, tooLarge, command)
+}
+
+// presignedDownload has the instance fetch every file over presigned GET
+// URLs. A single file may land inside remote destination directories,
+// matching aws s3 cp.
+func presignedDownload(ctx context.Context, presigner PresignAPI, host remoteHost, transferConfig model.TransferConfig, tool remoteTool, files []presignedFile) error {
+	return runBatches(ctx, host, transferConfig, len(files), func(i int) (string, error) {
+		return presignedGet(ctx, presigner, transferConfig, tool, files[i])
+	})
+}
+
+// presignedGet returns a command that downloads file with tool over a
+// newly presigned GET URL.
+func presignedGet(ctx context.Context, presigner PresignAPI, transferConfig model.TransferConfig, tool remoteTool, file presignedFile) (string, error) {
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(transferConfig.BucketName),
+		Key:    aws.String(file.Key),
+	}, s3.WithPresignExpires(presignExpiryFor(transferConfig)))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download of %s: %w", file.Key, err)
+	}
+	return presignedGetCommand(tool, req.URL, file.RemotePath, path.Base(file.Key), !transferConfig.IsDirectory), nil
+}
+
+// presignedUpload has the instance send every file under the remote
+// source to uploadPath over presigned PUT URLs, laid out the same way
+// aws s3 cp --recursive would. Files larger than maxPresignedUploadSize
+// fail on the instance before they are sent.
+func presignedUpload(ctx context.Context, presigner PresignAPI, host remoteHost, transferConfig model.TransferConfig, tool remoteTool, uploadPath string, isDirectory bool) error {
+	files := []presignedFile{{Key: uploadPath, RemotePath: transferConfig.Source}}
+	if isDirectory {
+		relPaths, err := listRemoteFiles(ctx, host, transferConfig.Source)
+		if err != nil {
+			return err
+		}
+		files = files[:0]
+		for _, relPath := range relPaths {
+			files = append(files, presignedFile{
+				Key:        uploadPath + "/" + relPath,
+				RemotePath: host.platform.join(transferConfig.Source, relPath),
+			})
+		}
+	}
+
+	return runBatches(ctx, host, transferConfig, len(files), func(i int) (string, error) {
+		return presignedPut(ctx, presigner, transferConfig, tool, files[i])
+	})
+}
+
+// presignedPut returns a command that uploads file with tool over a newly
+// presigned PUT URL.
+func presignedPut(ctx context.Context, presigner PresignAPI, transferConfig model.TransferConfig, tool remoteTool, file presignedFile) (string, error) {
+	sse, kmsKeyID := optionsFromConfig(transferConfig).encryption()
+	req, err := presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(transferConfig.BucketName),
+		Key:                  aws.String(file.Key),
+		ServerSideEncryption: sse,
+		SSEKMSKeyId:          kmsKeyID,
+	}, s3.WithPresignExpires(presignExpiryFor(transferConfig)))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload of %s: %w", file.Key, err)
+	}
+	return presignedPutCommand(tool, req.URL, file.RemotePath, req.SignedHeader), nil
+}
+
+// presignExpiryFor returns how long URLs presigned for a batch of
+// commands of the transfer must stay valid.
+func presignExpiryFor(transferConfig model.TransferConfig) time.Duration {
+	timeout := time.Duration(transferConfig.CommandTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	return min(max(presignExpiry, timeout), maxPresignExpiry)
+}
+
+// listRemoteFiles returns the slash-separated paths of every regular file
+// under dir on the instance, relative to dir.
+func listRemoteFiles(ctx context.Context, host remoteHost, dir string) ([]string, error) {
+	output, err := host.run(ctx, host.platform.listFilesCommand(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files on remote instance: %w", err)
+	}
+
+	var relPaths []string
+	for _, line := range strings.Split(output, "\n") {
+		if relPath := strings.TrimPrefix(strings.TrimSpace(line), "./"); relPath != "" {
+			relPaths = append(relPaths, relPath)
+		}
+	}
+	return relPaths, nil
+}
+
+// runBatchedCommands sends per-file commands to the instance in batches
+// of commandBatchSize, stopping at the first command that fails.
+func runBatchedCommands(ctx context.Context, host remoteHost, transferConfig model.TransferConfig, commands []string) error {
+	return runBatches(ctx, host, transferConfig, len(commands), func(i int) (string, error) {
+		return commands[i], nil
+	})
+}
+
+// runBatches sends the commands build returns for count files to the
+// instance in batches of commandBatchSize, stopping at the first command
+// that fails. Each batch is built just before every attempt to send it,
+// so that the presigned URLs in it are fresh.
+func runBatches(ctx context.Context, host remoteHost, transferConfig model.TransferConfig, count int, build func(i int) (string, error)) error {
+	for start := 0; start < count; start += commandBatchSize {
+		end := min(start+commandBatchSize, count)
+		log.Debug("Running commands for files %d-%d of %d", start+1, end, count)
+
+		if err := retryOperation(ctx, func() error {
+			batch, err := buildBatch(host.platform, start, end, build)
+			if err != nil {
+				return err
+			}
+			_, err = host.run(ctx, batch...)
+			return err
+		}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildBatch returns the commands for files start to end, led by a
+// command that stops the batch at the first failure.
+func buildBatch(platform remotePlatform, start, end int, build func(i int) (string, error)) ([]string, error) {
+	batch := []string{platform.stopOnErrorCommand()}
+	for i := start; i < end; i++ {
+		command, err := build(i)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, command)
+	}
+	return batch, nil
+}
@@ -0,0 +1,431 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+// toolSSMClient returns a mock for an instance that has only the given
+// tools installed. Tool lookups fail the way `which` and `command -v` do
+// for missing tools; every other command succeeds with respond's output.
+func toolSSMClient(tools []string, respond func(command string) string) (*mockSSMClient, *[]string) {
+	var mu sync.Mutex
+	var sent []string
+
+	client := &mockSSMClient{
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, strings.Join(params.Parameters["commands"], "\n"))
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String(fmt.Sprintf("command-%d", len(sent)-1))}}, nil
+		},
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			var index int
+			if _, err := fmt.Sscanf(aws.ToString(params.CommandId), "command-%d", &index); err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			command := sent[index]
+			mu.Unlock()
+
+			if strings.HasPrefix(command, "which ") || strings.HasPrefix(command, "command -v ") {
+				for _, tool := range tools {
+					if strings.Contains(command, " "+tool) {
+						return &ssm.GetCommandInvocationOutput{
+							Status:                types.CommandInvocationStatusSuccess,
+							StandardOutputContent: aws.String("/usr/bin/" + tool + "\n"),
+						}, nil
+					}
+				}
+				return &ssm.GetCommandInvocationOutput{Status: types.CommandInvocationStatusFailed}, nil
+			}
+
+			output := ""
+			if respond != nil {
+				output = respond(command)
+			}
+			return &ssm.GetCommandInvocationOutput{
+				Status:                types.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(output),
+			}, nil
+		},
+	}
+	return client, &sent
+}
+
+func TestPresignerFor(t *testing.T) {
+	mock := &mockS3Client{}
+	if presigner, err := presignerFor(mock); err != nil || presigner != mock {
+		t.Errorf("presignerFor(mock) = %v, %v, want the mock itself", presigner, err)
+	}
+
+	if presigner, err := presignerFor(s3.New(s3.Options{Region: "us-east-1"})); err != nil || presigner == nil {
+		t.Errorf("presignerFor(*s3.Client) = %v, %v, want a presign client", presigner, err)
+	}
+
+	if _, err := presignerFor(struct{ S3API }{mock}); err == nil {
+		t.Error("presignerFor() expected error for a client without presigning")
+	}
+}
+
+func TestSelectRemoteTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     model.RemoteTransport
+		tools    []string
+		expected remoteTool
+		wantErr  bool
+	}{
+		{"auto prefers aws cli", model.RemoteTransportAuto, []string{"aws", "curl"}, toolAWSCLI, false},
+		{"auto falls back to curl", model.RemoteTransportAuto, []string{"curl", "wget"}, toolCurl, false},
+		{"auto falls back to wget", model.RemoteTransportAuto, []string{"wget"}, toolWget, false},
+		{"empty mode behaves like auto", "", []string{"curl"}, toolCurl, false},
+		{"auto with no tools", model.RemoteTransportAuto, nil, "", true},
+		{"awscli requires aws", model.RemoteTransportAWSCLI, []string{"curl"}, "", true},
+		{"awscli", model.RemoteTransportAWSCLI, []string{"aws"}, toolAWSCLI, false},
+		{"presigned skips aws cli", model.RemoteTransportPresigned, []string{"aws", "wget"}, toolWget, false},
+		{"presigned with no downloader", model.RemoteTransportPresigned, []string{"aws"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSSM, _ := toolSSMClient(tt.tools, nil)
+
+			got, err := selectRemoteTool(context.Background(), linuxHost(mockSSM), tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectRemoteTool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("selectRemoteTool() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPresignedCommands(t *testing.T) {
+	url := "https://b.s3.amazonaws.com/k?X-Amz-Signature=x&X-Amz-Date=y"
+	sseHeaders := http.Header{
+		"Host":                         {"b.s3.amazonaws.com"},
+		"X-Amz-Server-Side-Encryption": {"aws:kms"},
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": {"alias/staging"},
+	}
+	sizeCheck := `[ "$(wc -c < "$p")" -le 5368709120 ] || { echo "$p is larger than 5368709120 bytes, the most a presigned upload can send; install the AWS CLI on the instance to copy it" >&2; exit 1; }; `
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{
+			name:     "curl get into directory",
+			command:  presignedGetCommand(toolCurl, url, "/tmp", "app.conf", true),
+			expected: `p=/tmp; [ -d "$p" ] && p="$p"/app.conf; mkdir -p "$(dirname "$p")" && curl -fsSL -o "$p" '` + url + `'`,
+		},
+		{
+			name:     "wget get",
+			command:  presignedGetCommand(toolWget, url, "/opt/app/a.txt", "a.txt", false),
+			expected: `p=/opt/app/a.txt; mkdir -p "$(dirname "$p")" && wget -q -O "$p" '` + url + `'`,
+		},
+		{
+			name:     "curl put",
+			command:  presignedPutCommand(toolCurl, url, "/var/log/app.log", nil),
+			expected: `p=/var/log/app.log; ` + sizeCheck + `curl -fsS -T "$p" '` + url + `'`,
+		},
+		{
+			name:     "wget put",
+			command:  presignedPutCommand(toolWget, url, "/var/log/app.log", nil),
+			expected: `p=/var/log/app.log; ` + sizeCheck + `wget -q -O /dev/null --method=PUT --body-file="$p" '` + url + `'`,
+		},
+		{
+			name:     "curl put with signed headers",
+			command:  presignedPutCommand(toolCurl, url, "/var/log/app.log", sseHeaders),
+			expected: `p=/var/log/app.log; ` + sizeCheck + `curl -fsS -T "$p" -H 'X-Amz-Server-Side-Encryption: aws:kms' -H 'X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id: alias/staging' '` + url + `'`,
+		},
+		{
+			name:     "wget put with signed headers",
+			command:  presignedPutCommand(toolWget, url, "/var/log/app.log", sseHeaders),
+			expected: `p=/var/log/app.log; ` + sizeCheck + `wget -q -O /dev/null --method=PUT --body-file="$p" --header='X-Amz-Server-Side-Encryption: aws:kms' --header='X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id: alias/staging' '` + url + `'`,
+		},
+		{
+			name:     "Invoke-WebRequest put with signed headers",
+			command:  presignedPutCommand(toolInvokeWebRequest, url, `C:\logs\app.log`, sseHeaders),
+			expected: `$p = 'C:\logs\app.log'; if ((Get-Item -LiteralPath $p).Length -gt 5368709120) { throw "$p is larger than 5368709120 bytes, the most a presigned upload can send; install the AWS CLI on the instance to copy it" }; Invoke-WebRequest -UseBasicParsing -Method Put -Uri '` + url + `' -InFile $p -Headers @{ 'X-Amz-Server-Side-Encryption' = 'aws:kms'; 'X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id' = 'alias/staging'; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.command != tt.expected {
+				t.Errorf("command =\n  %s\nwant\n  %s", tt.command, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunBatchedCommands_Batches(t *testing.T) {
+	mockSSM, sent := toolSSMClient(nil, nil)
+
+	commands := make([]string, commandBatchSize*2+1)
+	for i := range commands {
+		commands[i] = fmt.Sprintf("echo %d", i)
+	}
+
+	transferConfig := model.TransferConfig{SSMInstanceID: "i-1234567890abcdef0"}
+	if err := runBatchedCommands(context.Background(), linuxHost(mockSSM), transferConfig, commands); err != nil {
+		t.Fatalf("runBatchedCommands() error = %v", err)
+	}
+
+	if len(*sent) != 3 {
+		t.Fatalf("Expected 3 SSM commands, got %d", len(*sent))
+	}
+	for _, command := range *sent {
+		if !strings.HasPrefix(command, "set -e\n") {
+			t.Errorf("batch does not stop on the first failure: %q", command)
+		}
+	}
+	if !strings.HasSuffix((*sent)[2], fmt.Sprintf("echo %d", len(commands)-1)) {
+		t.Errorf("last batch = %q, want it to end with the last command", (*sent)[2])
+	}
+}
+
+func TestExecuteToRemoteWithClients_Presigned(t *testing.T) {
+	testFile := writeTempFile(t, []byte("test content"))
+
+	mockSSM, sent := toolSSMClient([]string{"aws", "curl"}, func(command string) string {
+		if strings.Contains(command, "sha256sum") {
+			return sha256Hex("test content") + "  /etc/app/large.bin\n"
+		}
+		return ""
+	})
+
+	transferConfig := model.TransferConfig{
+		TransferID:      "transfer-1",
+		Source:          testFile,
+		SSMInstanceID:   "i-1234567890abcdef0",
+		Destination:     "/etc/app/large.bin",
+		BucketName:      "test-bucket",
+		MaxRetries:      0,
+		RetryDelay:      1,
+		Direction:       model.ToRemote,
+		RemoteTransport: model.RemoteTransportPresigned,
+	}
+
+	if err := ExecuteToRemoteWithClients(context.Background(), transferConfig, &mockS3Client{}, mockSSM); err != nil {
+		t.Fatalf("ExecuteToRemoteWithClients() error = %v", err)
+	}
+
+	var download string
+	for _, command := range *sent {
+		if strings.Contains(command, "aws s3 cp") {
+			t.Errorf("presigned transport should not use the AWS CLI, got %q", command)
+		}
+		if strings.Contains(command, "curl") {
+			download = command
+		}
+	}
+	if !strings.Contains(download, "https://test-bucket.s3.amazonaws.com/bcp/transfer-1/staged/large.bin?X-Amz-Signature=get") {
+		t.Errorf("download command %q does not fetch the staged key", download)
+	}
+	if !strings.Contains(download, "p=/etc/app/large.bin;") {
+		t.Errorf("download command %q does not write to the destination", download)
+	}
+}
+
+func TestExecuteFromRemoteWithClients_PresignedDirectory(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "logs")
+
+	mockSSM, sent := toolSSMClient([]string{"wget"}, func(command string) string {
+		switch {
+		case strings.Contains(command, "test -d"):
+			return "directory\n"
+		case strings.Contains(command, "sha256sum"):
+			return ""
+		case strings.Contains(command, "find . -type f"):
+			return "./app.log\n./old/app.log.1\n"
+		}
+		return ""
+	})
+
+	var mu sync.Mutex
+	var putKeys []string
+	mockS3 := &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{}, nil
+		},
+	}
+	mockS3.presignPutFunc = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+		mu.Lock()
+		putKeys = append(putKeys, aws.ToString(params.Key))
+		mu.Unlock()
+		return &v4.PresignedHTTPRequest{URL: "https://test-bucket.s3.amazonaws.com/" + aws.ToString(params.Key) + "?X-Amz-Signature=put", Method: "PUT"}, nil
+	}
+
+	transferConfig := model.TransferConfig{
+		Source:        "/var/log/app",
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   dest,
+		BucketName:    "test-bucket",
+		MaxRetries:    0,
+		RetryDelay:    1,
+		Direction:     model.FromRemote,
+	}
+
+	if err := ExecuteFromRemoteWithClients(context.Background(), transferConfig, mockS3, mockSSM); err != nil {
+		t.Fatalf("ExecuteFromRemoteWithClients() error = %v", err)
+	}
+
+	if len(putKeys) != 2 || !strings.HasSuffix(putKeys[0], "/app.log") || !strings.HasSuffix(putKeys[1], "/old/app.log.1") {
+		t.Errorf("presigned PUT keys = %v, want app.log and old/app.log.1 under the staging prefix", putKeys)
+	}
+
+	var upload string
+	for _, command := range *sent {
+		if strings.Contains(command, "--method=PUT") {
+			upload = command
+		}
+	}
+	if !strings.Contains(upload, "p=/var/log/app/old/app.log.1;") {
+		t.Errorf("upload command %q does not send the nested file", upload)
+	}
+}
+
+func TestPresignedUpload_ServerSideEncryption(t *testing.T) {
+	mockSSM, sent := toolSSMClient([]string{"curl"}, nil)
+
+	mockS3 := &mockS3Client{}
+	mockS3.presignPutFunc = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+		if params.ServerSideEncryption != "aws:kms" || aws.ToString(params.SSEKMSKeyId) != "alias/staging" {
+			t.Errorf("presigned PUT encryption = %q/%q, want aws:kms/alias/staging", params.ServerSideEncryption, aws.ToString(params.SSEKMSKeyId))
+		}
+		return &v4.PresignedHTTPRequest{
+			URL:          "https://test-bucket.s3.amazonaws.com/staged?X-Amz-Signature=put",
+			Method:       "PUT",
+			SignedHeader: http.Header{"X-Amz-Server-Side-Encryption": {"aws:kms"}},
+		}, nil
+	}
+
+	transferConfig := model.TransferConfig{
+		Source:        "/var/log/app.log",
+		SSMInstanceID: "i-1234567890abcdef0",
+		BucketName:    "test-bucket",
+		SSE:           model.ServerSideEncryptionKMS,
+		KMSKeyID:      "alias/staging",
+	}
+	if err := presignedUpload(context.Background(), mockS3, linuxHost(mockSSM), transferConfig, toolCurl, "staged", false); err != nil {
+		t.Fatalf("presignedUpload() error = %v", err)
+	}
+
+	if len(*sent) != 1 || !strings.Contains((*sent)[0], "-H 'X-Amz-Server-Side-Encryption: aws:kms'") {
+		t.Errorf("upload commands = %q, want the signed encryption header sent", *sent)
+	}
+}
+
+func TestPresignedDownload_PresignError(t *testing.T) {
+	mockS3 := &mockS3Client{
+		presignGetFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+			return nil, errors.New("no credentials")
+		},
+	}
+	mockSSM, sent := toolSSMClient(nil, nil)
+
+	err := presignedDownload(context.Background(), mockS3, linuxHost(mockSSM), model.TransferConfig{BucketName: "test-bucket"}, toolCurl, []presignedFile{{Key: "a", RemotePath: "/tmp/a"}})
+	if err == nil || !strings.Contains(err.Error(), "failed to presign download of a") {
+		t.Errorf("presignedDownload() error = %v, want presign failure", err)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("No SSM commands expected after a presign failure, got %v", *sent)
+	}
+}
+
+func TestPresignedUpload_PresignsEachAttempt(t *testing.T) {
+	var sent []string
+	mockSSM := &mockSSMClient{
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			sent = append(sent, strings.Join(params.Parameters["commands"], "\n"))
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String(fmt.Sprintf("command-%d", len(sent)))}}, nil
+		},
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			if len(sent) == 1 {
+				return &ssm.GetCommandInvocationOutput{
+					Status:               types.CommandInvocationStatusFailed,
+					StandardErrorContent: aws.String("curl: (56) connection reset by peer"),
+				}, nil
+			}
+			return &ssm.GetCommandInvocationOutput{Status: types.CommandInvocationStatusSuccess}, nil
+		},
+	}
+
+	var presigned int
+	mockS3 := &mockS3Client{}
+	mockS3.presignPutFunc = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+		presigned++
+		return &v4.PresignedHTTPRequest{URL: fmt.Sprintf("https://test-bucket.s3.amazonaws.com/staged?X-Amz-Signature=put-%d", presigned), Method: "PUT"}, nil
+	}
+
+	transferConfig := model.TransferConfig{
+		Source:        "/var/log/app.log",
+		SSMInstanceID: "i-1234567890abcdef0",
+		BucketName:    "test-bucket",
+		MaxRetries:    1,
+	}
+	if err := presignedUpload(context.Background(), mockS3, linuxHost(mockSSM), transferConfig, toolCurl, "staged", false); err != nil {
+		t.Fatalf("presignedUpload() error = %v", err)
+	}
+
+	if len(sent) != 2 || !strings.Contains(sent[0], "put-1") || !strings.Contains(sent[1], "put-2") {
+		t.Errorf("Sent %q, want the retry to carry a newly presigned URL", sent)
+	}
+}
+
+func TestPresignExpiryFor(t *testing.T) {
+	tests := []struct {
+		timeout int
+		want    time.Duration
+	}{
+		{0, presignExpiry},
+		{60, presignExpiry},
+		{6 * 3600, 6 * time.Hour},
+		{30 * 24 * 3600, maxPresignExpiry},
+	}
+	for _, tt := range tests {
+		if got := presignExpiryFor(model.TransferConfig{CommandTimeout: tt.timeout}); got != tt.want {
+			t.Errorf("presignExpiryFor(%ds) = %v, want %v", tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+)
+
+// bucketRegionHeader is the response header S3 reports a bucket's region
+// in, including on the redirect it answers requests sent to the wrong
+// region with.
+const bucketRegionHeader = "X-Amz-Bucket-Region"
+
+// BucketRegion returns the region bucketName lives in. It asks HeadBucket
+// first, which only needs the s3:ListBucket permission transfers already
+// use, and falls back to GetBucketLocation.
+func BucketRegion(ctx context.Context, client BucketRegionAPI, bucketName string) (string, error) {
+	head, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	if err == nil && aws.ToString(head.BucketRegion) != "" {
+		return aws.ToString(head.BucketRegion), nil
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		if region := respErr.Response.Header.Get(bucketRegionHeader); region != "" {
+			return region, nil
+		}
+	}
+
+	location, locErr := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucketName)})
+	if locErr != nil {
+		return "", fmt.Errorf("failed to determine region of bucket %s: %w", bucketName, errors.Join(err, locErr))
+	}
+
+	// Buckets in us-east-1 have no location constraint, and the oldest
+	// buckets in eu-west-1 report the legacy EU constraint
+	switch region := string(location.LocationConstraint); region {
+	case "":
+		return "us-east-1", nil
+	case "EU":
+		return "eu-west-1", nil
+	default:
+		return region, nil
+	}
+}
+
+// BucketClient returns an S3 client for the region bucketName lives in,
+// along with that region, so requests are not redirected when the bucket
+// is outside the configured region. When the region cannot be determined
+// the default client is returned with an empty region.
+func BucketClient(ctx context.Context, clients *awsclient.Factory, bucketName string) (*s3.Client, string) {
+	s3Client := clients.S3()
+	region, err := BucketRegion(ctx, s3Client, bucketName)
+	if err != nil {
+		log.Warn("Using region %s for bucket %s: %v", clients.Region(), bucketName, err)
+		return s3Client, ""
+	}
+	if region == clients.Region() {
+		return s3Client, region
+	}
+
+	log.Debug("Bucket %s is in %s, using it for S3 requests", bucketName, region)
+	return clients.S3ForRegion(region), region
+}
+
+// warnCrossRegion warns when the staging bucket is in another region than
+// the instance, since data moving between them is billed as inter-region
+// transfer.
+func warnCrossRegion(bucketName, bucketRegion, instanceRegion string) {
+	if bucketRegion != "" && instanceRegion != "" && bucketRegion != instanceRegion {
+		log.Warn("Bucket %s is in %s but the instance is managed in %s; data will cross regions and may incur transfer charges", bucketName, bucketRegion, instanceRegion)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// mockBucketRegionClient answers bucket region lookups with fixed results.
+type mockBucketRegionClient struct {
+	headOutput     *s3.HeadBucketOutput
+	headErr        error
+	location       s3types.BucketLocationConstraint
+	locationErr    error
+	locationCalled bool
+}
+
+func (m *mockBucketRegionClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if m.headErr != nil {
+		return nil, m.headErr
+	}
+	if m.headOutput != nil {
+		return m.headOutput, nil
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mockBucketRegionClient) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	m.locationCalled = true
+	if m.locationErr != nil {
+		return nil, m.locationErr
+	}
+	return &s3.GetBucketLocationOutput{LocationConstraint: m.location}, nil
+}
+
+// redirectError returns the error S3 answers requests for a bucket in
+// another region with.
+func redirectError(region string) error {
+	header := http.Header{}
+	header.Set(bucketRegionHeader, region)
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusMovedPermanently, Header: header}},
+			Err:      errors.New("moved permanently"),
+		},
+	}
+}
+
+func TestBucketRegion(t *testing.T) {
+	tests := []struct {
+		name         string
+		client       *mockBucketRegionClient
+		want         string
+		wantLocation bool
+		wantErr      bool
+	}{
+		{
+			name:   "head bucket",
+			client: &mockBucketRegionClient{headOutput: &s3.HeadBucketOutput{BucketRegion: aws.String("eu-central-1")}},
+			want:   "eu-central-1",
+		},
+		{
+			name:   "redirect to another region",
+			client: &mockBucketRegionClient{headErr: redirectError("ap-southeast-2")},
+			want:   "ap-southeast-2",
+		},
+		{
+			name:         "location constraint",
+			client:       &mockBucketRegionClient{headErr: errors.New("forbidden"), location: "us-west-2"},
+			want:         "us-west-2",
+			wantLocation: true,
+		},
+		{
+			name:         "no location constraint",
+			client:       &mockBucketRegionClient{location: ""},
+			want:         "us-east-1",
+			wantLocation: true,
+		},
+		{
+			name:         "legacy EU constraint",
+			client:       &mockBucketRegionClient{location: "EU"},
+			want:         "eu-west-1",
+			wantLocation: true,
+		},
+		{
+			name:         "lookups fail",
+			client:       &mockBucketRegionClient{headErr: errors.New("forbidden"), locationErr: errors.New("access denied")},
+			wantLocation: true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BucketRegion(context.Background(), tt.client, "test-bucket")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BucketRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BucketRegion() = %q, want %q", got, tt.want)
+			}
+			if tt.client.locationCalled != tt.wantLocation {
+				t.Errorf("GetBucketLocation called = %v, want %v", tt.client.locationCalled, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cowdogmoo/bcp/pkg/journal"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func newTestJournal(t *testing.T, transferConfig model.TransferConfig) *journal.Journal {
+	t.Helper()
+
+	orig := journal.Dir
+	journal.Dir = t.TempDir()
+	t.Cleanup(func() { journal.Dir = orig })
+
+	j, err := journal.New(transferConfig)
+	if err != nil {
+		t.Fatalf("journal.New() error = %v", err)
+	}
+	return j
+}
+
+func TestExecuteWithJournal_SkipsCompletedPhases(t *testing.T) {
+	testFile := writeTempFile(t, []byte("test content"))
+
+	j := newTestJournal(t, model.TransferConfig{
+		Source:        testFile,
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   "/tmp/test.txt",
+		BucketName:    "test-bucket",
+		MaxRetries:    1,
+		RetryDelay:    1,
+		Direction:     model.ToRemote,
+	})
+	for _, phase := range []journal.Phase{journal.PhaseUpload, journal.PhaseSelectTransport} {
+		if err := j.MarkPhase(phase); err != nil {
+			t.Fatalf("MarkPhase() error = %v", err)
+		}
+	}
+
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			t.Error("PutObject should not be called for a completed upload phase")
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	var mu sync.Mutex
+	var commands []string
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		mu.Lock()
+		commands = append(commands, command)
+		mu.Unlock()
+		return sha256Hex("test content") + "  /tmp/test.txt\n"
+	})
+
+	if err := ExecuteWithJournal(context.Background(), j, mockS3, mockSSM); err != nil {
+		t.Fatalf("ExecuteWithJournal() error = %v", err)
+	}
+
+	for _, command := range commands {
+		if strings.Contains(command, "which aws") {
+			t.Errorf("AWS CLI check should be skipped, got command %q", command)
+		}
+	}
+	if !j.PhaseDone(journal.PhaseRemoteDownload) {
+		t.Error("remote download phase was not recorded")
+	}
+}
+
+func TestExecuteWithJournal_FromRemoteReusesStagingKey(t *testing.T) {
+	j := newTestJournal(t, model.TransferConfig{
+		Source:        "/var/log/app.log",
+		SSMInstanceID: "i-1234567890abcdef0",
+		Destination:   filepath.Join(t.TempDir(), "app.log"),
+		BucketName:    "test-bucket",
+		MaxRetries:    1,
+		RetryDelay:    1,
+		Direction:     model.FromRemote,
+	})
+	if err := j.SetValue(stagingKeyValue, "bcp-download-42"); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+	for _, phase := range []journal.Phase{journal.PhaseSelectTransport, journal.PhaseDetectSource, journal.PhaseRemoteUpload} {
+		if err := j.MarkPhase(phase); err != nil {
+			t.Fatalf("MarkPhase() error = %v", err)
+		}
+	}
+
+	var downloaded string
+	mockS3 := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			downloaded = aws.ToString(params.Key)
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("log")))}, nil
+		},
+	}
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		if !strings.Contains(command, "sha256sum") {
+			t.Errorf("only the checksum command is expected once remote phases completed, got %q", command)
+		}
+		return sha256Hex("log") + "  /var/log/app.log\n"
+	})
+
+	if err := ExecuteWithJournal(context.Background(), j, mockS3, mockSSM); err != nil {
+		t.Fatalf("ExecuteWithJournal() error = %v", err)
+	}
+	if downloaded != "bcp-download-42" {
+		t.Errorf("downloaded key %q, want the journaled staging key bcp-download-42", downloaded)
+	}
+}
+
+func TestUploadFile_MultipartResumesRecordedParts(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxy")
+	testFile := writeTempFile(t, content)
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+
+	j := newTestJournal(t, model.TransferConfig{})
+	if err := j.StartObject("large.bin", info.Size(), info.ModTime(), "resumed-upload-id", 10); err != nil {
+		t.Fatalf("StartObject() error = %v", err)
+	}
+	for _, n := range []int32{1, 2} {
+		if err := j.RecordPart("large.bin", n, fmt.Sprintf("etag-%d", n)); err != nil {
+			t.Fatalf("RecordPart() error = %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var uploaded []int32
+	var completed []int32
+	mockS3 := &mockS3Client{
+		createMPUFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			t.Error("CreateMultipartUpload should not be called when resuming")
+			return nil, errors.New("unexpected call")
+		},
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			if aws.ToString(params.UploadId) != "resumed-upload-id" {
+				t.Errorf("UploadPart used upload ID %s, want resumed-upload-id", aws.ToString(params.UploadId))
+			}
+			mu.Lock()
+			uploaded = append(uploaded, aws.ToInt32(params.PartNumber))
+			mu.Unlock()
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+		},
+		completeMPUFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+			for _, part := range params.MultipartUpload.Parts {
+				completed = append(completed, aws.ToInt32(part.PartNumber))
+				if aws.ToString(part.ETag) != fmt.Sprintf("etag-%d", aws.ToInt32(part.PartNumber)) {
+					t.Errorf("Part %d has unexpected ETag %s", aws.ToInt32(part.PartNumber), aws.ToString(part.ETag))
+				}
+			}
+			return &s3.CompleteMultipartUploadOutput{}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 2, PartSize: 10, MultipartThreshold: 10, Journal: j}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	if len(uploaded) != 2 {
+		t.Errorf("Expected only the 2 missing parts to be uploaded, got %v", uploaded)
+	}
+	for _, n := range uploaded {
+		if n < 3 {
+			t.Errorf("Part %d was already uploaded and should have been skipped", n)
+		}
+	}
+	if len(completed) != 4 {
+		t.Errorf("Expected 4 parts in the completed upload, got %v", completed)
+	}
+	if obj := j.Object("large.bin"); obj == nil || !obj.Complete {
+		t.Errorf("Journal object = %+v, want a completed object", obj)
+	}
+
+	// A second attempt skips the completed file entirely
+	mockS3.uploadPartFunc = func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+		t.Error("UploadPart should not be called for a completed object")
+		return nil, errors.New("unexpected call")
+	}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+}
+
+func TestUploadFile_MultipartFailureKeepsJournaledParts(t *testing.T) {
+	testFile := writeTempFile(t, bytes.Repeat([]byte("x"), 30))
+	j := newTestJournal(t, model.TransferConfig{})
+
+	var aborted atomic.Bool
+	mockS3 := &mockS3Client{
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			if aws.ToInt32(params.PartNumber) == 3 {
+				return nil, errors.New("invalid part")
+			}
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+		},
+		abortMPUFunc: func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+			aborted.Store(true)
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 1, PartSize: 10, MultipartThreshold: 10, Journal: j}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err == nil {
+		t.Fatal("uploadFile() expected error, got nil")
+	}
+
+	if aborted.Load() {
+		t.Error("Journaled multipart upload should be kept for resume, not aborted")
+	}
+	obj := j.Object("large.bin")
+	if obj == nil || obj.UploadID != "test-upload-id" {
+		t.Fatalf("Journal object = %+v, want upload test-upload-id", obj)
+	}
+	if len(obj.Parts) != 2 {
+		t.Errorf("Expected 2 recorded parts, got %v", obj.Parts)
+	}
+}
+
+func TestUploadFile_MultipartRestartsExpiredUpload(t *testing.T) {
+	testFile := writeTempFile(t, bytes.Repeat([]byte("x"), 20))
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+
+	j := newTestJournal(t, model.TransferConfig{})
+	if err := j.StartObject("large.bin", info.Size(), info.ModTime(), "expired-upload-id", 10); err != nil {
+		t.Fatalf("StartObject() error = %v", err)
+	}
+
+	var created atomic.Bool
+	mockS3 := &mockS3Client{
+		createMPUFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			created.Store(true)
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("fresh-upload-id")}, nil
+		},
+		uploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+			if aws.ToString(params.UploadId) == "expired-upload-id" {
+				return nil, newMockAPIError("NoSuchUpload", "The specified upload does not exist")
+			}
+			return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+		},
+	}
+
+	opts := Options{Concurrency: 1, PartSize: 10, MultipartThreshold: 10, Journal: j}
+	if err := uploadFile(context.Background(), mockS3, "test-bucket", testFile, "large.bin", opts); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+	if !created.Load() {
+		t.Error("Expected a fresh multipart upload after the journaled one expired")
+	}
+}
+
+func TestFinishJournaled(t *testing.T) {
+	failure := errors.New("download failed")
+
+	tests := []struct {
+		name        string
+		keepStaged  bool
+		err         error
+		wantJournal bool
+	}{
+		{"success", false, nil, false},
+		{"failure with staged objects cleaned up", false, failure, false},
+		{"failure with staged objects kept", true, failure, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTestJournal(t, model.TransferConfig{KeepStaged: tt.keepStaged})
+			if err := j.Save(); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			if err := finishJournaled(context.Background(), j, tt.err); !errors.Is(err, tt.err) {
+				t.Errorf("finishJournaled() error = %v, want %v", err, tt.err)
+			}
+			if _, err := journal.Load(j.ID); (err == nil) != tt.wantJournal {
+				t.Errorf("journal.Load() error = %v, want journal kept = %v", err, tt.wantJournal)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Remote paths and S3 keys come from user input, so every argument put
+// into a command run on an instance goes through quote. Arguments made
+// only of characters the shell treats literally are left bare to keep
+// commands readable in logs.
+var (
+	shSafeArgPattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	psSafeArgPattern = regexp.MustCompile(`^[A-Za-z0-9_:./-]+$`)
+)
+
+// psQuoteReplacer doubles every character PowerShell accepts as a single
+// quote, including the typographic ones, so none can end the literal.
+var psQuoteReplacer = strings.NewReplacer(
+	"'", "''",
+	"\u2018", "\u2018\u2018",
+	"\u2019", "\u2019\u2019",
+	"\u201a", "\u201a\u201a",
+	"\u201b", "\u201b\u201b",
+)
+
+// shQuote quotes s as a single POSIX sh word.
+func shQuote(s string) string {
+	if shSafeArgPattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// psQuote quotes s as a PowerShell string literal.
+func psQuote(s string) string {
+	return "'" + psQuoteReplacer.Replace(s) + "'"
+}
+
+// quote quotes s as a single argument for the platform's shell.
+func (p remotePlatform) quote(s string) string {
+	if p == platformWindows {
+		if psSafeArgPattern.MatchString(s) {
+			return s
+		}
+		return psQuote(s)
+	}
+	return shQuote(s)
+}
+
+// command returns a command line running program with args, each quoted
+// for the platform's shell. program itself must be a trusted name.
+func (p remotePlatform) command(program string, args ...string) string {
+	var b strings.Builder
+	b.WriteString(program)
+	for _, arg := range args {
+		b.WriteByte(' ')
+		b.WriteString(p.quote(arg))
+	}
+	return b.String()
+}
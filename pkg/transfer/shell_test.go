@@ -0,0 +1,188 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// hostileNames are file names that break or inject into commands that
+// interpolate them without quoting.
+var hostileNames = []struct {
+	name  string
+	value string
+}{
+	{"plain", "/tmp/app.conf"},
+	{"empty", ""},
+	{"spaces", "/tmp/my files/app conf"},
+	{"single quote", "/tmp/it's"},
+	{"double quote", `/tmp/say "hi"`},
+	{"dollar expansion", "/tmp/$HOME"},
+	{"command substitution", "/tmp/$(touch pwned)"},
+	{"backticks", "/tmp/`touch pwned`"},
+	{"semicolon", "/tmp/a; rm -rf /"},
+	{"ampersand and pipe", "/tmp/a && b | c"},
+	{"redirection", "/tmp/a > /etc/passwd"},
+	{"glob", "/tmp/*"},
+	{"newline", "/tmp/a\nb"},
+	{"backslash", `/tmp/a\b`},
+	{"leading dash", "-rf"},
+	{"tilde", "~root"},
+	{"hash", "/tmp/#comment"},
+	{"windows path", `C:\Program Files\app's`},
+	{"typographic quote", "C:\\it\u2019s; Remove-Item C:\\"},
+}
+
+func TestShQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	for _, tt := range hostileNames {
+		t.Run(tt.name, func(t *testing.T) {
+			command := platformPOSIX.command("printf", "%s", tt.value)
+			output, err := exec.Command(sh, "-c", command).Output()
+			if err != nil {
+				t.Fatalf("sh -c %q error = %v", command, err)
+			}
+			if string(output) != tt.value {
+				t.Errorf("sh -c %q printed %q, want %q", command, output, tt.value)
+			}
+		})
+	}
+}
+
+func TestShQuote_LeavesSafeWordsBare(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/var/log/app.log", "/var/log/app.log"},
+		{"s3://bucket/key", "s3://bucket/key"},
+		{"--recursive", "--recursive"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		if got := shQuote(tt.input); got != tt.expected {
+			t.Errorf("shQuote(%q) = %s, want %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPSQuote(t *testing.T) {
+	pwsh, err := exec.LookPath("pwsh")
+
+	for _, tt := range hostileNames {
+		t.Run(tt.name, func(t *testing.T) {
+			quoted := psQuote(tt.value)
+			body := strings.TrimSuffix(strings.TrimPrefix(quoted, "'"), "'")
+			for _, q := range []string{"'", "\u2018", "\u2019", "\u201a", "\u201b"} {
+				if strings.Contains(strings.ReplaceAll(body, q+q, ""), q) {
+					t.Errorf("psQuote(%q) = %s leaves %q unescaped", tt.value, quoted, q)
+				}
+			}
+
+			if err != nil {
+				return
+			}
+			output, runErr := exec.Command(pwsh, "-NoProfile", "-NonInteractive", "-Command", "[Console]::Out.Write("+psQuote(tt.value)+")").Output()
+			if runErr != nil {
+				t.Fatalf("pwsh error = %v", runErr)
+			}
+			if string(output) != tt.value {
+				t.Errorf("pwsh printed %q, want %q", output, tt.value)
+			}
+		})
+	}
+}
+
+func TestRemotePlatformCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform remotePlatform
+		args     []string
+		expected string
+	}{
+		{
+			name:     "posix plain",
+			platform: platformPOSIX,
+			args:     []string{"s3", "cp", "s3://bucket/app.conf", "/etc/app/app.conf"},
+			expected: "aws s3 cp s3://bucket/app.conf /etc/app/app.conf",
+		},
+		{
+			name:     "posix hostile destination",
+			platform: platformPOSIX,
+			args:     []string{"s3", "cp", "s3://bucket/a b", "/tmp/x; rm -rf /", "--recursive"},
+			expected: "aws s3 cp 's3://bucket/a b' '/tmp/x; rm -rf /' --recursive",
+		},
+		{
+			name:     "windows plain",
+			platform: platformWindows,
+			args:     []string{"s3", "cp", "s3://bucket/app.conf", "C:/app/app.conf"},
+			expected: "aws s3 cp s3://bucket/app.conf C:/app/app.conf",
+		},
+		{
+			name:     "windows hostile destination",
+			platform: platformWindows,
+			args:     []string{"s3", "cp", "s3://bucket/app.conf", `C:\Program Files\$(Stop-Computer)'`, "--recursive"},
+			expected: `aws s3 cp s3://bucket/app.conf 'C:\Program Files\$(Stop-Computer)''' --recursive`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.platform.command("aws", tt.args...); got != tt.expected {
+				t.Errorf("command() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRemoteCommands_QuoteHostilePaths(t *testing.T) {
+	const path = "/tmp/x; touch pwned"
+	quoted := "'/tmp/x; touch pwned'"
+
+	commands := map[string]string{
+		"isDirectoryCommand":    platformPOSIX.isDirectoryCommand(path),
+		"listFilesCommand":      platformPOSIX.listFilesCommand(path),
+		"checksumCommand dir":   platformPOSIX.checksumCommand(path, true, "x"),
+		"checksumCommand file":  platformPOSIX.checksumCommand(path, false, "x"),
+		"presignedGetCommand":   presignedGetCommand(toolCurl, "https://b/k?s", path, "x", true),
+		"presignedPutCommand":   presignedPutCommand(toolWget, "https://b/k?s", path, nil),
+		"presignedGetCommand 2": presignedGetCommand(toolWget, "https://b/k?s", "/tmp", "$(touch pwned)", true),
+	}
+	for name, command := range commands {
+		if strings.Contains(command, path) && !strings.Contains(command, quoted) {
+			t.Errorf("%s = %q interpolates the path unquoted", name, command)
+		}
+		if strings.Contains(command, "$(touch pwned)") && !strings.Contains(command, "'$(touch pwned)'") {
+			t.Errorf("%s = %q interpolates the name unquoted", name, command)
+		}
+	}
+}
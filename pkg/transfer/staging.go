@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import "strings"
+
+// stagingRoot is the key prefix every transfer keeps its objects under.
+const stagingRoot = "bcp/"
+
+// transferPrefix returns the key prefix of everything transferID writes
+// to the staging bucket.
+func transferPrefix(transferID string) string {
+	return stagingRoot + transferID + "/"
+}
+
+// stagingPrefix returns the key prefix the files of transferID are staged
+// under. It is kept apart from the transfer's other objects, such as
+// command output, so staging a directory never picks those up.
+func stagingPrefix(transferID string) string {
+	return transferPrefix(transferID) + "staged/"
+}
+
+// stagingName returns the name a remote source named name is staged
+// under, falling back to a fixed name for roots such as "/" that are not
+// usable in a key.
+func stagingName(name string) string {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return "source"
+	}
+	return name
+}
+
+// stagedRoot returns the key the staged files sit at or below: the key of
+// a single file, or the prefix of a directory's files. It is derived from
+// the keys themselves so it always matches what was written.
+func stagedRoot(files []stagedFile, keyPrefix string, isDirectory bool) string {
+	switch {
+	case len(files) == 0:
+		return normalizeKeyPrefix(keyPrefix)
+	case !isDirectory:
+		return files[0].Key
+	}
+	return strings.TrimSuffix(files[0].Key, files[0].RelPath)
+}
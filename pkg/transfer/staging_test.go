@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cowdogmoo/bcp/pkg/model"
+)
+
+func TestStagingName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"app.log", "app.log"},
+		{"logs", "logs"},
+		{"/", "source"},
+		{"", "source"},
+		{".", "source"},
+		{"C:", "source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stagingName(tt.name); got != tt.want {
+				t.Errorf("stagingName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStagedRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "data")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "sub", "b.txt")
+
+	tests := []struct {
+		name        string
+		localPath   string
+		isDirectory bool
+		want        string
+	}{
+		{"single file", file, false, "bcp/t1/staged/b.txt"},
+		{"directory", dir, true, "bcp/t1/staged/data/"},
+		{"empty directory", t.TempDir(), true, "bcp/t1/staged/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := stagedFiles(tt.localPath, stagingPrefix("t1"))
+			if err != nil {
+				t.Fatalf("stagedFiles() error = %v", err)
+			}
+			if got := stagedRoot(files, stagingPrefix("t1"), tt.isDirectory); got != tt.want {
+				t.Errorf("stagedRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteToRemoteWithClients_StagesUnderTransferPrefix(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("a", "b", "file.txt"), []byte("test content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(transferID string) (uploaded, copied string) {
+		var mu sync.Mutex
+		mockS3 := &mockS3Client{
+			putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				mu.Lock()
+				uploaded = aws.ToString(params.Key)
+				mu.Unlock()
+				return &s3.PutObjectOutput{}, nil
+			},
+		}
+		mockSSM := commandOutputSSMClient(func(command string) string {
+			switch {
+			case strings.Contains(command, "s3 cp"):
+				copied = command
+			case strings.Contains(command, "sha256sum"):
+				return sha256Hex("test content") + "  /tmp/file.txt\n"
+			}
+			return "/usr/bin/aws"
+		})
+
+		transferConfig := model.TransferConfig{
+			TransferID:    transferID,
+			Source:        "./a/b/file.txt",
+			SSMInstanceID: "i-1234567890abcdef0",
+			Destination:   "/tmp/file.txt",
+			BucketName:    "test-bucket",
+			Direction:     model.ToRemote,
+			KeepStaged:    true,
+		}
+		if err := ExecuteToRemoteWithClients(context.Background(), transferConfig, mockS3, mockSSM); err != nil {
+			t.Fatalf("ExecuteToRemoteWithClients() error = %v", err)
+		}
+		return uploaded, copied
+	}
+
+	first, firstCopy := run("transfer-1")
+	second, _ := run("transfer-2")
+
+	if first != "bcp/transfer-1/staged/file.txt" {
+		t.Errorf("staged key = %q, want bcp/transfer-1/staged/file.txt", first)
+	}
+	if first == second {
+		t.Errorf("concurrent transfers of the same path share the key %q", first)
+	}
+	if !strings.Contains(firstCopy, "s3://test-bucket/"+first+" ") {
+		t.Errorf("remote copy %q does not read the staged key %s", firstCopy, first)
+	}
+}
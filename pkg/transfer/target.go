@@ -0,0 +1,200 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/cowdogmoo/bcp/pkg/logging"
+	"github.com/cowdogmoo/bcp/pkg/validation"
+)
+
+// ResolveInstance returns the ID of the instance target names. Targets are
+// instance or managed node IDs, which are returned as is, name:<value> for
+// the Name tag of a running EC2 instance or hybrid managed node, or the IP
+// address or host name SSM reports for a managed instance. A target that
+// matches no instance or more than one is an error.
+func ResolveInstance(ctx context.Context, ec2Client EC2API, ssmClient SSMAPI, target string) (string, error) {
+	if validation.IsInstanceID(target) {
+		return target, nil
+	}
+
+	var ids []string
+	var err error
+	var description string
+	if name, ok := strings.CutPrefix(target, validation.NameTargetPrefix); ok {
+		description = fmt.Sprintf("Name tag %q", name)
+		ids, err = instancesByName(ctx, ec2Client, ssmClient, name)
+	} else {
+		description = fmt.Sprintf("host name or IP address %q", target)
+		ids, err = instancesByAddress(ctx, ssmClient, target)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no instance found with %s", description)
+	case 1:
+		log.Debug("Resolved %s to instance %s", target, ids[0])
+		return ids[0], nil
+	}
+	sort.Strings(ids)
+	return "", fmt.Errorf("%s matches %d instances (%s); use an instance ID instead", description, len(ids), strings.Join(ids, ", "))
+}
+
+// ResolveInstances returns the sorted IDs of the instances a fan-out
+// target names. tag:Key=Value names every SSM managed instance with that
+// tag; a comma-separated list names each of its entries, which are
+// resolved with ResolveInstance.
+func ResolveInstances(ctx context.Context, ec2Client EC2API, ssmClient SSMAPI, target string) ([]string, error) {
+	var ids []string
+	if tag, ok := strings.CutPrefix(target, validation.TagTargetPrefix); ok {
+		key, value, _ := strings.Cut(tag, "=")
+		var err error
+		if ids, err = instancesByTag(ctx, ssmClient, key, value); err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no managed instance found with tag %s", tag)
+		}
+	} else {
+		for _, entry := range strings.Split(target, ",") {
+			id, err := ResolveInstance(ctx, ec2Client, ssmClient, entry)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	ids = slices.Compact(ids)
+	log.Debug("Resolved %s to instances %s", target, strings.Join(ids, ", "))
+	return ids, nil
+}
+
+// instancesByTag returns the IDs of SSM managed instances, both EC2
+// instances and hybrid nodes, whose tag key is value.
+func instancesByTag(ctx context.Context, client SSMAPI, key, value string) ([]string, error) {
+	var ids []string
+	paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{Key: aws.String("tag:" + key), Values: []string{value}},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe managed instances: %w", err)
+		}
+		for _, info := range page.InstanceInformationList {
+			ids = append(ids, aws.ToString(info.InstanceId))
+		}
+	}
+	return ids, nil
+}
+
+// instancesByName returns the IDs of running EC2 instances and hybrid
+// managed nodes whose Name tag is name. Hybrid nodes are not EC2
+// instances, so their tags are looked up through SSM.
+func instancesByName(ctx context.Context, client EC2API, ssmClient SSMAPI, name string) ([]string, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("tag:Name"), Values: []string{name}},
+			{Name: aws.String("instance-state-name"), Values: []string{string(ec2types.InstanceStateNameRunning)}},
+		},
+	}
+
+	var ids []string
+	paginator := ec2.NewDescribeInstancesPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				ids = append(ids, aws.ToString(instance.InstanceId))
+			}
+		}
+	}
+
+	hybrid := ssm.NewDescribeInstanceInformationPaginator(ssmClient, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{Key: aws.String("tag:Name"), Values: []string{name}},
+			{Key: aws.String("ResourceType"), Values: []string{string(ssmtypes.ResourceTypeManagedInstance)}},
+		},
+	})
+	for hybrid.HasMorePages() {
+		page, err := hybrid.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe managed instances: %w", err)
+		}
+		for _, info := range page.InstanceInformationList {
+			ids = append(ids, aws.ToString(info.InstanceId))
+		}
+	}
+	return ids, nil
+}
+
+// instancesByAddress returns the IDs of SSM managed instances whose IP
+// address or host name is address. Host names match either in full or by
+// their first label, so web-01 matches web-01.ec2.internal.
+func instancesByAddress(ctx context.Context, client SSMAPI, address string) ([]string, error) {
+	isIP := net.ParseIP(address) != nil
+
+	var ids []string
+	paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe managed instances: %w", err)
+		}
+		for _, info := range page.InstanceInformationList {
+			var match bool
+			if isIP {
+				match = aws.ToString(info.IPAddress) == address
+			} else {
+				computerName := aws.ToString(info.ComputerName)
+				shortName, _, _ := strings.Cut(computerName, ".")
+				match = strings.EqualFold(computerName, address) || strings.EqualFold(shortName, address)
+			}
+			if match {
+				ids = append(ids, aws.ToString(info.InstanceId))
+			}
+		}
+	}
+	return ids, nil
+}
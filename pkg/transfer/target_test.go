@@ -0,0 +1,215 @@
+/*
+Copyright © 2025 Jayson Grace <jayson.e.grace@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// mockEC2Client returns instances from a fixed set of Name tags.
+type mockEC2Client struct {
+	// names maps instance IDs to their Name tag
+	names map[string]string
+	err   error
+}
+
+func (m *mockEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var name string
+	for _, filter := range params.Filters {
+		if aws.ToString(filter.Name) == "tag:Name" {
+			name = filter.Values[0]
+		}
+	}
+
+	var instances []ec2types.Instance
+	for id, instanceName := range m.names {
+		if instanceName == name {
+			instances = append(instances, ec2types.Instance{InstanceId: aws.String(id)})
+		}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: instances}}}, nil
+}
+
+// managedInstancesSSMClient returns a mock whose managed instances are
+// described by instances, with the Name tags of hybrid nodes given by
+// names.
+func managedInstancesSSMClient(names map[string]string, instances ...types.InstanceInformation) *mockSSMClient {
+	return &mockSSMClient{
+		describeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+			var name *string
+			for _, filter := range params.Filters {
+				if aws.ToString(filter.Key) == "tag:Name" {
+					name = &filter.Values[0]
+				}
+			}
+			if name == nil {
+				return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: instances}, nil
+			}
+
+			var matched []types.InstanceInformation
+			for _, instance := range instances {
+				if instance.ResourceType == types.ResourceTypeManagedInstance && names[aws.ToString(instance.InstanceId)] == *name {
+					matched = append(matched, instance)
+				}
+			}
+			return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: matched}, nil
+		},
+	}
+}
+
+func TestResolveInstance(t *testing.T) {
+	ec2Client := &mockEC2Client{names: map[string]string{
+		"i-0000000000000000a": "web-01",
+		"i-0000000000000000b": "worker",
+		"i-0000000000000000c": "worker",
+	}}
+	ssmClient := managedInstancesSSMClient(
+		map[string]string{"mi-0123456789abcdef0": "db-primary"},
+		types.InstanceInformation{InstanceId: aws.String("i-0000000000000000a"), ComputerName: aws.String("web-01.ec2.internal"), IPAddress: aws.String("10.0.1.5"), ResourceType: types.ResourceTypeEc2Instance},
+		types.InstanceInformation{InstanceId: aws.String("i-0000000000000000b"), ComputerName: aws.String("WORKER"), IPAddress: aws.String("10.0.1.6"), ResourceType: types.ResourceTypeEc2Instance},
+		types.InstanceInformation{InstanceId: aws.String("i-0000000000000000c"), ComputerName: aws.String("worker.corp.example"), IPAddress: aws.String("10.0.1.7"), ResourceType: types.ResourceTypeEc2Instance},
+		types.InstanceInformation{InstanceId: aws.String("mi-0123456789abcdef0"), ComputerName: aws.String("db01.onprem.example"), IPAddress: aws.String("192.168.1.10"), ResourceType: types.ResourceTypeManagedInstance},
+	)
+
+	tests := []struct {
+		name       string
+		target     string
+		want       string
+		wantErrMsg string
+	}{
+		{"instance ID", "i-1234567890abcdef0", "i-1234567890abcdef0", ""},
+		{"managed node ID", "mi-0123456789abcdef0", "mi-0123456789abcdef0", ""},
+		{"hybrid node name tag", "name:db-primary", "mi-0123456789abcdef0", ""},
+		{"hybrid node host name", "db01", "mi-0123456789abcdef0", ""},
+		{"hybrid node IP address", "192.168.1.10", "mi-0123456789abcdef0", ""},
+		{"name tag", "name:web-01", "i-0000000000000000a", ""},
+		{"ambiguous name tag", "name:worker", "", "matches 2 instances (i-0000000000000000b, i-0000000000000000c)"},
+		{"unknown name tag", "name:db", "", `no instance found with Name tag "db"`},
+		{"full host name", "web-01.ec2.internal", "i-0000000000000000a", ""},
+		{"short host name", "web-01", "i-0000000000000000a", ""},
+		{"host name is case-insensitive", "Worker.Corp.Example", "i-0000000000000000c", ""},
+		{"ambiguous host name", "worker", "", "matches 2 instances"},
+		{"IP address", "10.0.1.6", "i-0000000000000000b", ""},
+		{"unknown IP address", "10.0.9.9", "", `no instance found with host name or IP address "10.0.9.9"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveInstance(context.Background(), ec2Client, ssmClient, tt.target)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Fatalf("ResolveInstance() error = %v, want it to contain %q", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveInstance() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveInstance() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveInstance_LookupError(t *testing.T) {
+	ec2Client := &mockEC2Client{err: errors.New("UnauthorizedOperation")}
+	if _, err := ResolveInstance(context.Background(), ec2Client, &mockSSMClient{}, "name:web-01"); err == nil || !strings.Contains(err.Error(), "failed to describe instances") {
+		t.Errorf("ResolveInstance() error = %v, want a describe error", err)
+	}
+}
+
+func TestResolveInstances(t *testing.T) {
+	instances := []types.InstanceInformation{
+		{InstanceId: aws.String("i-0000000000000000a"), ComputerName: aws.String("web-01.ec2.internal"), ResourceType: types.ResourceTypeEc2Instance},
+		{InstanceId: aws.String("i-0000000000000000b"), ComputerName: aws.String("web-02.ec2.internal"), ResourceType: types.ResourceTypeEc2Instance},
+		{InstanceId: aws.String("mi-0123456789abcdef0"), ComputerName: aws.String("web-03.onprem.example"), ResourceType: types.ResourceTypeManagedInstance},
+	}
+	roles := map[string]string{
+		"i-0000000000000000b":  "web",
+		"mi-0123456789abcdef0": "web",
+	}
+	ssmClient := &mockSSMClient{
+		describeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+			if len(params.Filters) == 0 {
+				return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: instances}, nil
+			}
+			if aws.ToString(params.Filters[0].Key) != "tag:Role" {
+				t.Fatalf("Unexpected filter %q", aws.ToString(params.Filters[0].Key))
+			}
+
+			var matched []types.InstanceInformation
+			for _, instance := range instances {
+				if roles[aws.ToString(instance.InstanceId)] == params.Filters[0].Values[0] {
+					matched = append(matched, instance)
+				}
+			}
+			return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: matched}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		want       []string
+		wantErrMsg string
+	}{
+		{"tag", "tag:Role=web", []string{"i-0000000000000000b", "mi-0123456789abcdef0"}, ""},
+		{"unknown tag value", "tag:Role=db", nil, "no managed instance found with tag Role=db"},
+		{"list", "web-02,i-0000000000000000a", []string{"i-0000000000000000a", "i-0000000000000000b"}, ""},
+		{"list with duplicates", "web-01,i-0000000000000000a", []string{"i-0000000000000000a"}, ""},
+		{"list with an unknown entry", "web-01,web-09", nil, `no instance found with host name or IP address "web-09"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveInstances(context.Background(), &mockEC2Client{}, ssmClient, tt.target)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Fatalf("ResolveInstances() error = %v, want it to contain %q", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveInstances() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ResolveInstances() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -26,85 +26,241 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/aws/smithy-go"
+	"github.com/cowdogmoo/bcp/pkg/awsclient"
+	"github.com/cowdogmoo/bcp/pkg/journal"
 	log "github.com/cowdogmoo/bcp/pkg/logging"
 	"github.com/cowdogmoo/bcp/pkg/model"
 )
 
-func Execute(transferConfig model.TransferConfig) error {
-	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx)
+// Execute runs the transfer described by transferConfig. Progress is
+// recorded in a transfer journal so that a failed transfer can be picked
+// up again with Resume. Cancelling ctx, e.g. on Ctrl-C, stops the
+// transfer and removes everything it staged instead.
+func Execute(ctx context.Context, transferConfig model.TransferConfig) error {
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = journal.NewID()
+	}
+	if transferConfig.EphemeralBucket && transferConfig.BucketName == "" {
+		transferConfig.BucketName = EphemeralBucketName(transferConfig.TransferID)
+	}
+
+	j, err := journal.New(transferConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create transfer journal: %w", err)
+	}
+	log.Info("Transfer ID: %s", j.ID)
+
+	return executeJournaled(ctx, j)
+}
+
+// Resume continues the interrupted transfer with the given ID, skipping
+// every phase that already completed.
+func Resume(ctx context.Context, id string) error {
+	j, err := journal.Load(id)
+	if err != nil {
+		return err
+	}
+	log.Info("Resuming transfer %s", j.ID)
+
+	return executeJournaled(ctx, j)
+}
+
+// executeJournaled runs the transfer recorded in j with default AWS
+// clients, removing the journal once the transfer succeeds or is
+// cancelled.
+func executeJournaled(ctx context.Context, j *journal.Journal) error {
+	clients, err := awsclient.New(ctx, awsclient.DefaultOptions())
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return err
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
-	ssmClient := ssm.NewFromConfig(cfg)
+	ssmClient := clients.SSM()
 
-	if transferConfig.Direction == model.FromRemote {
-		return ExecuteFromRemoteWithClients(ctx, transferConfig, s3Client, ssmClient)
+	if j.Transfer.EphemeralBucket {
+		j.Transfer.BucketRegion = clients.Region()
+		return executeEphemeral(ctx, j, clients.S3(), ssmClient, clients.Region())
 	}
 
-	return ExecuteToRemoteWithClients(ctx, transferConfig, s3Client, ssmClient)
+	s3Client, region := BucketClient(ctx, clients, j.Transfer.BucketName)
+	j.Transfer.BucketRegion = region
+	warnCrossRegion(j.Transfer.BucketName, region, clients.Region())
+	return finishJournaled(ctx, j, ExecuteWithJournal(ctx, j, s3Client, ssmClient))
+}
+
+// executeEphemeral runs the transfer recorded in j in an ephemeral bucket
+// created in region, deleting the bucket once the transfer finishes. The
+// bucket is kept when a failed transfer keeps its staged objects for
+// resuming.
+func executeEphemeral(ctx context.Context, j *journal.Journal, s3Client EphemeralBucketAPI, ssmClient SSMAPI, region string) error {
+	sweepEphemeralBuckets(ctx, s3Client, region)
+
+	bucket := EphemeralBucket{Bucket: j.Transfer.BucketName, Region: region, TransferID: j.ID}
+	created, err := createEphemeralBucket(ctx, s3Client, bucket)
+	if err != nil {
+		return finishJournaled(ctx, j, err)
+	}
+	if created {
+		// Nothing staged by an earlier attempt survived the bucket
+		logJournalError(j.ResetProgress())
+	}
+
+	err = ExecuteWithJournal(ctx, j, s3Client, ssmClient)
+	if err == nil || !j.Transfer.KeepStaged {
+		if deleteErr := DeleteEphemeralBucket(ctx, s3Client, bucket); deleteErr != nil {
+			log.Warn("%v (remove it later with: bcp bucket cleanup)", deleteErr)
+		}
+	}
+
+	return finishJournaled(ctx, j, err)
+}
+
+// finishJournaled removes j once its transfer has succeeded, or has failed
+// without keeping its staged objects, and returns err, the result of the
+// transfer. Only a failed transfer that kept its staged objects is left
+// to resume.
+func finishJournaled(ctx context.Context, j *journal.Journal, err error) error {
+	if err != nil {
+		if !j.Transfer.KeepStaged {
+			// The staged objects were cleaned up and the progress reset,
+			// so there is nothing left to resume
+			if err := j.Remove(); err != nil {
+				log.Warn("Failed to remove transfer journal: %v", err)
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("transfer %s was interrupted: %w", j.ID, err)
+			}
+			return err
+		}
+		logJournalError(j.Flush())
+		log.Warn("Transfer %s did not complete, resume it with: bcp resume %s", j.ID, j.ID)
+		return err
+	}
+
+	if err := j.Remove(); err != nil {
+		log.Warn("Failed to remove transfer journal: %v", err)
+	}
+	return nil
+}
+
+// ExecuteWithJournal performs the transfer recorded in j using the provided
+// AWS clients, skipping phases and uploads the journal marks as complete.
+func ExecuteWithJournal(ctx context.Context, j *journal.Journal, s3Client S3API, ssmClient SSMAPI) error {
+	if j.Transfer.Direction == model.FromRemote {
+		return executeFromRemote(ctx, j.Transfer, s3Client, ssmClient, j)
+	}
+	return executeToRemote(ctx, j.Transfer, s3Client, ssmClient, j)
 }
 
 // ExecuteToRemoteWithClients performs the transfer from local to remote using provided AWS clients
 func ExecuteToRemoteWithClients(ctx context.Context, transferConfig model.TransferConfig, s3Client S3API, ssmClient SSMAPI) error {
-	log.Info("Starting transfer from %s to %s:%s", transferConfig.Source, transferConfig.SSMInstanceID, transferConfig.Destination)
+	return executeToRemote(ctx, transferConfig, s3Client, ssmClient, nil)
+}
 
-	uploadPath := strings.TrimPrefix(transferConfig.Source, "./")
-	s3URL := fmt.Sprintf("s3://%s/%s", transferConfig.BucketName, uploadPath)
+// executeToRemote performs the transfer from local to remote, recording
+// progress in j when it is non-nil.
+func executeToRemote(ctx context.Context, transferConfig model.TransferConfig, s3Client S3API, ssmClient SSMAPI, j *journal.Journal) (err error) {
+	log.Info("Starting transfer from %s to %s:%s", transferConfig.Source, transferConfig.SSMInstanceID, transferConfig.Destination)
 
-	log.Info("Uploading %s to S3 bucket %s...", transferConfig.Source, transferConfig.BucketName)
-	if err := retryOperation(func() error {
-		return UploadToS3(ctx, s3Client, transferConfig.BucketName, uploadPath)
-	}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
-		return fmt.Errorf("failed to upload to S3: %w", err)
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = journal.NewID()
 	}
-	log.Info("Upload to S3 completed successfully")
 
-	log.Info("Checking if AWS CLI is installed on instance %s...", transferConfig.SSMInstanceID)
-	awsCLICheck, err := checkAWSCLIInstalled(ctx, ssmClient, transferConfig.SSMInstanceID)
+	// Stage under a prefix of our own so concurrent transfers of the same
+	// path cannot overwrite each other's objects
+	keyPrefix := stagingPrefix(transferConfig.TransferID)
+	staged, err := stagedFiles(transferConfig.Source, keyPrefix)
 	if err != nil {
-		return fmt.Errorf("failed to check AWS CLI installation: %w", err)
+		return err
 	}
-	if !awsCLICheck {
-		return fmt.Errorf("AWS CLI is not installed on instance %s", transferConfig.SSMInstanceID)
+	s3URL := fmt.Sprintf("s3://%s/%s", transferConfig.BucketName, stagedRoot(staged, keyPrefix, transferConfig.IsDirectory))
+
+	cleanup := func(ctx context.Context) error {
+		return deleteStagedFiles(ctx, s3Client, transferConfig.BucketName, staged)
 	}
-	log.Info("AWS CLI is installed on remote instance")
+	defer func() {
+		if err != nil && !transferConfig.KeepStaged {
+			cleanupStaged(ctx, s3Client, transferConfig.BucketName, j, err, cleanup)
+		}
+	}()
 
-	log.Info("Downloading from S3 to remote instance...")
-	var downloadCommand string
-	if transferConfig.IsDirectory {
-		downloadCommand = fmt.Sprintf("aws s3 cp %s %s --recursive", s3URL, transferConfig.Destination)
-	} else {
-		downloadCommand = fmt.Sprintf("aws s3 cp %s %s", s3URL, transferConfig.Destination)
+	host, err := connectHost(ctx, ssmClient, s3Client, transferConfig, j)
+	if err != nil {
+		return err
+	}
+
+	opts := optionsFromConfig(transferConfig)
+	opts.Journal = j
+	opts.checksums = &uploadedChecksums{}
+	var secret string
+	if transferConfig.ClientEncryption {
+		if err := requireDecryptor(ctx, host); err != nil {
+			return err
+		}
+		if secret, err = transferSecret(j); err != nil {
+			return err
+		}
+		if opts.EncryptionKey, err = dataKey(secret); err != nil {
+			return err
+		}
 	}
-	if err := retryOperation(func() error {
-		_, err := runSSMCommand(ctx, ssmClient, transferConfig.SSMInstanceID, []string{downloadCommand})
+
+	if err := runPhase(j, journal.PhaseUpload, func() error {
+		log.Info("Uploading %s to S3 bucket %s...", transferConfig.Source, transferConfig.BucketName)
+		if err := retryOperation(ctx, func() error {
+			return UploadToS3WithOptions(ctx, s3Client, transferConfig.BucketName, transferConfig.Source, keyPrefix, opts)
+		}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
+			return fmt.Errorf("failed to upload to S3: %w", err)
+		}
+		log.Info("Upload to S3 completed successfully")
+		return nil
+	}); err != nil {
 		return err
-	}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
-		return fmt.Errorf("failed to download from S3 to remote instance: %w", err)
 	}
-	log.Info("Download to remote instance completed successfully")
 
-	log.Info("Verifying files on remote instance...")
-	confirmCommand := fmt.Sprintf("ls -la %s", transferConfig.Destination)
-	output, err := runSSMCommand(ctx, ssmClient, transferConfig.SSMInstanceID, []string{confirmCommand})
+	tool, err := selectTransport(ctx, host, transferConfig, j)
 	if err != nil {
-		log.Warn("Failed to verify files on remote instance: %v", err)
-	} else {
-		log.Debug("Remote directory contents:\n%s", output)
+		return err
+	}
+
+	if err := runPhase(j, journal.PhaseRemoteDownload, func() error {
+		log.Info("Downloading from S3 to remote instance...")
+		if err := remoteDownload(ctx, s3Client, host, transferConfig, tool, s3URL, staged); err != nil {
+			return fmt.Errorf("failed to download from S3 to remote instance: %w", err)
+		}
+		log.Info("Download to remote instance completed successfully")
+
+		sums, err := stagedChecksums(staged, opts.checksums)
+		if err != nil {
+			return fmt.Errorf("failed to compute local checksums: %w", err)
+		}
+		if secret != "" {
+			if err := remoteDecrypt(ctx, host, transferConfig, remoteFiles(host.platform, transferConfig, staged), secret, sums); err != nil {
+				return fmt.Errorf("failed to decrypt files on remote instance: %w", err)
+			}
+		}
+
+		return verifyToRemote(ctx, host, expectedChecksums(staged, sums), filepath.Base(transferConfig.Source), transferConfig.Destination, transferConfig.IsDirectory)
+	}); err != nil {
+		return err
+	}
+
+	if !transferConfig.KeepStaged {
+		cleanupStaged(ctx, s3Client, transferConfig.BucketName, j, nil, cleanup)
 	}
 
 	log.Info("File transfer completed successfully!")
@@ -113,65 +269,347 @@ func ExecuteToRemoteWithClients(ctx context.Context, transferConfig model.Transf
 
 // ExecuteFromRemoteWithClients performs the transfer from remote to local using provided AWS clients
 func ExecuteFromRemoteWithClients(ctx context.Context, transferConfig model.TransferConfig, s3Client S3API, ssmClient SSMAPI) error {
+	return executeFromRemote(ctx, transferConfig, s3Client, ssmClient, nil)
+}
+
+// executeFromRemote performs the transfer from remote to local, recording
+// progress in j when it is non-nil.
+func executeFromRemote(ctx context.Context, transferConfig model.TransferConfig, s3Client S3API, ssmClient SSMAPI, j *journal.Journal) (err error) {
 	log.Info("Starting transfer from %s:%s to %s", transferConfig.SSMInstanceID, transferConfig.Source, transferConfig.Destination)
 
-	// Generate a unique S3 key for this transfer
-	uploadPath := fmt.Sprintf("bcp-download-%d", time.Now().Unix())
-	s3URL := fmt.Sprintf("s3://%s/%s", transferConfig.BucketName, uploadPath)
+	if transferConfig.ClientEncryption {
+		return fmt.Errorf("client-side encryption is only supported for transfers to a remote instance")
+	}
 
-	log.Info("Checking if AWS CLI is installed on instance %s...", transferConfig.SSMInstanceID)
-	awsCLICheck, err := checkAWSCLIInstalled(ctx, ssmClient, transferConfig.SSMInstanceID)
+	if transferConfig.TransferID == "" {
+		transferConfig.TransferID = journal.NewID()
+	}
+
+	host, err := connectHost(ctx, ssmClient, s3Client, transferConfig, j)
 	if err != nil {
-		return fmt.Errorf("failed to check AWS CLI installation: %w", err)
+		return err
 	}
-	if !awsCLICheck {
-		return fmt.Errorf("AWS CLI is not installed on instance %s", transferConfig.SSMInstanceID)
+
+	// Generate a unique S3 key for this transfer, reusing the key chosen
+	// by an earlier attempt when resuming
+	uploadPath := j.Value(stagingKeyValue)
+	if uploadPath == "" {
+		uploadPath = stagingPrefix(transferConfig.TransferID) + stagingName(host.platform.base(transferConfig.Source))
+		logJournalError(j.SetValue(stagingKeyValue, uploadPath))
 	}
-	log.Info("AWS CLI is installed on remote instance")
+	s3URL := fmt.Sprintf("s3://%s/%s", transferConfig.BucketName, uploadPath)
 
-	// Check if source is a directory on remote
-	log.Info("Checking if source is a directory on remote instance...")
-	checkDirCommand := fmt.Sprintf("test -d %s && echo 'directory' || echo 'file'", transferConfig.Source)
-	output, err := runSSMCommand(ctx, ssmClient, transferConfig.SSMInstanceID, []string{checkDirCommand})
+	tool, err := selectTransport(ctx, host, transferConfig, j)
 	if err != nil {
-		return fmt.Errorf("failed to check if source is directory: %w", err)
+		return err
+	}
+
+	// Check if source is a directory on remote
+	isDirectory := j.Value(sourceIsDirectoryValue) == "true"
+	cleanup := func(ctx context.Context) error {
+		return CleanupS3Objects(ctx, s3Client, transferConfig.BucketName, uploadPath, isDirectory)
+	}
+	defer func() {
+		if err != nil && !transferConfig.KeepStaged {
+			cleanupStaged(ctx, s3Client, transferConfig.BucketName, j, err, cleanup)
+		}
+	}()
+	if err := runPhase(j, journal.PhaseDetectSource, func() error {
+		log.Info("Checking if source is a directory on remote instance...")
+		output, err := host.run(ctx, host.platform.isDirectoryCommand(transferConfig.Source))
+		if err != nil {
+			return fmt.Errorf("failed to check if source is directory: %w", err)
+		}
+		isDirectory = strings.TrimSpace(output) == "directory"
+		logJournalError(j.SetValue(sourceIsDirectoryValue, strconv.FormatBool(isDirectory)))
+		return nil
+	}); err != nil {
+		return err
 	}
-	isDirectory := strings.TrimSpace(output) == "directory"
 	log.Debug("Source is directory: %v", isDirectory)
 
-	log.Info("Uploading from remote instance to S3...")
-	var uploadCommand string
-	if isDirectory {
-		uploadCommand = fmt.Sprintf("aws s3 cp %s %s --recursive", transferConfig.Source, s3URL)
-	} else {
-		uploadCommand = fmt.Sprintf("aws s3 cp %s %s", transferConfig.Source, s3URL)
+	if err := runPhase(j, journal.PhaseRemoteUpload, func() error {
+		log.Info("Uploading from remote instance to S3...")
+		if err := remoteUpload(ctx, s3Client, host, transferConfig, tool, s3URL, uploadPath, isDirectory); err != nil {
+			return fmt.Errorf("failed to upload from remote instance to S3: %w", err)
+		}
+		log.Info("Upload to S3 completed successfully")
+		return nil
+	}); err != nil {
+		return err
 	}
-	if err := retryOperation(func() error {
-		_, err := runSSMCommand(ctx, ssmClient, transferConfig.SSMInstanceID, []string{uploadCommand})
+
+	if err := runPhase(j, journal.PhaseLocalDownload, func() error {
+		log.Info("Downloading from S3 to local destination...")
+		if err := retryOperation(ctx, func() error {
+			return downloadFromS3(ctx, s3Client, transferConfig.BucketName, uploadPath, transferConfig.Destination, isDirectory, optionsFromConfig(transferConfig))
+		}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
+			return fmt.Errorf("failed to download from S3: %w", err)
+		}
+		log.Info("Download to local completed successfully")
+
+		return verifyFromRemote(ctx, host, transferConfig.Source, transferConfig.Destination, isDirectory)
+	}); err != nil {
 		return err
-	}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
-		return fmt.Errorf("failed to upload from remote instance to S3: %w", err)
 	}
-	log.Info("Upload to S3 completed successfully")
 
-	log.Info("Downloading from S3 to local destination...")
-	if err := retryOperation(func() error {
-		return downloadFromS3(ctx, s3Client, transferConfig.BucketName, uploadPath, transferConfig.Destination, isDirectory)
-	}, transferConfig.MaxRetries, transferConfig.RetryDelay); err != nil {
-		return fmt.Errorf("failed to download from S3: %w", err)
+	if !transferConfig.KeepStaged {
+		cleanupStaged(ctx, s3Client, transferConfig.BucketName, j, nil, cleanup)
 	}
-	log.Info("Download to local completed successfully")
 
-	// Clean up S3 objects
-	log.Info("Cleaning up S3 objects...")
-	if err := CleanupS3Objects(ctx, s3Client, transferConfig.BucketName, uploadPath, isDirectory); err != nil {
+	log.Info("File transfer completed successfully!")
+	return nil
+}
+
+// cleanupTimeout bounds the cleanup run once a transfer finishes, so a
+// hang after an interrupt cannot keep bcp from exiting.
+const cleanupTimeout = time.Minute
+
+// cleanupStaged removes what a finished transfer staged in S3 with
+// cleanup. When the transfer failed with transferErr, it also aborts the
+// multipart uploads j kept for resuming and resets j, so that resuming
+// stages the objects again. It runs without ctx's cancellation so that
+// interrupted transfers are cleaned up too.
+func cleanupStaged(ctx context.Context, s3Client S3API, bucketName string, j *journal.Journal, transferErr error, cleanup func(ctx context.Context) error) {
+	switch {
+	case transferErr == nil:
+		log.Info("Cleaning up S3 objects...")
+	case ctx.Err() != nil:
+		log.Warn("Transfer interrupted, cleaning up staged S3 objects...")
+	default:
+		log.Warn("Transfer failed, cleaning up staged S3 objects (use --keep-staged to keep them for resuming)...")
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	if transferErr != nil {
+		for key, uploadID := range j.PendingUploads() {
+			abortMultipartUpload(ctx, s3Client, bucketName, key, uploadID)
+		}
+		logJournalError(j.ResetProgress())
+	}
+	if err := cleanup(ctx); err != nil {
 		log.Warn("Failed to clean up S3 objects: %v", err)
 	}
+}
 
-	log.Info("File transfer completed successfully!")
+// deleteStagedFiles deletes the objects files were staged at, reporting
+// the ones that could not be deleted in a *DeleteError.
+func deleteStagedFiles(ctx context.Context, client S3API, bucketName string, files []stagedFile) error {
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, file.Key)
+	}
+	return newDeleteError(bucketName, deleteS3Objects(ctx, client, bucketName, keys))
+}
+
+// Journal values that must survive a resume.
+const (
+	stagingKeyValue        = "staging_key"
+	sourceIsDirectoryValue = "source_is_directory"
+	remoteToolValue        = "remote_tool"
+	platformValue          = "platform"
+)
+
+// selectTransport picks the tool the instance uses to reach S3, reusing
+// the choice recorded in j when resuming.
+func selectTransport(ctx context.Context, host remoteHost, transferConfig model.TransferConfig, j *journal.Journal) (remoteTool, error) {
+	tool := remoteTool(j.Value(remoteToolValue))
+	err := runPhase(j, journal.PhaseSelectTransport, func() error {
+		var err error
+		tool, err = selectRemoteTool(ctx, host, transferConfig.RemoteTransport)
+		if err != nil {
+			return err
+		}
+		logJournalError(j.SetValue(remoteToolValue, string(tool)))
+		return nil
+	})
+	return tool, err
+}
+
+// remoteDownload has the instance copy the staged files, rooted at s3URL,
+// to the transfer destination using tool.
+func remoteDownload(ctx context.Context, s3Client S3API, host remoteHost, transferConfig model.TransferConfig, tool remoteTool, s3URL string, staged []stagedFile) error {
+	if tool != toolAWSCLI {
+		presigner, err := presignerFor(s3Client)
+		if err != nil {
+			return err
+		}
+		return presignedDownload(ctx, presigner, host, transferConfig, tool, remoteFiles(host.platform, transferConfig, staged))
+	}
+
+	downloadCommand := awsS3DownloadCommand(host.platform, transferConfig, s3URL)
+	return retryOperation(ctx, func() error {
+		_, err := host.run(ctx, downloadCommand)
+		return err
+	}, transferConfig.MaxRetries, transferConfig.RetryDelay)
+}
+
+// awsS3DownloadCommand returns the AWS CLI command that copies the staged
+// files rooted at s3URL to the transfer destination.
+func awsS3DownloadCommand(platform remotePlatform, transferConfig model.TransferConfig, s3URL string) string {
+	args := []string{"s3", "cp", s3URL, transferConfig.Destination}
+	if transferConfig.IsDirectory {
+		args = append(args, "--recursive")
+	}
+	return awsS3Command(platform, transferConfig, args...)
+}
+
+// remoteFiles pairs each staged file with the path it is downloaded to on
+// an instance running platform.
+func remoteFiles(platform remotePlatform, transferConfig model.TransferConfig, staged []stagedFile) []presignedFile {
+	files := make([]presignedFile, 0, len(staged))
+	for _, file := range staged {
+		remotePath := transferConfig.Destination
+		if transferConfig.IsDirectory {
+			remotePath = platform.join(transferConfig.Destination, file.RelPath)
+		}
+		files = append(files, presignedFile{Key: file.Key, RemotePath: remotePath})
+	}
+	return files
+}
+
+// remoteUpload has the instance copy the transfer source to s3URL using
+// tool.
+func remoteUpload(ctx context.Context, s3Client S3API, host remoteHost, transferConfig model.TransferConfig, tool remoteTool, s3URL, uploadPath string, isDirectory bool) error {
+	if tool != toolAWSCLI {
+		presigner, err := presignerFor(s3Client)
+		if err != nil {
+			return err
+		}
+		return presignedUpload(ctx, presigner, host, transferConfig, tool, uploadPath, isDirectory)
+	}
+
+	args := []string{"s3", "cp", transferConfig.Source, s3URL}
+	if isDirectory {
+		args = append(args, "--recursive")
+	}
+	if transferConfig.SSE != model.ServerSideEncryptionNone {
+		args = append(args, "--sse", string(transferConfig.SSE))
+		if transferConfig.SSE == model.ServerSideEncryptionKMS && transferConfig.KMSKeyID != "" {
+			args = append(args, "--sse-kms-key-id", transferConfig.KMSKeyID)
+		}
+	}
+	uploadCommand := awsS3Command(host.platform, transferConfig, args...)
+	return retryOperation(ctx, func() error {
+		_, err := host.run(ctx, uploadCommand)
+		return err
+	}, transferConfig.MaxRetries, transferConfig.RetryDelay)
+}
+
+// awsS3Command returns the AWS CLI command with args for an instance
+// running platform, pointed at the bucket's region and the transfer's S3
+// endpoint when they are known.
+func awsS3Command(platform remotePlatform, transferConfig model.TransferConfig, args ...string) string {
+	if transferConfig.BucketRegion != "" {
+		args = append(args, "--region", transferConfig.BucketRegion)
+	}
+	if transferConfig.S3Endpoint != "" {
+		args = append(args, "--endpoint-url", transferConfig.S3Endpoint)
+	}
+	return platform.command("aws", args...)
+}
+
+// runPhase runs fn unless j records phase as already completed, and
+// records the phase once fn succeeds.
+func runPhase(j *journal.Journal, phase journal.Phase, fn func() error) error {
+	if j.PhaseDone(phase) {
+		log.Info("Skipping %s phase, already completed", phase)
+		return nil
+	}
+
+	if err := fn(); err != nil {
+		// Keep the progress the phase made for resuming
+		logJournalError(j.Flush())
+		return err
+	}
+
+	logJournalError(j.MarkPhase(phase))
+	return nil
+}
+
+// logJournalError warns when transfer progress could not be persisted.
+// The transfer itself can still succeed; it just resumes less precisely.
+func logJournalError(err error) {
+	if err != nil {
+		log.Warn("Failed to update transfer journal: %v", err)
+	}
+}
+
+// requireAWSCLI returns an error unless the AWS CLI is installed on the
+// instance.
+func requireAWSCLI(ctx context.Context, host remoteHost) error {
+	log.Info("Checking if AWS CLI is installed on instance %s...", host.id)
+	awsCLICheck, err := checkAWSCLIInstalled(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to check AWS CLI installation: %w", err)
+	}
+	if !awsCLICheck {
+		return fmt.Errorf("AWS CLI is not installed on instance %s", host.id)
+	}
+	log.Info("AWS CLI is installed on remote instance")
 	return nil
 }
 
+// Options tunes how files are moved between the local filesystem and S3.
+type Options struct {
+	// Concurrency is the maximum number of objects (or parts of a single
+	// large object) transferred at once. Values below 1 transfer one at a
+	// time.
+	Concurrency int
+	// PartSize is the size in bytes of each multipart upload part and
+	// ranged download request.
+	PartSize int64
+	// MultipartThreshold is the file size in bytes at which uploads switch
+	// to multipart and downloads switch to parallel byte ranges. Zero
+	// disables both.
+	MultipartThreshold int64
+	// Journal, when set, records completed uploads and multipart parts so
+	// a resumed transfer can skip them.
+	Journal *journal.Journal
+	// SSE is the server-side encryption uploads request, and KMSKeyID the
+	// key SSE-KMS uses. An empty SSE leaves encryption to the bucket.
+	SSE      model.ServerSideEncryption
+	KMSKeyID string
+	// EncryptionKey, when set, is the AES-256 key uploads are encrypted
+	// with before they leave this machine.
+	EncryptionKey []byte
+
+	// checksums, when set, records the SHA-256 of each uploaded file
+	checksums *uploadedChecksums
+}
+
+// objectCipher returns the cipher a new object is encrypted with, or nil
+// when uploads are not encrypted client-side.
+func (o Options) objectCipher() (*objectCipher, error) {
+	if len(o.EncryptionKey) == 0 {
+		return nil, nil
+	}
+	return newObjectCipher(o.EncryptionKey)
+}
+
+// encryption returns the server-side encryption settings uploads are sent
+// with.
+func (o Options) encryption() (s3types.ServerSideEncryption, *string) {
+	var keyID *string
+	if o.SSE == model.ServerSideEncryptionKMS && o.KMSKeyID != "" {
+		keyID = aws.String(o.KMSKeyID)
+	}
+	return s3types.ServerSideEncryption(o.SSE), keyID
+}
+
+// optionsFromConfig derives the S3 transfer options for transferConfig.
+func optionsFromConfig(transferConfig model.TransferConfig) Options {
+	return Options{
+		Concurrency:        transferConfig.Concurrency,
+		PartSize:           transferConfig.PartSize,
+		MultipartThreshold: transferConfig.MultipartThreshold,
+		SSE:                transferConfig.SSE,
+		KMSKeyID:           transferConfig.KMSKeyID,
+	}
+}
+
 // UploadToS3 uploads a file or directory to S3.
 // If localPath is a directory, files are uploaded recursively with keys
 // relative to the directory's parent.
@@ -184,6 +622,12 @@ func UploadToS3(ctx context.Context, client S3API, bucketName, localPath string)
 // behavior. The prefix is normalized to use forward slashes and a trailing
 // slash is added if missing.
 func UploadToS3WithPrefix(ctx context.Context, client S3API, bucketName, localPath, keyPrefix string) error {
+	return UploadToS3WithOptions(ctx, client, bucketName, localPath, keyPrefix, Options{})
+}
+
+// UploadToS3WithOptions behaves like UploadToS3WithPrefix but lets the
+// caller tune the transfer, e.g. to upload directory contents in parallel.
+func UploadToS3WithOptions(ctx context.Context, client S3API, bucketName, localPath, keyPrefix string, opts Options) error {
 	fileInfo, err := os.Stat(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to stat %s: %w", localPath, err)
@@ -192,9 +636,9 @@ func UploadToS3WithPrefix(ctx context.Context, client S3API, bucketName, localPa
 	prefix := normalizeKeyPrefix(keyPrefix)
 
 	if fileInfo.IsDir() {
-		return uploadDirectory(ctx, client, bucketName, localPath, prefix)
+		return uploadDirectory(ctx, client, bucketName, localPath, prefix, opts)
 	}
-	return uploadFile(ctx, client, bucketName, localPath, prefix+filepath.Base(localPath))
+	return uploadFile(ctx, client, bucketName, localPath, prefix+filepath.Base(localPath), opts)
 }
 
 // normalizeKeyPrefix ensures the prefix uses forward slashes and ends with
@@ -210,9 +654,35 @@ func normalizeKeyPrefix(prefix string) string {
 	return prefix
 }
 
-// uploadDirectory recursively uploads a directory to S3 under keyPrefix.
-func uploadDirectory(ctx context.Context, client S3API, bucketName, localPath, keyPrefix string) error {
-	return filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
+// stagedFile is a local file together with the S3 key it is staged
+// under.
+type stagedFile struct {
+	// Path is the local path of the file.
+	Path string
+	// Key is the object key the file is uploaded to.
+	Key string
+	// RelPath is the slash-separated path of the file relative to the
+	// uploaded directory, or the file name for a single file.
+	RelPath string
+}
+
+// stagedFiles lists the files UploadToS3WithOptions uploads for localPath
+// and the keys they are written to. Directory contents are keyed relative
+// to the directory's parent so the directory name is kept.
+func stagedFiles(localPath, keyPrefix string) ([]stagedFile, error) {
+	fileInfo, err := os.Stat(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+
+	prefix := normalizeKeyPrefix(keyPrefix)
+	if !fileInfo.IsDir() {
+		name := filepath.Base(localPath)
+		return []stagedFile{{Path: localPath, Key: prefix + name, RelPath: name}}, nil
+	}
+
+	var files []stagedFile
+	err = filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -222,20 +692,53 @@ func uploadDirectory(ctx context.Context, client S3API, bucketName, localPath, k
 		}
 
 		// Calculate the relative path for the S3 key
-		relPath, err := filepath.Rel(filepath.Dir(localPath), path)
+		keyPath, err := filepath.Rel(filepath.Dir(localPath), path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		relPath, err := filepath.Rel(localPath, path)
 		if err != nil {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
 		// Convert Windows paths to Unix-style for S3
-		s3Key := keyPrefix + filepath.ToSlash(relPath)
-
-		return uploadFile(ctx, client, bucketName, path, s3Key)
+		files = append(files, stagedFile{
+			Path:    path,
+			Key:     prefix + filepath.ToSlash(keyPath),
+			RelPath: filepath.ToSlash(relPath),
+		})
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
 }
 
-// uploadFile uploads a single file to S3
-func uploadFile(ctx context.Context, client S3API, bucketName, filePath, s3Key string) error {
+// uploadDirectory recursively uploads a directory to S3 under keyPrefix,
+// using up to opts.Concurrency parallel uploads.
+func uploadDirectory(ctx context.Context, client S3API, bucketName, localPath, keyPrefix string, opts Options) error {
+	files, err := stagedFiles(localPath, keyPrefix)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]job, 0, len(files))
+	for _, file := range files {
+		jobs = append(jobs, func(ctx context.Context) error {
+			return uploadFile(ctx, client, bucketName, file.Path, file.Key, opts)
+		})
+	}
+
+	log.Debug("Uploading %d file(s) from %s with concurrency %d", len(jobs), localPath, opts.Concurrency)
+	return runPool(ctx, opts.Concurrency, jobs)
+}
+
+// uploadFile uploads a single file to S3, switching to a multipart upload
+// when the file reaches opts.MultipartThreshold. The file's SHA-256 is
+// recorded in opts.checksums and stored in the object's metadata unless
+// it is encrypted.
+func uploadFile(ctx context.Context, client S3API, bucketName, filePath, s3Key string, opts Options) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file %s: %w", filePath, err)
@@ -246,30 +749,75 @@ func uploadFile(ctx context.Context, client S3API, bucketName, filePath, s3Key s
 		}
 	}()
 
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", filePath, err)
+	}
+
+	if obj := opts.Journal.Object(s3Key); obj != nil && obj.Complete && obj.Matches(fileInfo.Size(), fileInfo.ModTime()) {
+		log.Debug("Skipping %s, already uploaded to s3://%s/%s", filePath, bucketName, s3Key)
+		return nil
+	}
+
+	sum, err := sha256Reader(file)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", filePath, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind %s: %w", filePath, err)
+	}
+	opts.checksums.record(s3Key, sum)
+
+	// The checksum of an encrypted file is left out of its metadata so the
+	// bucket reveals nothing about the plaintext
+	var metadata map[string]string
+	if len(opts.EncryptionKey) == 0 {
+		metadata = map[string]string{checksumMetadataKey: sum}
+	}
+
+	if opts.useMultipart(fileInfo.Size()) {
+		return uploadMultipart(ctx, client, bucketName, file, fileInfo, s3Key, metadata, opts)
+	}
+
 	log.Debug("Uploading %s to s3://%s/%s", filePath, bucketName, s3Key)
 
+	var body io.ReadSeeker = file
+	enc, err := opts.objectCipher()
+	if err != nil {
+		return err
+	}
+	if enc != nil {
+		body = enc.section(file, 0, fileInfo.Size())
+	}
+
+	sse, kmsKeyID := opts.encryption()
 	_, err = client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(s3Key),
-		Body:   file,
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(s3Key),
+		Body:                 body,
+		Metadata:             metadata,
+		ServerSideEncryption: sse,
+		SSEKMSKeyId:          kmsKeyID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to upload %s to S3: %w", filePath, err)
 	}
 
+	logJournalError(opts.Journal.CompleteObject(s3Key, fileInfo.Size(), fileInfo.ModTime()))
 	return nil
 }
 
 // downloadFromS3 downloads a file or directory from S3 to local
-func downloadFromS3(ctx context.Context, client S3API, bucketName, s3Key, localPath string, isDirectory bool) error {
+func downloadFromS3(ctx context.Context, client S3API, bucketName, s3Key, localPath string, isDirectory bool, opts Options) error {
 	if isDirectory {
-		return downloadDirectory(ctx, client, bucketName, s3Key, localPath)
+		return downloadDirectory(ctx, client, bucketName, s3Key, localPath, opts)
 	}
-	return downloadFile(ctx, client, bucketName, s3Key, localPath)
+	return downloadFile(ctx, client, bucketName, s3Key, localPath, opts)
 }
 
-// downloadDirectory downloads all objects with a given prefix from S3
-func downloadDirectory(ctx context.Context, client S3API, bucketName, prefix, localPath string) error {
+// downloadDirectory downloads all objects with a given prefix from S3,
+// using up to opts.Concurrency parallel downloads.
+func downloadDirectory(ctx context.Context, client S3API, bucketName, prefix, localPath string, opts Options) error {
 	// Ensure local directory exists
 	if err := os.MkdirAll(localPath, 0755); err != nil {
 		return fmt.Errorf("failed to create local directory %s: %w", localPath, err)
@@ -281,6 +829,7 @@ func downloadDirectory(ctx context.Context, client S3API, bucketName, prefix, lo
 		Prefix: aws.String(prefix),
 	}
 
+	var jobs []job
 	paginator := s3.NewListObjectsV2Paginator(client, listInput)
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
@@ -305,20 +854,36 @@ func downloadDirectory(ctx context.Context, client S3API, bucketName, prefix, lo
 				return fmt.Errorf("failed to create directory for %s: %w", localFilePath, err)
 			}
 
-			// Download the file
-			if err := downloadFile(ctx, client, bucketName, key, localFilePath); err != nil {
-				return err
-			}
+			jobs = append(jobs, func(ctx context.Context) error {
+				return downloadFile(ctx, client, bucketName, key, localFilePath, opts)
+			})
 		}
 	}
 
-	return nil
+	log.Debug("Downloading %d object(s) to %s with concurrency %d", len(jobs), localPath, opts.Concurrency)
+	return runPool(ctx, opts.Concurrency, jobs)
 }
 
-// downloadFile downloads a single file from S3
-func downloadFile(ctx context.Context, client S3API, bucketName, s3Key, localPath string) error {
+// downloadFile downloads a single file from S3. Objects that reach
+// opts.MultipartThreshold are fetched as parallel byte ranges.
+func downloadFile(ctx context.Context, client S3API, bucketName, s3Key, localPath string, opts Options) error {
 	log.Debug("Downloading s3://%s/%s to %s", bucketName, s3Key, localPath)
 
+	if opts.multipartEnabled() {
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(s3Key),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get object metadata from S3: %w", err)
+		}
+
+		size := aws.ToInt64(head.ContentLength)
+		if opts.useMultipart(size) {
+			return downloadRanges(ctx, client, bucketName, s3Key, localPath, size, aws.ToString(head.ETag), opts)
+		}
+	}
+
 	result, err := client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(s3Key),
@@ -353,34 +918,103 @@ func downloadFile(ctx context.Context, client S3API, bucketName, s3Key, localPat
 
 // CleanupS3Objects deletes objects from S3.
 // When isDirectory is true, all objects with s3Key as a prefix are deleted;
-// otherwise s3Key is treated as a single object key.
+// otherwise s3Key is treated as a single object key. Objects that could
+// not be deleted are reported in a *DeleteError.
 func CleanupS3Objects(ctx context.Context, client S3API, bucketName, s3Key string, isDirectory bool) error {
-	if isDirectory {
-		// List and delete all objects with the prefix
-		listInput := &s3.ListObjectsV2Input{
-			Bucket: aws.String(bucketName),
-			Prefix: aws.String(s3Key),
+	if !isDirectory {
+		return deleteS3Object(ctx, client, bucketName, s3Key)
+	}
+
+	// List and delete all objects with the prefix, a page at a time
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(s3Key),
+	}
+
+	failed := make(map[string]string)
+	paginator := s3.NewListObjectsV2Paginator(client, listInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to list S3 objects for cleanup: %w", err), newDeleteError(bucketName, failed))
 		}
 
-		paginator := s3.NewListObjectsV2Paginator(client, listInput)
-		for paginator.HasMorePages() {
-			page, err := paginator.NextPage(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to list S3 objects for cleanup: %w", err)
-			}
+		keys := make([]string, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+		maps.Copy(failed, deleteS3Objects(ctx, client, bucketName, keys))
+	}
+
+	return newDeleteError(bucketName, failed)
+}
+
+// maxDeleteBatch is the most keys S3 accepts in one DeleteObjects request.
+const maxDeleteBatch = 1000
+
+// DeleteError reports the objects a cleanup could not delete.
+type DeleteError struct {
+	Bucket string
+	// Failed maps each key that was not deleted to the reason why.
+	Failed map[string]string
+}
+
+// newDeleteError returns a *DeleteError for failed, or nil if no keys
+// failed.
+func newDeleteError(bucketName string, failed map[string]string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &DeleteError{Bucket: bucketName, Failed: failed}
+}
+
+// Keys returns the keys that were not deleted, sorted.
+func (e *DeleteError) Keys() []string {
+	return slices.Sorted(maps.Keys(e.Failed))
+}
 
-			for _, obj := range page.Contents {
-				key := aws.ToString(obj.Key)
-				if err := deleteS3Object(ctx, client, bucketName, key); err != nil {
-					log.Warn("Failed to delete S3 object %s: %v", key, err)
-				}
+func (e *DeleteError) Error() string {
+	const maxListed = 10
+
+	keys := e.Keys()
+	details := make([]string, 0, min(len(keys), maxListed))
+	for _, key := range keys[:min(len(keys), maxListed)] {
+		details = append(details, fmt.Sprintf("%s (%s)", key, e.Failed[key]))
+	}
+	if len(keys) > maxListed {
+		details = append(details, fmt.Sprintf("and %d more", len(keys)-maxListed))
+	}
+	return fmt.Sprintf("failed to delete %d object(s) from s3://%s: %s", len(keys), e.Bucket, strings.Join(details, ", "))
+}
+
+// deleteS3Objects deletes keys in DeleteObjects requests of up to
+// maxDeleteBatch keys and returns the keys that were not deleted, mapped
+// to the reason why.
+func deleteS3Objects(ctx context.Context, client S3API, bucketName string, keys []string) map[string]string {
+	failed := make(map[string]string)
+	for batch := range slices.Chunk(keys, maxDeleteBatch) {
+		log.Debug("Deleting %d object(s) from s3://%s", len(batch), bucketName)
+
+		objects := make([]s3types.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, s3types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		result, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			for _, key := range batch {
+				failed[key] = err.Error()
 			}
+			continue
+		}
+		for _, deleteErr := range result.Errors {
+			failed[aws.ToString(deleteErr.Key)] = fmt.Sprintf("%s: %s", aws.ToString(deleteErr.Code), aws.ToString(deleteErr.Message))
 		}
-	} else {
-		return deleteS3Object(ctx, client, bucketName, s3Key)
 	}
-
-	return nil
+	return failed
 }
 
 // deleteS3Object deletes a single object from S3
@@ -398,54 +1032,190 @@ func deleteS3Object(ctx context.Context, client S3API, bucketName, s3Key string)
 	return nil
 }
 
-// runSSMCommand executes a command on an EC2 instance via SSM and waits for completion
-func runSSMCommand(ctx context.Context, client SSMAPI, instanceID string, commands []string) (string, error) {
-	sendCommandInput := &ssm.SendCommandInput{
-		InstanceIds:  []string{instanceID},
-		DocumentName: aws.String("AWS-RunShellScript"),
-		Parameters: map[string][]string{
-			"commands": commands,
-		},
-	}
+// minDeliveryTimeout is the shortest delivery timeout, in seconds, that
+// SendCommand accepts.
+const minDeliveryTimeout = 30
 
-	result, err := client.SendCommand(ctx, sendCommandInput)
-	if err != nil {
-		return "", fmt.Errorf("failed to send command: %w", err)
-	}
+// commandPollInterval is how long runSSMDocument first waits between
+// status checks of a command, doubling up to maxCommandPollInterval so
+// long-running transfers are not polled needlessly often.
+var (
+	commandPollInterval    = time.Second
+	maxCommandPollInterval = 15 * time.Second
+)
 
-	commandID := aws.ToString(result.Command.CommandId)
+// runSSMCommand executes a shell command on a Linux EC2 instance via SSM and waits for completion
+func runSSMCommand(ctx context.Context, client SSMAPI, instanceID string, commands []string, timeout time.Duration) (string, error) {
+	host := remoteHost{client: client, id: instanceID, platform: platformPOSIX, timeout: timeout}
+	return host.run(ctx, commands...)
+}
 
-	// Wait for command to complete
-	maxAttempts := 30
-	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(2 * time.Second)
+// invocationResult is the outcome of a command on one instance.
+type invocationResult struct {
+	// output is the command's standard output if it succeeded
+	output string
+	// err is why the command failed on the instance, or nil if it
+	// succeeded
+	err error
+}
 
-		invocationOutput, err := client.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
-			CommandId:  aws.String(commandID),
-			InstanceId: aws.String(instanceID),
-		})
+// maxCommandInstances is the most instances a single SSM command can name.
+const maxCommandInstances = 50
+
+// runSSMDocument executes commands on every instance in instanceIDs with
+// the given SSM document and waits up to timeout for them to complete,
+// cancelling the command on the instances where they do not. SSM limits
+// how many instances one command names, so the instances are sent one
+// command per maxCommandInstances of them, all polled together. When
+// output is set, SSM also writes the commands' output there so it can be
+// read in full. The outcome on each instance is returned; an error is
+// only returned when the commands could not be sent or were interrupted.
+func runSSMDocument(ctx context.Context, client SSMAPI, instanceIDs []string, document string, commands []string, timeout time.Duration, output *commandOutputStore) (map[string]invocationResult, error) {
+	var sent []string
+	defer func() {
+		for _, commandID := range sent {
+			output.cleanup(ctx, commandID)
+		}
+	}()
+
+	// commandIDs holds the command each instance was sent
+	commandIDs := make(map[string]string, len(instanceIDs))
+	for start := 0; start < len(instanceIDs); start += maxCommandInstances {
+		batch := instanceIDs[start:min(start+maxCommandInstances, len(instanceIDs))]
+		result, err := client.SendCommand(ctx, newSendCommandInput(batch, document, commands, timeout, output))
 		if err != nil {
-			continue
+			cancelCommands(ctx, client, commandIDs, instanceIDs[:start])
+			return nil, fmt.Errorf("failed to send command: %w", err)
+		}
+		commandID := aws.ToString(result.Command.CommandId)
+		sent = append(sent, commandID)
+		for _, id := range batch {
+			commandIDs[id] = commandID
+		}
+	}
+	deadline := time.Now().Add(timeout)
+
+	results := make(map[string]invocationResult, len(instanceIDs))
+	pending := instanceIDs
+	for interval := commandPollInterval; len(pending) > 0; interval = min(interval*2, maxCommandPollInterval) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			cancelCommands(ctx, client, commandIDs, pending)
+			for _, id := range pending {
+				results[id] = invocationResult{err: fmt.Errorf("command %s did not complete within %s", commandIDs[id], timeout)}
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			cancelCommands(ctx, client, commandIDs, pending)
+			return nil, fmt.Errorf("command %s interrupted: %w", strings.Join(sent, ", "), ctx.Err())
+		case <-time.After(min(interval, remaining)):
+		}
+
+		var running []string
+		for _, id := range pending {
+			if result, done := pollInvocation(ctx, client, commandIDs[id], id, output); done {
+				results[id] = result
+			} else {
+				running = append(running, id)
+			}
+		}
+		pending = running
+	}
+	return results, nil
+}
+
+// cancelCommands cancels the commands still running on instanceIDs,
+// given the command each instance was sent.
+func cancelCommands(ctx context.Context, client SSMAPI, commandIDs map[string]string, instanceIDs []string) {
+	byCommand := make(map[string][]string)
+	var order []string
+	for _, id := range instanceIDs {
+		commandID := commandIDs[id]
+		if _, ok := byCommand[commandID]; !ok {
+			order = append(order, commandID)
 		}
+		byCommand[commandID] = append(byCommand[commandID], id)
+	}
+	for _, commandID := range order {
+		cancelCommand(ctx, client, commandID, byCommand[commandID]...)
+	}
+}
 
-		status := invocationOutput.Status
-		switch status {
-		case types.CommandInvocationStatusSuccess:
-			return aws.ToString(invocationOutput.StandardOutputContent), nil
-		case types.CommandInvocationStatusFailed,
-			types.CommandInvocationStatusCancelled,
-			types.CommandInvocationStatusTimedOut:
-			stderr := aws.ToString(invocationOutput.StandardErrorContent)
-			return "", fmt.Errorf("command failed with status %s: %s", status, stderr)
+// pollInvocation checks the invocation of commandID on instanceID and
+// reports whether it has finished, along with its outcome if it has.
+func pollInvocation(ctx context.Context, client SSMAPI, commandID, instanceID string, output *commandOutputStore) (invocationResult, bool) {
+	invocationOutput, err := client.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
+		CommandId:  aws.String(commandID),
+		InstanceId: aws.String(instanceID),
+	})
+	if err != nil {
+		// SSM takes a moment to register the invocation after
+		// SendCommand returns
+		var notFound *types.InvocationDoesNotExist
+		if errors.As(err, &notFound) {
+			log.Debug("Invocation of command %s on %s is not registered yet", commandID, instanceID)
+			return invocationResult{}, false
 		}
+		return invocationResult{err: fmt.Errorf("failed to get status of command %s: %w", commandID, err)}, true
 	}
 
-	return "", fmt.Errorf("command timed out waiting for completion")
+	status := invocationOutput.Status
+	switch status {
+	case types.CommandInvocationStatusSuccess:
+		return invocationResult{output: output.complete(ctx, commandID, instanceID, stdoutStream, aws.ToString(invocationOutput.StandardOutputContent))}, true
+	case types.CommandInvocationStatusFailed,
+		types.CommandInvocationStatusCancelled,
+		types.CommandInvocationStatusTimedOut:
+		stderr := output.complete(ctx, commandID, instanceID, stderrStream, aws.ToString(invocationOutput.StandardErrorContent))
+		return invocationResult{err: fmt.Errorf("command failed with status %s: %s", status, stderr)}, true
+	}
+	log.Debug("Command %s is %s on %s", commandID, status, instanceID)
+	return invocationResult{}, false
+}
+
+// newSendCommandInput returns the request that runs commands on every
+// instance in instanceIDs with the given SSM document, allowing them
+// timeout to complete.
+func newSendCommandInput(instanceIDs []string, document string, commands []string, timeout time.Duration, output *commandOutputStore) *ssm.SendCommandInput {
+	seconds := max(int(timeout.Seconds()), 1)
+	input := &ssm.SendCommandInput{
+		InstanceIds:  instanceIDs,
+		DocumentName: aws.String(document),
+		Parameters: map[string][]string{
+			"commands":         commands,
+			"executionTimeout": {strconv.Itoa(seconds)},
+		},
+		// TimeoutSeconds bounds how long SSM waits to deliver the command,
+		// which it requires to be at least 30 seconds
+		TimeoutSeconds: aws.Int32(int32(max(seconds, minDeliveryTimeout))),
+	}
+	output.apply(input)
+	return input
+}
+
+// cancelCommand stops a command that is still running on the instances.
+// It is called once ctx is done, so it runs without ctx's cancellation.
+func cancelCommand(ctx context.Context, client SSMAPI, commandID string, instanceIDs ...string) {
+	log.Warn("Cancelling SSM command %s on instance %s...", commandID, strings.Join(instanceIDs, ", "))
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	_, err := client.CancelCommand(ctx, &ssm.CancelCommandInput{
+		CommandId:   aws.String(commandID),
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		log.Warn("Failed to cancel SSM command %s: %v", commandID, err)
+	}
 }
 
 // checkAWSCLIInstalled checks if AWS CLI is installed on an EC2 instance
-func checkAWSCLIInstalled(ctx context.Context, client SSMAPI, instanceID string) (bool, error) {
-	output, err := runSSMCommand(ctx, client, instanceID, []string{"which aws"})
+func checkAWSCLIInstalled(ctx context.Context, host remoteHost) (bool, error) {
+	output, err := host.run(ctx, host.platform.awsCLICheckCommand())
 	if err != nil {
 		// If the command fails, AWS CLI is not installed
 		if strings.Contains(err.Error(), "command failed") {
@@ -454,18 +1224,26 @@ func checkAWSCLIInstalled(ctx context.Context, client SSMAPI, instanceID string)
 		return false, err
 	}
 
-	// Check if output contains a valid path
-	return strings.Contains(output, "/aws"), nil
+	// Check if output contains a valid path, e.g. /usr/bin/aws or
+	// C:\Program Files\Amazon\AWSCLIV2\aws.exe
+	return strings.Contains(output, "/aws") || strings.Contains(strings.ToLower(output), `\aws`), nil
 }
 
-func retryOperation(operation func() error, maxRetries int, baseDelay int) error {
+// retryOperation runs operation until it succeeds, fails with an error
+// that is not retryable, or ctx is cancelled, backing off exponentially
+// between attempts.
+func retryOperation(ctx context.Context, operation func() error, maxRetries int, baseDelay int) error {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := time.Duration(baseDelay*(1<<uint(attempt-1))) * time.Second
 			log.Warn("Retry attempt %d/%d after %v...", attempt, maxRetries, delay)
-			time.Sleep(delay)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("operation cancelled: %w", ctx.Err())
+			case <-time.After(delay):
+			}
 		}
 
 		err := operation()
@@ -478,6 +1256,11 @@ func retryOperation(operation func() error, maxRetries int, baseDelay int) error
 
 		lastErr = err
 
+		if ctx.Err() != nil {
+			log.Debug("Operation failed after cancellation: %v", err)
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+		}
+
 		if !isRetryableError(err) {
 			log.Error("Non-retryable error encountered: %v", err)
 			return err
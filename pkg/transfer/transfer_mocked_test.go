@@ -24,16 +24,26 @@ package transfer
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cowdogmoo/bcp/pkg/journal"
 	"github.com/cowdogmoo/bcp/pkg/model"
 )
 
@@ -42,7 +52,15 @@ type mockS3Client struct {
 	putObjectFunc    func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
 	getObjectFunc    func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	deleteObjectFunc func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	deleteObjsFunc   func(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
 	listObjectsFunc  func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	headObjectFunc   func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	createMPUFunc    func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	uploadPartFunc   func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	completeMPUFunc  func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	abortMPUFunc     func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	presignGetFunc   func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	presignPutFunc   func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
 }
 
 func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
@@ -66,6 +84,25 @@ func (m *mockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObject
 	return &s3.DeleteObjectOutput{}, nil
 }
 
+// DeleteObjects deletes each key through DeleteObject unless
+// deleteObjsFunc is set, so tests can observe deletes the same way for
+// both APIs.
+func (m *mockS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if m.deleteObjsFunc != nil {
+		return m.deleteObjsFunc(ctx, params, optFns...)
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, obj := range params.Delete.Objects {
+		if _, err := m.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: params.Bucket, Key: obj.Key}); err != nil {
+			output.Errors = append(output.Errors, s3types.Error{Key: obj.Key, Code: aws.String("InternalError"), Message: aws.String(err.Error())})
+			continue
+		}
+		output.Deleted = append(output.Deleted, s3types.DeletedObject{Key: obj.Key})
+	}
+	return output, nil
+}
+
 func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
 	if m.listObjectsFunc != nil {
 		return m.listObjectsFunc(ctx, params, optFns...)
@@ -73,10 +110,74 @@ func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjects
 	return &s3.ListObjectsV2Output{}, nil
 }
 
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.headObjectFunc != nil {
+		return m.headObjectFunc(ctx, params, optFns...)
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if m.createMPUFunc != nil {
+		return m.createMPUFunc(ctx, params, optFns...)
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+func (m *mockS3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if m.uploadPartFunc != nil {
+		return m.uploadPartFunc(ctx, params, optFns...)
+	}
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if m.completeMPUFunc != nil {
+		return m.completeMPUFunc(ctx, params, optFns...)
+	}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if m.abortMPUFunc != nil {
+		return m.abortMPUFunc(ctx, params, optFns...)
+	}
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3Client) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if m.presignGetFunc != nil {
+		return m.presignGetFunc(ctx, params, optFns...)
+	}
+	return &v4.PresignedHTTPRequest{
+		URL:    fmt.Sprintf("https://%s.s3.amazonaws.com/%s?X-Amz-Signature=get", aws.ToString(params.Bucket), aws.ToString(params.Key)),
+		Method: "GET",
+	}, nil
+}
+
+func (m *mockS3Client) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if m.presignPutFunc != nil {
+		return m.presignPutFunc(ctx, params, optFns...)
+	}
+	return &v4.PresignedHTTPRequest{
+		URL:    fmt.Sprintf("https://%s.s3.amazonaws.com/%s?X-Amz-Signature=put", aws.ToString(params.Bucket), aws.ToString(params.Key)),
+		Method: "PUT",
+	}, nil
+}
+
+func TestMain(m *testing.M) {
+	// Poll mocked SSM commands without waiting on real command latency
+	commandPollInterval = time.Millisecond
+	maxCommandPollInterval = 10 * time.Millisecond
+	os.Exit(m.Run())
+}
+
 // Mock SSM client
 type mockSSMClient struct {
-	sendCommandFunc          func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error)
-	getCommandInvocationFunc func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error)
+	sendCommandFunc                 func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error)
+	getCommandInvocationFunc        func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error)
+	describeInstanceInformationFunc func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error)
+	cancelCommandFunc               func(ctx context.Context, params *ssm.CancelCommandInput, optFns ...func(*ssm.Options)) (*ssm.CancelCommandOutput, error)
 }
 
 func (m *mockSSMClient) SendCommand(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
@@ -100,6 +201,64 @@ func (m *mockSSMClient) GetCommandInvocation(ctx context.Context, params *ssm.Ge
 	}, nil
 }
 
+func (m *mockSSMClient) DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	if m.describeInstanceInformationFunc != nil {
+		return m.describeInstanceInformationFunc(ctx, params, optFns...)
+	}
+	return &ssm.DescribeInstanceInformationOutput{
+		InstanceInformationList: []types.InstanceInformation{
+			{
+				InstanceId:   aws.String(params.Filters[0].Values[0]),
+				PlatformType: types.PlatformTypeLinux,
+			},
+		},
+	}, nil
+}
+
+func (m *mockSSMClient) CancelCommand(ctx context.Context, params *ssm.CancelCommandInput, optFns ...func(*ssm.Options)) (*ssm.CancelCommandOutput, error) {
+	if m.cancelCommandFunc != nil {
+		return m.cancelCommandFunc(ctx, params, optFns...)
+	}
+	return &ssm.CancelCommandOutput{}, nil
+}
+
+// linuxHost returns a Linux test instance reached through client.
+func linuxHost(client SSMAPI) remoteHost {
+	return remoteHost{client: client, id: "i-1234567890abcdef0", platform: platformPOSIX}
+}
+
+// commandOutputSSMClient returns a mock whose commands succeed with the
+// output respond returns for the command that was sent.
+func commandOutputSSMClient(respond func(command string) string) *mockSSMClient {
+	var mu sync.Mutex
+	commands := make(map[string]string)
+
+	return &mockSSMClient{
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			commandID := fmt.Sprintf("command-%d", len(commands))
+			commands[commandID] = strings.Join(params.Parameters["commands"], "\n")
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String(commandID)}}, nil
+		},
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			mu.Lock()
+			command := commands[aws.ToString(params.CommandId)]
+			mu.Unlock()
+			return &ssm.GetCommandInvocationOutput{
+				Status:                types.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(respond(command)),
+			}, nil
+		},
+	}
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of content.
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
 func TestExecuteToRemoteWithClients_Success(t *testing.T) {
 	// Create temp directory and file
 	tmpDir, err := os.MkdirTemp("", "bcp-test")
@@ -123,21 +282,12 @@ func TestExecuteToRemoteWithClients_Success(t *testing.T) {
 		},
 	}
 
-	mockSSM := &mockSSMClient{
-		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
-			return &ssm.SendCommandOutput{
-				Command: &types.Command{
-					CommandId: aws.String("test-command-id"),
-				},
-			}, nil
-		},
-		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
-			return &ssm.GetCommandInvocationOutput{
-				Status:                types.CommandInvocationStatusSuccess,
-				StandardOutputContent: aws.String("/usr/bin/aws"),
-			}, nil
-		},
-	}
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		if strings.Contains(command, "sha256sum") {
+			return sha256Hex("test content") + "  /tmp/test.txt\n"
+		}
+		return "/usr/bin/aws"
+	})
 
 	config := model.TransferConfig{
 		Source:        testFile,
@@ -343,7 +493,7 @@ func TestUploadFile_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = uploadFile(ctx, mockS3, "test-bucket", testFile, "test.txt")
+	err = uploadFile(ctx, mockS3, "test-bucket", testFile, "test.txt", Options{})
 	if err != nil {
 		t.Errorf("uploadFile() error = %v", err)
 	}
@@ -353,7 +503,7 @@ func TestUploadFile_OpenError(t *testing.T) {
 	mockS3 := &mockS3Client{}
 
 	ctx := context.Background()
-	err := uploadFile(ctx, mockS3, "test-bucket", "/nonexistent/file.txt", "file.txt")
+	err := uploadFile(ctx, mockS3, "test-bucket", "/nonexistent/file.txt", "file.txt", Options{})
 	if err == nil {
 		t.Error("Expected error when file doesn't exist")
 	}
@@ -382,7 +532,7 @@ func TestUploadFile_S3Error(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = uploadFile(ctx, mockS3, "test-bucket", testFile, "test.txt")
+	err = uploadFile(ctx, mockS3, "test-bucket", testFile, "test.txt", Options{})
 	if err == nil {
 		t.Error("Expected error from S3 upload")
 	}
@@ -423,7 +573,7 @@ func TestUploadDirectory_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "")
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "", Options{})
 	if err != nil {
 		t.Errorf("uploadDirectory() error = %v", err)
 	}
@@ -517,7 +667,7 @@ func TestRunSSMCommand_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	output, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	output, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err != nil {
 		t.Errorf("runSSMCommand() error = %v", err)
 	}
@@ -534,7 +684,7 @@ func TestRunSSMCommand_SendCommandError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err == nil {
 		t.Error("Expected error from SendCommand")
 	}
@@ -558,7 +708,7 @@ func TestRunSSMCommand_Failed(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err == nil {
 		t.Error("Expected error from failed command")
 	}
@@ -582,7 +732,7 @@ func TestRunSSMCommand_Cancelled(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err == nil {
 		t.Error("Expected error from cancelled command")
 	}
@@ -606,13 +756,13 @@ func TestRunSSMCommand_TimedOut(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err == nil {
 		t.Error("Expected error from timed out command")
 	}
 }
 
-func TestRunSSMCommand_GetCommandInvocationError(t *testing.T) {
+func TestRunSSMCommand_InvocationNotRegisteredYet(t *testing.T) {
 	callCount := 0
 	mockSSM := &mockSSMClient{
 		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
@@ -624,9 +774,9 @@ func TestRunSSMCommand_GetCommandInvocationError(t *testing.T) {
 		},
 		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
 			callCount++
-			// Return error for first few calls, then success
+			// SSM has not registered the invocation for the first few calls
 			if callCount < 3 {
-				return nil, errors.New("GetCommandInvocation error")
+				return nil, &types.InvocationDoesNotExist{Message: aws.String("invocation does not exist")}
 			}
 			return &ssm.GetCommandInvocationOutput{
 				Status:                types.CommandInvocationStatusSuccess,
@@ -636,7 +786,7 @@ func TestRunSSMCommand_GetCommandInvocationError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	output, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
+	output, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
 	if err != nil {
 		t.Errorf("runSSMCommand() error = %v", err)
 	}
@@ -648,6 +798,54 @@ func TestRunSSMCommand_GetCommandInvocationError(t *testing.T) {
 	}
 }
 
+func TestRunSSMCommand_GetCommandInvocationError(t *testing.T) {
+	mockSSM := &mockSSMClient{
+		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+
+	ctx := context.Background()
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("runSSMCommand() error = %v, want the GetCommandInvocation error", err)
+	}
+}
+
+func TestRunSSMCommand_PassesTimeout(t *testing.T) {
+	var sent *ssm.SendCommandInput
+	mockSSM := &mockSSMClient{
+		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			sent = params
+			return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String("test-command-id")}}, nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		wantExecution string
+		wantDelivery  int32
+	}{
+		{"two hours", 2 * time.Hour, "7200", 7200},
+		{"below delivery minimum", 10 * time.Second, "10", 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runSSMCommand(context.Background(), mockSSM, "i-1234567890abcdef0", []string{"echo test"}, tt.timeout); err != nil {
+				t.Fatalf("runSSMCommand() error = %v", err)
+			}
+			if got := sent.Parameters["executionTimeout"]; len(got) != 1 || got[0] != tt.wantExecution {
+				t.Errorf("executionTimeout = %v, want %s", got, tt.wantExecution)
+			}
+			if got := aws.ToInt32(sent.TimeoutSeconds); got != tt.wantDelivery {
+				t.Errorf("TimeoutSeconds = %d, want %d", got, tt.wantDelivery)
+			}
+		})
+	}
+}
+
 func TestCheckAWSCLIInstalled_Installed(t *testing.T) {
 	mockSSM := &mockSSMClient{
 		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
@@ -666,7 +864,7 @@ func TestCheckAWSCLIInstalled_Installed(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	installed, err := checkAWSCLIInstalled(ctx, mockSSM, "i-1234567890abcdef0")
+	installed, err := checkAWSCLIInstalled(ctx, linuxHost(mockSSM))
 	if err != nil {
 		t.Errorf("checkAWSCLIInstalled() error = %v", err)
 	}
@@ -693,7 +891,7 @@ func TestCheckAWSCLIInstalled_NotInstalled(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	installed, err := checkAWSCLIInstalled(ctx, mockSSM, "i-1234567890abcdef0")
+	installed, err := checkAWSCLIInstalled(ctx, linuxHost(mockSSM))
 	if err != nil {
 		t.Errorf("checkAWSCLIInstalled() error = %v", err)
 	}
@@ -710,7 +908,7 @@ func TestCheckAWSCLIInstalled_Error(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := checkAWSCLIInstalled(ctx, mockSSM, "i-1234567890abcdef0")
+	_, err := checkAWSCLIInstalled(ctx, linuxHost(mockSSM))
 	if err == nil {
 		t.Error("Expected error from SSM")
 	}
@@ -743,21 +941,12 @@ func TestExecuteToRemoteWithClients_DirectoryUpload(t *testing.T) {
 	}
 
 	mockS3 := &mockS3Client{}
-	mockSSM := &mockSSMClient{
-		sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
-			return &ssm.SendCommandOutput{
-				Command: &types.Command{
-					CommandId: aws.String("test-command-id"),
-				},
-			}, nil
-		},
-		getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
-			return &ssm.GetCommandInvocationOutput{
-				Status:                types.CommandInvocationStatusSuccess,
-				StandardOutputContent: aws.String("/usr/bin/aws"),
-			}, nil
-		},
-	}
+	mockSSM := commandOutputSSMClient(func(command string) string {
+		if strings.Contains(command, "sha256sum") {
+			return sha256Hex("content1") + "  ./file1.txt\n" + sha256Hex("content2") + "  ./subdir/file2.txt\n"
+		}
+		return "/usr/bin/aws"
+	})
 
 	config := model.TransferConfig{
 		Source:        tmpDir,
@@ -898,14 +1087,20 @@ func TestRunSSMCommand_Timeout(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
-	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"})
-	if err == nil {
-		t.Error("Expected timeout error")
+	cancelled := false
+	mockSSM.cancelCommandFunc = func(ctx context.Context, params *ssm.CancelCommandInput, optFns ...func(*ssm.Options)) (*ssm.CancelCommandOutput, error) {
+		cancelled = true
+		return &ssm.CancelCommandOutput{}, nil
 	}
-	if !errors.Is(err, errors.New("command timed out waiting for completion")) && err.Error() != "command timed out waiting for completion" {
+
+	ctx := context.Background()
+	_, err := runSSMCommand(ctx, mockSSM, "i-1234567890abcdef0", []string{"echo test"}, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not complete within 50ms") {
 		t.Errorf("Expected timeout error, got: %v", err)
 	}
+	if !cancelled {
+		t.Error("Expected the command to be cancelled once the timeout passed")
+	}
 }
 
 func TestUploadDirectory_NestedStructure(t *testing.T) {
@@ -950,7 +1145,7 @@ func TestUploadDirectory_NestedStructure(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "")
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "", Options{})
 	if err != nil {
 		t.Errorf("uploadDirectory() error = %v", err)
 	}
@@ -985,7 +1180,7 @@ func TestUploadDirectory_UploadError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "")
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "", Options{})
 	if err == nil {
 		t.Error("Expected error from upload failure")
 	}
@@ -1010,7 +1205,7 @@ func TestCheckAWSCLIInstalled_OutputWithoutAWS(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	installed, err := checkAWSCLIInstalled(ctx, mockSSM, "i-1234567890abcdef0")
+	installed, err := checkAWSCLIInstalled(ctx, linuxHost(mockSSM))
 	if err != nil {
 		t.Errorf("checkAWSCLIInstalled() error = %v", err)
 	}
@@ -1112,7 +1307,7 @@ func TestUploadDirectory_WalkError(t *testing.T) {
 	mockS3 := &mockS3Client{}
 
 	ctx := context.Background()
-	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "")
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "", Options{})
 
 	// Restore permissions for cleanup
 	_ = os.Chmod(subDir, 0755)
@@ -1124,3 +1319,405 @@ func TestUploadDirectory_WalkError(t *testing.T) {
 		t.Logf("Got error (expected): %v", err)
 	}
 }
+
+func TestUploadDirectory_Concurrent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "bcp-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Errorf("Failed to remove temp dir: %v", err)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(name, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	uploadedKeys := make(map[string]bool)
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			uploadedKeys[aws.ToString(params.Key)] = true
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	ctx := context.Background()
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "prefix/", Options{Concurrency: 4})
+	if err != nil {
+		t.Errorf("uploadDirectory() error = %v", err)
+	}
+
+	if len(uploadedKeys) != 10 {
+		t.Errorf("Expected 10 files uploaded, got %d", len(uploadedKeys))
+	}
+	expectedKey := "prefix/" + filepath.Base(tmpDir) + "/file0.txt"
+	if !uploadedKeys[expectedKey] {
+		t.Errorf("Expected key %q to be uploaded, got %v", expectedKey, uploadedKeys)
+	}
+}
+
+func TestUploadDirectory_ConcurrentFatalError(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "bcp-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Errorf("Failed to remove temp dir: %v", err)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(tmpDir, fmt.Sprintf("file%02d.txt", i))
+		if err := os.WriteFile(name, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var calls atomic.Int32
+	mockS3 := &mockS3Client{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			calls.Add(1)
+			return nil, newMockAPIError("AccessDenied", "access denied")
+		},
+	}
+
+	ctx := context.Background()
+	err = uploadDirectory(ctx, mockS3, "test-bucket", tmpDir, "", Options{Concurrency: 2})
+	if err == nil {
+		t.Fatal("Expected error from upload failure")
+	}
+	if calls.Load() >= 20 {
+		t.Errorf("Expected remaining uploads to be cancelled, got %d PutObject calls", calls.Load())
+	}
+}
+
+func TestDownloadDirectory_Concurrent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "bcp-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Errorf("Failed to remove temp dir: %v", err)
+		}
+	}()
+
+	mockS3 := &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents: []s3types.Object{
+					{Key: aws.String("bcp-download-1/")},
+					{Key: aws.String("bcp-download-1/a.txt")},
+					{Key: aws.String("bcp-download-1/sub/b.txt")},
+					{Key: aws.String("bcp-download-1/sub/deeper/c.txt")},
+				},
+			}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader(aws.ToString(params.Key))),
+			}, nil
+		},
+	}
+
+	ctx := context.Background()
+	err = downloadDirectory(ctx, mockS3, "test-bucket", "bcp-download-1", tmpDir, Options{Concurrency: 3})
+	if err != nil {
+		t.Fatalf("downloadDirectory() error = %v", err)
+	}
+
+	for _, rel := range []string{"a.txt", "sub/b.txt", "sub/deeper/c.txt"} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, rel))
+		if err != nil {
+			t.Errorf("Expected %s to be downloaded: %v", rel, err)
+			continue
+		}
+		if string(content) != "bcp-download-1/"+rel {
+			t.Errorf("Unexpected content for %s: %q", rel, content)
+		}
+	}
+}
+
+func TestDownloadDirectory_AggregatesErrors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "bcp-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Errorf("Failed to remove temp dir: %v", err)
+		}
+	}()
+
+	mockS3 := &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents: []s3types.Object{
+					{Key: aws.String("prefix/a.txt")},
+					{Key: aws.String("prefix/b.txt")},
+					{Key: aws.String("prefix/c.txt")},
+				},
+			}, nil
+		},
+		getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			if aws.ToString(params.Key) == "prefix/b.txt" {
+				return nil, errors.New("connection reset by peer")
+			}
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader("content")),
+			}, nil
+		},
+	}
+
+	ctx := context.Background()
+	err = downloadDirectory(ctx, mockS3, "test-bucket", "prefix", tmpDir, Options{Concurrency: 2})
+	if err == nil {
+		t.Fatal("Expected error from failed download")
+	}
+
+	// Transient failures must not stop the other files from downloading
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if _, statErr := os.Stat(filepath.Join(tmpDir, name)); statErr != nil {
+			t.Errorf("Expected %s to be downloaded despite other failures: %v", name, statErr)
+		}
+	}
+}
+
+func TestExecuteWithJournal_CleansUpStagedObjects(t *testing.T) {
+	tests := []struct {
+		name        string
+		keepStaged  bool
+		failCopy    bool
+		wantDeleted bool
+	}{
+		{"success", false, false, true},
+		{"remote download failure", false, true, true},
+		{"keep staged on success", true, false, false},
+		{"keep staged on failure", true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := writeTempFile(t, []byte("test content"))
+			j := newTestJournal(t, model.TransferConfig{
+				Source:        testFile,
+				SSMInstanceID: "i-1234567890abcdef0",
+				Destination:   "/opt/app/large.bin",
+				BucketName:    "test-bucket",
+				MaxRetries:    0,
+				Direction:     model.ToRemote,
+				KeepStaged:    tt.keepStaged,
+			})
+
+			var uploaded, deleted []string
+			mockS3 := &mockS3Client{
+				putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					uploaded = append(uploaded, aws.ToString(params.Key))
+					return &s3.PutObjectOutput{}, nil
+				},
+				deleteObjectFunc: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+					deleted = append(deleted, aws.ToString(params.Key))
+					return &s3.DeleteObjectOutput{}, nil
+				},
+			}
+
+			var lastCommand string
+			mockSSM := &mockSSMClient{
+				sendCommandFunc: func(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+					lastCommand = strings.Join(params.Parameters["commands"], "\n")
+					return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String("test-command-id")}}, nil
+				},
+				getCommandInvocationFunc: func(ctx context.Context, params *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					switch {
+					case strings.Contains(lastCommand, "s3 cp") && tt.failCopy:
+						return &ssm.GetCommandInvocationOutput{
+							Status:               types.CommandInvocationStatusFailed,
+							StandardErrorContent: aws.String("disk full"),
+						}, nil
+					case strings.Contains(lastCommand, "sha256sum"):
+						return &ssm.GetCommandInvocationOutput{
+							Status:                types.CommandInvocationStatusSuccess,
+							StandardOutputContent: aws.String(sha256Hex("test content") + "  /opt/app/large.bin\n"),
+						}, nil
+					}
+					return &ssm.GetCommandInvocationOutput{
+						Status:                types.CommandInvocationStatusSuccess,
+						StandardOutputContent: aws.String("/usr/bin/aws"),
+					}, nil
+				},
+			}
+
+			err := ExecuteWithJournal(context.Background(), j, mockS3, mockSSM)
+			if (err != nil) != tt.failCopy {
+				t.Fatalf("ExecuteWithJournal() error = %v, wantErr %v", err, tt.failCopy)
+			}
+
+			if !tt.wantDeleted {
+				if len(deleted) != 0 {
+					t.Errorf("deleted = %v, want staged objects kept", deleted)
+				}
+				return
+			}
+			if len(uploaded) != 1 || len(deleted) != 1 || deleted[0] != uploaded[0] {
+				t.Errorf("deleted = %v, want the staged keys %v", deleted, uploaded)
+			}
+			if tt.failCopy && j.PhaseDone(journal.PhaseUpload) {
+				t.Error("Expected the journal to be reset so resuming uploads again")
+			}
+		})
+	}
+}
+
+func TestCleanupS3Objects_BatchesDeletes(t *testing.T) {
+	var keys []string
+	for i := range 2500 {
+		keys = append(keys, fmt.Sprintf("bcp/transfer-1/staged/dir/file-%04d", i))
+	}
+
+	var batches []int
+	mockS3 := &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			output := &s3.ListObjectsV2Output{}
+			for _, key := range keys {
+				output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key)})
+			}
+			return output, nil
+		},
+		deleteObjsFunc: func(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+			if !aws.ToBool(params.Delete.Quiet) {
+				t.Error("Expected quiet DeleteObjects requests")
+			}
+			batches = append(batches, len(params.Delete.Objects))
+			return &s3.DeleteObjectsOutput{}, nil
+		},
+	}
+
+	if err := CleanupS3Objects(context.Background(), mockS3, "test-bucket", "bcp/transfer-1/", true); err != nil {
+		t.Fatalf("CleanupS3Objects() error = %v", err)
+	}
+	if fmt.Sprint(batches) != "[1000 1000 500]" {
+		t.Errorf("batches = %v, want [1000 1000 500]", batches)
+	}
+}
+
+func TestCleanupS3Objects_ReportsFailedKeys(t *testing.T) {
+	mockS3 := &mockS3Client{
+		listObjectsFunc: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{Contents: []s3types.Object{
+				{Key: aws.String("bcp/transfer-1/staged/a")},
+				{Key: aws.String("bcp/transfer-1/staged/b")},
+				{Key: aws.String("bcp/transfer-1/staged/c")},
+			}}, nil
+		},
+		deleteObjsFunc: func(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+			return &s3.DeleteObjectsOutput{Errors: []s3types.Error{
+				{Key: aws.String("bcp/transfer-1/staged/b"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+			}}, nil
+		},
+	}
+
+	err := CleanupS3Objects(context.Background(), mockS3, "test-bucket", "bcp/transfer-1/", true)
+	var deleteErr *DeleteError
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("CleanupS3Objects() error = %v, want a *DeleteError", err)
+	}
+	if keys := deleteErr.Keys(); len(keys) != 1 || keys[0] != "bcp/transfer-1/staged/b" {
+		t.Errorf("Keys() = %v, want [bcp/transfer-1/staged/b]", keys)
+	}
+	if !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("error = %q, want the failure reason", err)
+	}
+}
+
+func TestDeleteS3Objects_RequestErrorFailsBatch(t *testing.T) {
+	mockS3 := &mockS3Client{
+		deleteObjsFunc: func(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+			return nil, errors.New("service unavailable")
+		},
+	}
+
+	failed := deleteS3Objects(context.Background(), mockS3, "test-bucket", []string{"a", "b"})
+	if len(failed) != 2 || failed["a"] != "service unavailable" || failed["b"] != "service unavailable" {
+		t.Errorf("failed = %v, want both keys failed with the request error", failed)
+	}
+}
+
+func TestDeleteError_TruncatesKeyList(t *testing.T) {
+	failed := make(map[string]string)
+	for i := range 12 {
+		failed[fmt.Sprintf("key-%02d", i)] = "AccessDenied"
+	}
+
+	msg := (&DeleteError{Bucket: "test-bucket", Failed: failed}).Error()
+	if !strings.Contains(msg, "failed to delete 12 object(s)") || !strings.Contains(msg, "and 2 more") || strings.Contains(msg, "key-11") {
+		t.Errorf("Error() = %q, want the first 10 keys and a count of the rest", msg)
+	}
+}
+
+func TestRemoteUpload_ServerSideEncryption(t *testing.T) {
+	tests := []struct {
+		name     string
+		sse      model.ServerSideEncryption
+		kmsKeyID string
+		want     string
+	}{
+		{"default", model.ServerSideEncryptionNone, "", "aws s3 cp /var/log/app.log s3://test-bucket/staged"},
+		{"AES256", model.ServerSideEncryptionAES256, "", "aws s3 cp /var/log/app.log s3://test-bucket/staged --sse AES256"},
+		{"KMS", model.ServerSideEncryptionKMS, "alias/staging", "aws s3 cp /var/log/app.log s3://test-bucket/staged --sse aws:kms --sse-kms-key-id alias/staging"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent string
+			mockSSM := commandOutputSSMClient(func(command string) string {
+				sent = command
+				return ""
+			})
+
+			transferConfig := model.TransferConfig{
+				Source:     "/var/log/app.log",
+				BucketName: "test-bucket",
+				SSE:        tt.sse,
+				KMSKeyID:   tt.kmsKeyID,
+			}
+			if err := remoteUpload(context.Background(), &mockS3Client{}, linuxHost(mockSSM), transferConfig, toolAWSCLI, "s3://test-bucket/staged", "staged", false); err != nil {
+				t.Fatalf("remoteUpload() error = %v", err)
+			}
+			if sent != tt.want {
+				t.Errorf("command = %q, want %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSS3Command(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     remoteHost
+		region   string
+		endpoint string
+		want     string
+	}{
+		{"default", linuxHost(nil), "", "", "aws s3 cp s3://test-bucket/staged /tmp/app.log"},
+		{"region", linuxHost(nil), "eu-west-1", "", "aws s3 cp s3://test-bucket/staged /tmp/app.log --region eu-west-1"},
+		{"endpoint", linuxHost(nil), "", "http://minio.internal:9000", "aws s3 cp s3://test-bucket/staged /tmp/app.log --endpoint-url http://minio.internal:9000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transferConfig := model.TransferConfig{BucketRegion: tt.region, S3Endpoint: tt.endpoint}
+			if got := awsS3Command(tt.host.platform, transferConfig, "s3", "cp", "s3://test-bucket/staged", "/tmp/app.log"); got != tt.want {
+				t.Errorf("awsS3Command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
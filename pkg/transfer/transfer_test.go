@@ -23,6 +23,7 @@ THE SOFTWARE.
 package transfer
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -228,7 +229,7 @@ func TestRetryOperation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := retryOperation(tt.operation, tt.maxRetries, tt.baseDelay)
+			err := retryOperation(context.Background(), tt.operation, tt.maxRetries, tt.baseDelay)
 			if (err != nil) != tt.expectError {
 				t.Errorf("retryOperation() error = %v, expectError %v", err, tt.expectError)
 			}
@@ -244,7 +245,7 @@ func TestRetryOperationExponentialBackoff(t *testing.T) {
 
 	// This should fail after trying multiple times with exponential backoff
 	// We're mainly testing that the function doesn't panic and handles retries
-	err := retryOperation(operation, 2, 1)
+	err := retryOperation(context.Background(), operation, 2, 1)
 	if err == nil {
 		t.Error("Expected error from retryOperation with always-failing operation")
 	}
@@ -24,10 +24,16 @@ package validation
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/cowdogmoo/bcp/pkg/model"
 )
 
 func ValidateSourcePath(path string) (bool, error) {
@@ -52,37 +58,170 @@ func ValidateSourcePath(path string) (bool, error) {
 	return info.Mode().IsDir(), nil
 }
 
-func ValidateSSMPath(ssmPath string) (instanceID string, destination string, err error) {
+// NameTargetPrefix marks an instance target as the value of an
+// instance's Name tag, as in name:web-01:/path.
+const NameTargetPrefix = "name:"
+
+// TagTargetPrefix marks a target as every managed instance with a tag,
+// as in tag:Role=web:/path.
+const TagTargetPrefix = "tag:"
+
+// instanceIDPattern matches the IDs of EC2 instances and of hybrid
+// managed nodes registered with SSM activations.
+var instanceIDPattern = regexp.MustCompile(`^m?i-[0-9a-f]{8,17}$`)
+
+// instanceIDLikePattern matches targets meant as instance IDs, so that a
+// mistyped ID is reported as such instead of being looked up as a host
+// name.
+var instanceIDLikePattern = regexp.MustCompile(`^m?i-[0-9a-fA-F]+$`)
+
+// hostNamePattern matches DNS host names such as web-01 or
+// ip-10-0-1-5.ec2.internal.
+var hostNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// IsInstanceID reports whether target is an instance or hybrid managed
+// node ID rather than a name, host name or IP address that has to be
+// resolved to one.
+func IsInstanceID(target string) bool {
+	return instanceIDPattern.MatchString(target)
+}
+
+// IsFanOutTarget reports whether target, as returned by ValidateSSMPath,
+// names several instances: tag:Key=Value or a comma-separated list.
+func IsFanOutTarget(target string) bool {
+	return strings.HasPrefix(target, TagTargetPrefix) || strings.Contains(target, ",")
+}
+
+// IsRemotePath reports whether arg names a path on an instance: a target
+// followed by a colon and an absolute path, as in web-01:/etc/app or
+// i-1234567890abcdef0:C:\temp. A single letter before the colon is a
+// local Windows drive letter instead, and a slash before it marks a local
+// path, so prefixing a path with ./ always keeps it local, as in
+// ./web-01:/backup.
+func IsRemotePath(arg string) bool {
+	if strings.HasPrefix(arg, NameTargetPrefix) || strings.HasPrefix(arg, TagTargetPrefix) {
+		return true
+	}
+	// An instance ID is taken as a target even without an absolute path
+	// so that ValidateSSMPath can report the relative path
+	if id, _, found := strings.Cut(arg, ":"); found && IsInstanceID(id) {
+		return true
+	}
+	target, _, found := splitRemotePath(arg)
+	return found && len(target) > 1 && !strings.ContainsAny(target, `/\`)
+}
+
+// remoteDrivePattern matches the colon before an absolute Windows path on
+// the instance, as in i-1234567890abcdef0:C:\temp.
+var remoteDrivePattern = regexp.MustCompile(`:[A-Za-z]:[\\/]`)
+
+// splitRemotePath splits arg into its target and absolute remote path at
+// the last colon followed by a Windows drive letter, or failing that at
+// the last colon followed by a slash or a UNC path's backslashes. Targets
+// such as tag:aws:cloudformation:stack-name=x may contain colons, so the
+// path is found from the end of arg.
+func splitRemotePath(arg string) (target, remotePath string, found bool) {
+	i := max(strings.LastIndex(arg, ":/"), strings.LastIndex(arg, `:\\`))
+	if matches := remoteDrivePattern.FindAllStringIndex(arg, -1); len(matches) > 0 {
+		i = matches[len(matches)-1][0]
+	}
+	if i < 0 {
+		return "", "", false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// ValidateSSMPath splits ssmPath into the instance it targets and the
+// path on that instance. The target is an instance or managed node ID,
+// name:<Name tag>, a private IP address or the instance's host name. To
+// copy to several instances, it is tag:Key=Value or a comma-separated
+// list of IDs, IP addresses and host names. Names and tags may contain
+// colons; the path is the absolute path after the last one.
+func ValidateSSMPath(ssmPath string) (target string, destination string, err error) {
 	if ssmPath == "" {
 		return "", "", fmt.Errorf("SSM path cannot be empty")
 	}
 
-	parts := strings.Split(ssmPath, ":")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid SSM path format, expected 'instance-id:destination', got: %s", ssmPath)
+	rest, named := strings.CutPrefix(ssmPath, NameTargetPrefix)
+	var tagged bool
+	if !named {
+		rest, tagged = strings.CutPrefix(rest, TagTargetPrefix)
+	}
+
+	target, destination, found := splitRemotePath(rest)
+	if !found {
+		// Without an absolute path, split on the first colon so the
+		// relative path can be reported below
+		target, destination, found = strings.Cut(rest, ":")
+	}
+	if !found {
+		return "", "", fmt.Errorf("invalid SSM path format, expected 'instance:destination', got: %s", ssmPath)
 	}
 
-	instanceID = strings.TrimSpace(parts[0])
-	destination = strings.TrimSpace(parts[1])
+	target = strings.TrimSpace(target)
+	destination = strings.TrimSpace(destination)
 
-	if instanceID == "" {
-		return "", "", fmt.Errorf("SSM instance ID cannot be empty")
+	if target == "" {
+		return "", "", fmt.Errorf("SSM instance cannot be empty")
 	}
 
 	if destination == "" {
 		return "", "", fmt.Errorf("destination path cannot be empty")
 	}
 
-	instanceIDPattern := regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
-	if !instanceIDPattern.MatchString(instanceID) {
-		return "", "", fmt.Errorf("invalid SSM instance ID format: %s (expected format: i-xxxxxxxxx)", instanceID)
+	switch {
+	case named:
+		target = NameTargetPrefix + target
+	case tagged:
+		key, value, _ := strings.Cut(target, "=")
+		if key == "" || value == "" {
+			return "", "", fmt.Errorf("invalid tag target %q (expected format: tag:Key=Value)", TagTargetPrefix+target)
+		}
+		target = TagTargetPrefix + target
+	case strings.Contains(target, ","):
+		instances := strings.Split(target, ",")
+		for i, instance := range instances {
+			instances[i] = strings.TrimSpace(instance)
+			if err := validateInstanceTarget(instances[i]); err != nil {
+				return "", "", err
+			}
+		}
+		target = strings.Join(instances, ",")
+	default:
+		if err := validateInstanceTarget(target); err != nil {
+			return "", "", err
+		}
 	}
 
-	if !filepath.IsAbs(destination) {
+	if !isAbsRemotePath(destination) {
 		return "", "", fmt.Errorf("destination must be an absolute path, got: %s", destination)
 	}
 
-	return instanceID, destination, nil
+	return target, destination, nil
+}
+
+// validateInstanceTarget checks that target is an instance ID, an IP
+// address or a host name.
+func validateInstanceTarget(target string) error {
+	switch {
+	case target == "":
+		return fmt.Errorf("SSM instance cannot be empty")
+	case instanceIDLikePattern.MatchString(target) && !IsInstanceID(target):
+		return fmt.Errorf("invalid SSM instance ID format: %s (expected format: i-xxxxxxxxx or mi-xxxxxxxxx)", target)
+	case IsInstanceID(target), net.ParseIP(target) != nil, hostNamePattern.MatchString(target):
+		return nil
+	}
+	return fmt.Errorf("invalid SSM instance %q (expected an instance ID, name:<Name tag>, IP address or host name)", target)
+}
+
+// windowsAbsPathPattern matches Windows drive-letter paths such as
+// C:\Users or C:/Users.
+var windowsAbsPathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// isAbsRemotePath reports whether p is absolute on the instance, which
+// may be a Linux or a Windows machine regardless of the local platform.
+func isAbsRemotePath(p string) bool {
+	return path.IsAbs(p) || windowsAbsPathPattern.MatchString(p) || strings.HasPrefix(p, `\\`)
 }
 
 func ValidateDestinationPath(path string) error {
@@ -161,3 +300,71 @@ func ValidateBucketName(bucket string) error {
 
 	return nil
 }
+
+// ValidateRemoteTransport checks that mode names a supported remote
+// transport.
+func ValidateRemoteTransport(mode string) error {
+	switch model.RemoteTransport(mode) {
+	case model.RemoteTransportAuto, model.RemoteTransportAWSCLI, model.RemoteTransportPresigned:
+		return nil
+	}
+	return fmt.Errorf("unsupported remote transport %q (must be one of auto, awscli, presigned)", mode)
+}
+
+// ValidateSSE checks that mode names a supported server-side encryption
+// and that a KMS key is only given for SSE-KMS.
+func ValidateSSE(mode, kmsKeyID string) error {
+	switch model.ServerSideEncryption(mode) {
+	case model.ServerSideEncryptionNone, model.ServerSideEncryptionAES256:
+		if kmsKeyID != "" {
+			return fmt.Errorf("a KMS key ID requires server-side encryption %s", model.ServerSideEncryptionKMS)
+		}
+		return nil
+	case model.ServerSideEncryptionKMS:
+		return nil
+	}
+	return fmt.Errorf("unsupported server-side encryption %q (must be one of AES256, aws:kms)", mode)
+}
+
+// MaxCommandTimeout is the longest execution timeout, in seconds, the SSM
+// shell script documents accept.
+const MaxCommandTimeout = 172800
+
+// ValidateCommandTimeout checks that seconds is a timeout SSM can run a
+// command with.
+func ValidateCommandTimeout(seconds int) error {
+	if seconds < 1 || seconds > MaxCommandTimeout {
+		return fmt.Errorf("command timeout must be between 1 and %d seconds, got %d", MaxCommandTimeout, seconds)
+	}
+	return nil
+}
+
+// roleARNPattern matches IAM role ARNs in any AWS partition.
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/[\w+=,.@/-]+$`)
+
+// ValidateRoleARN checks that arn names an IAM role.
+func ValidateRoleARN(arn string) error {
+	if !roleARNPattern.MatchString(arn) {
+		return fmt.Errorf("invalid role ARN %q (expected format: arn:aws:iam::123456789012:role/name)", arn)
+	}
+	return nil
+}
+
+// ValidateEndpoint checks that endpoint is an absolute http or https URL
+// that AWS clients can be pointed at.
+func ValidateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q (expected an http or https URL such as http://localhost:9000)", endpoint)
+	}
+	return nil
+}
+
+// ValidateExpirationDays checks that days is a lifecycle expiration S3
+// accepts.
+func ValidateExpirationDays(days int) error {
+	if days < 1 || days > math.MaxInt32 {
+		return fmt.Errorf("expiration must be between 1 and %d days, got %d", math.MaxInt32, days)
+	}
+	return nil
+}
@@ -94,14 +94,133 @@ func TestValidateSSMPath(t *testing.T) {
 		},
 		{
 			name:    "invalid instance ID",
-			ssmPath: "invalid:/home/ec2-user",
+			ssmPath: "i-123:/home/ec2-user",
 			wantErr: true,
 		},
+		{
+			name:            "hybrid managed node",
+			ssmPath:         "mi-0123456789abcdef0:/opt/app",
+			wantInstanceID:  "mi-0123456789abcdef0",
+			wantDestination: "/opt/app",
+		},
+		{
+			name:    "invalid managed node ID",
+			ssmPath: "mi-0123:/opt/app",
+			wantErr: true,
+		},
+		{
+			name:            "tag target",
+			ssmPath:         "tag:Role=web:/etc/app/app.conf",
+			wantInstanceID:  "tag:Role=web",
+			wantDestination: "/etc/app/app.conf",
+		},
+		{
+			name:            "tag target with colons",
+			ssmPath:         "tag:aws:cloudformation:stack-name=x:/p",
+			wantInstanceID:  "tag:aws:cloudformation:stack-name=x",
+			wantDestination: "/p",
+		},
+		{
+			name:    "tag target without a value",
+			ssmPath: "tag:Role:/etc/app/app.conf",
+			wantErr: true,
+		},
+		{
+			name:            "instance list",
+			ssmPath:         "i-1234567890abcdef0, web-02,10.0.1.5:/etc/app/app.conf",
+			wantInstanceID:  "i-1234567890abcdef0,web-02,10.0.1.5",
+			wantDestination: "/etc/app/app.conf",
+		},
+		{
+			name:    "instance list with an invalid entry",
+			ssmPath: "i-1234567890abcdef0,i-123:/etc/app/app.conf",
+			wantErr: true,
+		},
+		{
+			name:    "instance list with an empty entry",
+			ssmPath: "i-1234567890abcdef0,:/etc/app/app.conf",
+			wantErr: true,
+		},
+		{
+			name:            "host name that looks like an ID prefix",
+			ssmPath:         "mi-server:/opt/app",
+			wantInstanceID:  "mi-server",
+			wantDestination: "/opt/app",
+		},
+		{
+			name:    "invalid instance",
+			ssmPath: "web_01!:/home/ec2-user",
+			wantErr: true,
+		},
+		{
+			name:            "name tag",
+			ssmPath:         "name:web-01:/home/ec2-user",
+			wantInstanceID:  "name:web-01",
+			wantDestination: "/home/ec2-user",
+		},
+		{
+			name:            "name tag with spaces",
+			ssmPath:         "name:Web Server:C:/temp",
+			wantInstanceID:  "name:Web Server",
+			wantDestination: "C:/temp",
+		},
+		{
+			name:            "name tag with a colon",
+			ssmPath:         "name:web:blue:/srv/app",
+			wantInstanceID:  "name:web:blue",
+			wantDestination: "/srv/app",
+		},
+		{
+			name:            "name tag with a colon and a windows path",
+			ssmPath:         `name:web:blue:C:\temp`,
+			wantInstanceID:  "name:web:blue",
+			wantDestination: `C:\temp`,
+		},
+		{
+			name:    "empty name tag",
+			ssmPath: "name::/home/ec2-user",
+			wantErr: true,
+		},
+		{
+			name:            "host name",
+			ssmPath:         "ip-10-0-1-5.ec2.internal:/tmp",
+			wantInstanceID:  "ip-10-0-1-5.ec2.internal",
+			wantDestination: "/tmp",
+		},
+		{
+			name:            "IP address",
+			ssmPath:         "10.0.1.5:/tmp",
+			wantInstanceID:  "10.0.1.5",
+			wantDestination: "/tmp",
+		},
 		{
 			name:    "relative destination path",
 			ssmPath: "i-1234567890abcdef0:home/ec2-user",
 			wantErr: true,
 		},
+		{
+			name:            "windows drive path",
+			ssmPath:         `i-1234567890abcdef0:C:\Users\Administrator`,
+			wantInstanceID:  "i-1234567890abcdef0",
+			wantDestination: `C:\Users\Administrator`,
+		},
+		{
+			name:            "windows drive path with forward slashes",
+			ssmPath:         "i-1234567890abcdef0:C:/temp",
+			wantInstanceID:  "i-1234567890abcdef0",
+			wantDestination: "C:/temp",
+		},
+		{
+			name:            "windows UNC path",
+			ssmPath:         `i-1234567890abcdef0:\\server\share`,
+			wantInstanceID:  "i-1234567890abcdef0",
+			wantDestination: `\\server\share`,
+		},
+		{
+			name:    "relative windows path",
+			ssmPath: "i-1234567890abcdef0:C:temp",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -123,6 +242,58 @@ func TestValidateSSMPath(t *testing.T) {
 	}
 }
 
+func TestIsRemotePath(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"i-1234567890abcdef0:/tmp", true},
+		{"web-01:/tmp", true},
+		{"name:web-01:/tmp", true},
+		{"10.0.1.5:/tmp", true},
+		{"tag:Role=web:/tmp", true},
+		{"i-1234567890abcdef0,web-02:/tmp", true},
+		{"/tmp/file", false},
+		{"./dir/a:b", false},
+		{"notes:v2.txt", false},
+		{"./web-01:/backup", false},
+		{"tag:aws:cloudformation:stack-name=x:/p", true},
+		{"web-01:C:/temp", true},
+		{"C:/Users/file", false},
+		{`C:\Users\file`, false},
+		{"file.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := IsRemotePath(tt.arg); got != tt.want {
+				t.Errorf("IsRemotePath(%q) = %v, want %v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFanOutTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"tag:Role=web", true},
+		{"i-1234567890abcdef0,web-02", true},
+		{"i-1234567890abcdef0", false},
+		{"name:web-01", false},
+		{"web-01", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := IsFanOutTarget(tt.target); got != tt.want {
+				t.Errorf("IsFanOutTarget(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateBucketName(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -152,3 +323,149 @@ func TestValidateBucketName(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRemoteTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		wantErr bool
+	}{
+		{"auto", "auto", false},
+		{"awscli", "awscli", false},
+		{"presigned", "presigned", false},
+		{"empty", "", true},
+		{"unknown", "scp", true},
+		{"wrong case", "Presigned", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRemoteTransport(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRemoteTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSSE(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		kmsKeyID string
+		wantErr  bool
+	}{
+		{"none", "", "", false},
+		{"AES256", "AES256", "", false},
+		{"KMS with default key", "aws:kms", "", false},
+		{"KMS with key", "aws:kms", "alias/staging", false},
+		{"unsupported", "aws:kms:dsse", "", true},
+		{"lowercase", "aes256", "", true},
+		{"key without KMS", "", "alias/staging", true},
+		{"key with AES256", "AES256", "alias/staging", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSSE(tt.mode, tt.kmsKeyID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSSE() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds int
+		wantErr bool
+	}{
+		{"one second", 1, false},
+		{"one hour", 3600, false},
+		{"maximum", MaxCommandTimeout, false},
+		{"zero", 0, true},
+		{"negative", -1, true},
+		{"above maximum", MaxCommandTimeout + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCommandTimeout(tt.seconds)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCommandTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateExpirationDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    int
+		wantErr bool
+	}{
+		{"one day", 1, false},
+		{"one week", 7, false},
+		{"zero", 0, true},
+		{"negative", -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateExpirationDays(tt.days)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExpirationDays() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  bool
+	}{
+		{"http", "http://localhost:9000", false},
+		{"https with path", "https://objects.example.com/s3", false},
+		{"missing scheme", "localhost:9000", true},
+		{"unsupported scheme", "ftp://localhost", true},
+		{"missing host", "http://", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpoint(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRoleARN(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		wantErr bool
+	}{
+		{"valid", "arn:aws:iam::123456789012:role/bcp", false},
+		{"valid with path", "arn:aws:iam::123456789012:role/ops/bcp-transfer", false},
+		{"govcloud partition", "arn:aws-us-gov:iam::123456789012:role/bcp", false},
+		{"empty", "", true},
+		{"user ARN", "arn:aws:iam::123456789012:user/bcp", true},
+		{"short account ID", "arn:aws:iam::1234:role/bcp", true},
+		{"missing role name", "arn:aws:iam::123456789012:role/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRoleARN(tt.arn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRoleARN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}